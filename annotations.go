@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+// annotation is an error reported to the CI system, pointing at the RFML
+// file it's about
+type annotation struct {
+	// path is empty if the error isn't about a file
+	path string
+	// line is 0 if the error isn't about a line
+	line    int
+	title   string
+	message string
+}
+
+// annotator reports annotations in the format of a CI system
+type annotator interface {
+	annotate(annotations []annotation) error
+}
+
+// annotators are the available annotation formats
+var annotators = map[string]annotator{
+	"github": githubAnnotator{},
+	"gitlab": gitlabAnnotator{path: "gl-code-quality-report.json"},
+	"azure":  azureAnnotator{},
+}
+
+// ciAnnotators maps the CI systems detected by --annotations auto to their
+// annotation formats
+var ciAnnotators = map[string]string{
+	"github-actions":  "github",
+	"gitlab":          "gitlab",
+	"azure-pipelines": "azure",
+}
+
+// getAnnotator returns the annotator chosen with --annotations, or nil if
+// annotations are disabled or no supported CI system is detected.
+func getAnnotator(c cliContext) (annotator, error) {
+	format := c.String("annotations")
+	if format == "auto" {
+		found, ciName := whichCI()
+		if !found || ciAnnotators[ciName] == "" {
+			return nil, nil
+		}
+		format = ciAnnotators[ciName]
+	}
+	if format == "" {
+		return nil, nil
+	}
+
+	a, ok := annotators[format]
+	if !ok {
+		return nil, fmt.Errorf("Invalid annotations format %v, use one of auto, azure, github or gitlab", format)
+	}
+	return a, nil
+}
+
+// errorAnnotations returns the annotations of RFML parsing and validation
+// errors
+func errorAnnotations(errs []error) []annotation {
+	annotations := make([]annotation, len(errs))
+	for i, err := range errs {
+		a := annotation{title: "RFML validation error", message: err.Error()}
+		if fileErr, ok := err.(fileParseError); ok {
+			a.path = fileErr.filePath
+			a.line = fileErr.line()
+			a.message = strings.TrimSpace(fileErr.parseError.Error())
+		}
+		annotations[i] = a
+	}
+	return annotations
+}
+
+// annotateErrors reports RFML errors with the annotator, if there's one
+func annotateErrors(a annotator, errs []error) {
+	if a == nil || len(errs) == 0 {
+		return
+	}
+	err := a.annotate(errorAnnotations(errs))
+	if err != nil {
+		log.Printf("Unable to write the annotations: %v", err)
+	}
+}
+
+// failedTestsAPI fetches what's needed to match failed tests to their RFML
+// files
+type failedTestsAPI interface {
+	GetRunTests(int) ([]rainforest.RunTest, error)
+	GetTestIDs() ([]rainforest.TestIDPair, error)
+}
+
+// failedTestAnnotations returns the annotations of the failed tests of the
+// run. Tests are matched to their RFML files in rfmlPaths by RFML ID. The
+// failures from the JUnit report are used, without files, if the tests of
+// the run can't be fetched.
+func failedTestAnnotations(api failedTestsAPI, report *runReport, rfmlPaths []string) []annotation {
+	type failedTest struct {
+		id   int
+		name string
+	}
+	messages := map[string]string{}
+	var failed []failedTest
+	for _, test := range report.tests() {
+		if test.Result == "failed" {
+			messages[test.Name] = test.Message
+			failed = append(failed, failedTest{name: test.Name})
+		}
+	}
+	runTests, err := api.GetRunTests(report.status.ID)
+	if err != nil {
+		log.Printf("Unable to get the tests of run %v: %v", report.status.ID, err)
+	} else {
+		failed = nil
+		for _, test := range runTests {
+			if test.Result == "failed" {
+				failed = append(failed, failedTest{id: test.ID, name: test.Title})
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	var existingPaths []string
+	for _, path := range rfmlPaths {
+		if _, err := os.Stat(path); err == nil {
+			existingPaths = append(existingPaths, path)
+		}
+	}
+	pathsByRFMLID := map[string]string{}
+	tests, err := readRFMLFiles(existingPaths)
+	if err != nil {
+		log.Printf("Unable to read the RFML files of the failed tests: %v", err)
+	}
+	for _, test := range tests {
+		pathsByRFMLID[test.RFMLID] = test.RFMLPath
+	}
+	rfmlIDs := map[int]string{}
+	if len(pathsByRFMLID) > 0 {
+		testIDPairs, err := api.GetTestIDs()
+		if err != nil {
+			log.Printf("Unable to get the RFML IDs of the failed tests: %v", err)
+		}
+		for _, pair := range testIDPairs {
+			rfmlIDs[pair.ID] = pair.RFMLID
+		}
+	}
+
+	annotations := make([]annotation, len(failed))
+	for i, test := range failed {
+		message := fmt.Sprintf("%v failed in run %v", test.name, report.status.ID)
+		if messages[test.name] != "" {
+			message += ": " + messages[test.name]
+		}
+		annotations[i] = annotation{
+			path:    pathsByRFMLID[rfmlIDs[test.id]],
+			title:   "Rainforest test failed",
+			message: message,
+		}
+	}
+	return annotations
+}
+
+// annotateFailedTests reports the failed tests of the run with the annotator
+func annotateFailedTests(a annotator, api failedTestsAPI, report *runReport, rfmlPaths []string) {
+	annotations := failedTestAnnotations(api, report, rfmlPaths)
+	if len(annotations) == 0 {
+		return
+	}
+	err := a.annotate(annotations)
+	if err != nil {
+		log.Printf("Unable to write the annotations: %v", err)
+	}
+}
+
+// githubAnnotator prints GitHub Actions error workflow commands
+type githubAnnotator struct{}
+
+func (githubAnnotator) annotate(annotations []annotation) error {
+	escapeData := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	escapeProperty := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	for _, a := range annotations {
+		var properties []string
+		if a.path != "" {
+			properties = append(properties, "file="+escapeProperty.Replace(a.path))
+		}
+		if a.line > 0 {
+			properties = append(properties, fmt.Sprintf("line=%v", a.line))
+		}
+		properties = append(properties, "title="+escapeProperty.Replace(a.title))
+		_, err := fmt.Fprintf(annotationsOut, "::error %v::%v\n", strings.Join(properties, ","), escapeData.Replace(a.message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// azureAnnotator prints Azure Pipelines logging commands
+type azureAnnotator struct{}
+
+func (azureAnnotator) annotate(annotations []annotation) error {
+	escape := strings.NewReplacer("%", "%AZP25", ";", "%3B", "\r", "%0D", "\n", "%0A", "]", "%5D")
+	for _, a := range annotations {
+		properties := "type=error;"
+		if a.path != "" {
+			properties += "sourcepath=" + escape.Replace(a.path) + ";"
+		}
+		if a.line > 0 {
+			properties += fmt.Sprintf("linenumber=%v;", a.line)
+		}
+		_, err := fmt.Fprintf(annotationsOut, "##vso[task.logissue %v]%v: %v\n", properties, a.title, escape.Replace(a.message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codeQualityIssue is an issue of a GitLab Code Quality report
+type codeQualityIssue struct {
+	Description string              `json:"description"`
+	CheckName   string              `json:"check_name"`
+	Fingerprint string              `json:"fingerprint"`
+	Severity    string              `json:"severity"`
+	Location    codeQualityLocation `json:"location"`
+}
+
+type codeQualityLocation struct {
+	Path  string `json:"path"`
+	Lines struct {
+		Begin int `json:"begin"`
+	} `json:"lines"`
+}
+
+// gitlabAnnotator writes a GitLab Code Quality report, which GitLab shows in
+// merge requests when it's uploaded as a codequality report artifact. GitLab
+// has no log annotations, and issues have to point at a file, so errors that
+// aren't about a file are left out. Issues are added to an existing report,
+// so matrix legs and several commands in one job all end up in it.
+type gitlabAnnotator struct {
+	path string
+}
+
+// readCodeQualityReport reads the issues of an existing report, if any
+func readCodeQualityReport(path string) ([]codeQualityIssue, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []codeQualityIssue{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var issues []codeQualityIssue
+	err = json.Unmarshal(content, &issues)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid GitLab Code Quality report %v: %v", path, err)
+	}
+	return issues, nil
+}
+
+func (g gitlabAnnotator) annotate(annotations []annotation) error {
+	issues, err := readCodeQualityReport(g.path)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, issue := range issues {
+		seen[issue.Fingerprint] = true
+	}
+
+	added := 0
+	for _, a := range annotations {
+		if a.path == "" {
+			continue
+		}
+		issue := codeQualityIssue{
+			Description: a.message,
+			CheckName:   a.title,
+			Severity:    "major",
+		}
+		issue.Location.Path = a.path
+		issue.Location.Lines.Begin = a.line
+		if issue.Location.Lines.Begin == 0 {
+			issue.Location.Lines.Begin = 1
+		}
+		sum := md5.Sum([]byte(fmt.Sprintf("%v:%v:%v", a.path, a.line, a.message)))
+		issue.Fingerprint = hex.EncodeToString(sum[:])
+		if seen[issue.Fingerprint] {
+			continue
+		}
+		seen[issue.Fingerprint] = true
+		issues = append(issues, issue)
+		added++
+	}
+
+	out, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(g.path, append(out, '\n'), 0666)
+	if err != nil {
+		return err
+	}
+	log.Printf("Added %v issue(s) to the GitLab Code Quality report %v", added, g.path)
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func writeRFMLFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "rainforest-annotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGetAnnotator(t *testing.T) {
+	defer func(f func() (bool, string)) { whichCI = f }(whichCI)
+
+	testCases := []struct {
+		format string
+		ci     string
+		want   annotator
+	}{
+		{"", "github-actions", nil},
+		{"github", "", githubAnnotator{}},
+		{"auto", "github-actions", githubAnnotator{}},
+		{"auto", "azure-pipelines", azureAnnotator{}},
+		{"auto", "gitlab", gitlabAnnotator{path: "gl-code-quality-report.json"}},
+		{"auto", "circle-ci", nil},
+		{"auto", "", nil},
+	}
+	for _, tc := range testCases {
+		ci := tc.ci
+		whichCI = func() (bool, string) { return ci != "", ci }
+		c := newFakeContext(map[string]interface{}{"annotations": tc.format}, cli.Args{})
+		got, err := getAnnotator(c)
+		if err != nil {
+			t.Errorf("%v on %v: %v", tc.format, tc.ci, err)
+		}
+		if got != tc.want {
+			t.Errorf("%v on %v: got %#v, want %#v", tc.format, tc.ci, got, tc.want)
+		}
+	}
+
+	c := newFakeContext(map[string]interface{}{"annotations": "jenkins"}, cli.Args{})
+	if _, err := getAnnotator(c); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestErrorAnnotations(t *testing.T) {
+	dir := writeRFMLFiles(t, map[string]string{"bad.rfml": "#! bad\n# title: Bad\n# site_id: abc\n"})
+	defer os.RemoveAll(dir)
+
+	_, parseErr := readRFMLFile(filepath.Join(dir, "bad.rfml"))
+	if parseErr == nil {
+		t.Fatal("Expected a parse error")
+	}
+	got := errorAnnotations([]error{parseErr, errValidation})
+	want := []annotation{
+		{path: filepath.Join(dir, "bad.rfml"), line: 3, title: "RFML validation error", message: "RFML parsing error in line 3: Site ID must be a valid integer"},
+		{title: "RFML validation error", message: "Validation failed"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errorAnnotations returned %+v, want %+v", got, want)
+	}
+}
+
+func TestAnnotators(t *testing.T) {
+	defer func(w io.Writer) { annotationsOut = w }(annotationsOut)
+	annotations := []annotation{
+		{path: "spec/a,b.rfml", line: 3, title: "RFML validation error", message: "100% broken\nreally"},
+		{title: "Rainforest test failed", message: "Checkout failed in run 12"},
+	}
+
+	out := &bytes.Buffer{}
+	annotationsOut = out
+	err := githubAnnotator{}.annotate(annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "::error file=spec/a%2Cb.rfml,line=3,title=RFML validation error::100%25 broken%0Areally\n" +
+		"::error title=Rainforest test failed::Checkout failed in run 12\n"
+	if out.String() != want {
+		t.Errorf("Unexpected GitHub annotations:\n%v\nwant:\n%v", out.String(), want)
+	}
+
+	out.Reset()
+	err = azureAnnotator{}.annotate(annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "##vso[task.logissue type=error;sourcepath=spec/a,b.rfml;linenumber=3;]RFML validation error: 100%AZP25 broken%0Areally\n" +
+		"##vso[task.logissue type=error;]Rainforest test failed: Checkout failed in run 12\n"
+	if out.String() != want {
+		t.Errorf("Unexpected Azure annotations:\n%v\nwant:\n%v", out.String(), want)
+	}
+
+	dir := writeRFMLFiles(t, nil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "codequality.json")
+	err = gitlabAnnotator{path: path}.annotate(annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issues []codeQualityIssue
+	err = json.Unmarshal(content, &issues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].Location.Path != "spec/a,b.rfml" || issues[0].Location.Lines.Begin != 3 || issues[0].Fingerprint == "" {
+		t.Errorf("Unexpected Code Quality report:\n%s", content)
+	}
+
+	// Later annotations are added to the report, without duplicates
+	more := []annotation{annotations[0], {path: "spec/c.rfml", title: "Rainforest test failed", message: "Login failed in run 13"}}
+	err = gitlabAnnotator{path: path}.annotate(more)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues = nil
+	err = json.Unmarshal(content, &issues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 2 || issues[0].Location.Path != "spec/a,b.rfml" || issues[1].Location.Path != "spec/c.rfml" {
+		t.Errorf("Expected the issues of both calls in the Code Quality report:\n%s", content)
+	}
+}
+
+func TestValidateRFMLAnnotations(t *testing.T) {
+	defer func(w io.Writer) { annotationsOut = w }(annotationsOut)
+	out := &bytes.Buffer{}
+	annotationsOut = out
+
+	dir := writeRFMLFiles(t, map[string]string{
+		"a.rfml": "#! same-id\n# title: A\n",
+		"b.rfml": "#! same-id\n# title: B\n",
+	})
+	defer os.RemoveAll(dir)
+
+	c := newFakeContext(map[string]interface{}{"test-folder": dir, "annotations": "github"}, cli.Args{})
+	err := validateRFML(c, new(testRfmlAPI))
+	if err == nil {
+		t.Fatal("Expected the validation to fail")
+	}
+	want := "::error file=" + filepath.Join(dir, "b.rfml") + ",title=RFML validation error::duplicate RFML id same-id, also found in: " + filepath.Join(dir, "a.rfml") + "\n"
+	if out.String() != want {
+		t.Errorf("Unexpected annotations:\n%v\nwant:\n%v", out.String(), want)
+	}
+}
+
+func TestMonitorRunStatusAnnotations(t *testing.T) {
+	defer func(d time.Duration) { runStatusPollInterval = d }(runStatusPollInterval)
+	runStatusPollInterval = time.Millisecond
+	defer func(w io.Writer) { annotationsOut = w }(annotationsOut)
+	out := &bytes.Buffer{}
+	annotationsOut = out
+
+	// Tests are matched by ID, whatever their titles
+	dir := writeRFMLFiles(t, map[string]string{
+		"checkout.rfml":    "#! checkout\n# title: Checkout\n",
+		"checkout_eu.rfml": "#! checkout-eu\n# title: Checkout\n",
+		"search.rfml":      "#! search\n# title: Old search title\n",
+	})
+	defer os.RemoveAll(dir)
+
+	client := &fakeRerunClient{
+		results: map[int]string{100: "failed"},
+		reports: map[int]string{100: junitReportXML(100, []string{"Login"}, []string{"Checkout", "Search", "Signup"})},
+	}
+	client.runTests = map[int][]rainforest.RunTest{100: {
+		{ID: 1, Title: "Login", Result: "passed"},
+		{ID: 2, Title: "Checkout", Result: "failed"},
+		{ID: 3, Title: "Checkout", Result: "failed"},
+		{ID: 4, Title: "Search", Result: "failed"},
+		{ID: 5, Title: "Signup", Result: "failed"},
+	}}
+	client.createdTests = []*rainforest.RFTest{{TestID: 2, RFMLID: "checkout"}, {TestID: 3, RFMLID: "checkout-eu"}, {TestID: 4, RFMLID: "search"}}
+	r := newRunner()
+	r.client = client
+	c := newFakeContext(map[string]interface{}{"test-folder": dir, "annotations": "github"}, cli.Args{})
+	err := r.monitorRunStatus(c, 100)
+	if err == nil {
+		t.Fatal("Expected the run to fail")
+	}
+
+	want := []string{
+		"::error file=" + filepath.Join(dir, "checkout.rfml") + ",title=Rainforest test failed::Checkout failed in run 100: Step 2 failed",
+		"::error file=" + filepath.Join(dir, "checkout_eu.rfml") + ",title=Rainforest test failed::Checkout failed in run 100: Step 2 failed",
+		"::error file=" + filepath.Join(dir, "search.rfml") + ",title=Rainforest test failed::Search failed in run 100: Step 2 failed",
+		"::error title=Rainforest test failed::Signup failed in run 100: Step 2 failed",
+	}
+	if got := strings.Split(strings.TrimSpace(out.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected annotations %q, want %q", got, want)
+	}
+}
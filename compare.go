@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// compareAPI fetches the per-test results of runs
+type compareAPI interface {
+	GetRunTests(int) ([]rainforest.RunTest, error)
+}
+
+// testChange is the difference in a test between two runs. The results are
+// empty if the test isn't part of the run.
+type testChange struct {
+	ID        int     `json:"id"`
+	Title     string  `json:"title"`
+	ResultA   string  `json:"result_a,omitempty"`
+	ResultB   string  `json:"result_b,omitempty"`
+	DurationA float64 `json:"duration_a,omitempty"`
+	DurationB float64 `json:"duration_b,omitempty"`
+}
+
+// durationChange returns the relative change of the duration, e.g. 0.5 if
+// the test took 50% longer in run B
+func (t testChange) durationChange() float64 {
+	if t.DurationA == 0 {
+		return 0
+	}
+	return (t.DurationB - t.DurationA) / t.DurationA
+}
+
+// runComparison lines up the results of run B against run A
+type runComparison struct {
+	RunA            int          `json:"run_a"`
+	RunB            int          `json:"run_b"`
+	NewFailures     []testChange `json:"new_failures"`
+	Fixed           []testChange `json:"fixed"`
+	Added           []testChange `json:"added"`
+	Removed         []testChange `json:"removed"`
+	DurationChanges []testChange `json:"duration_changes"`
+}
+
+// minDurationChange is the smallest change in seconds reported as a
+// duration change, whatever the threshold
+const minDurationChange = 5
+
+// compareRunTests compares the results of the tests of two runs, by test ID.
+// Duration changes are reported when they're over threshold, relative to
+// the duration in run A.
+func compareRunTests(runA, runB int, testsA, testsB []rainforest.RunTest, threshold float64) *runComparison {
+	comparison := &runComparison{
+		RunA:            runA,
+		RunB:            runB,
+		NewFailures:     []testChange{},
+		Fixed:           []testChange{},
+		Added:           []testChange{},
+		Removed:         []testChange{},
+		DurationChanges: []testChange{},
+	}
+
+	byID := map[int]rainforest.RunTest{}
+	for _, test := range testsA {
+		byID[test.ID] = test
+	}
+	inB := map[int]bool{}
+	for _, b := range testsB {
+		inB[b.ID] = true
+		a, ok := byID[b.ID]
+		change := testChange{ID: b.ID, Title: b.Title, ResultB: b.Result, DurationB: b.Duration}
+		if !ok {
+			comparison.Added = append(comparison.Added, change)
+			continue
+		}
+		change.ResultA = a.Result
+		change.DurationA = a.Duration
+
+		switch {
+		case a.Result != "failed" && b.Result == "failed":
+			comparison.NewFailures = append(comparison.NewFailures, change)
+		case a.Result == "failed" && b.Result == "passed":
+			comparison.Fixed = append(comparison.Fixed, change)
+		}
+		if a.Result == "passed" && b.Result == "passed" &&
+			math.Abs(change.DurationB-change.DurationA) >= minDurationChange &&
+			math.Abs(change.durationChange()) >= threshold {
+			comparison.DurationChanges = append(comparison.DurationChanges, change)
+		}
+	}
+	for _, a := range testsA {
+		if !inB[a.ID] {
+			comparison.Removed = append(comparison.Removed, testChange{ID: a.ID, Title: a.Title, ResultA: a.Result, DurationA: a.Duration})
+		}
+	}
+
+	sort.SliceStable(comparison.DurationChanges, func(i, j int) bool {
+		return math.Abs(comparison.DurationChanges[i].durationChange()) > math.Abs(comparison.DurationChanges[j].durationChange())
+	})
+	return comparison
+}
+
+// compareRuns prints what changed between the runs given as arguments
+func compareRuns(c cliContext, api compareAPI) error {
+	format := c.String("format")
+	if format != "table" && format != "markdown" && format != "json" {
+		return cli.NewExitError(fmt.Sprintf("Invalid format %v, use table, markdown or json", format), 1)
+	}
+	if len(c.Args()) != 2 {
+		return cli.NewExitError("Specify the IDs of the two runs to compare.", 1)
+	}
+	var runIDs [2]int
+	for i, arg := range c.Args() {
+		runID, err := strconv.Atoi(arg)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid run ID %v", arg), 1)
+		}
+		runIDs[i] = runID
+	}
+
+	testsA, err := api.GetRunTests(runIDs[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	testsB, err := api.GetRunTests(runIDs[1])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	threshold := float64(c.Int("duration-threshold")) / 100
+	comparison := compareRunTests(runIDs[0], runIDs[1], testsA, testsB, threshold)
+
+	switch format {
+	case "table":
+		printComparisonTable(comparison)
+	case "markdown":
+		printComparisonMarkdown(comparison)
+	case "json":
+		encoder := json.NewEncoder(resultsOut)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(comparison)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	return nil
+}
+
+// comparisonSection is a group of changes of the comparison
+type comparisonSection struct {
+	title   string
+	change  string
+	changes []testChange
+}
+
+func (r *runComparison) sections() []comparisonSection {
+	return []comparisonSection{
+		{"New failures", "new failure", r.NewFailures},
+		{"Fixed", "fixed", r.Fixed},
+		{"Added", "added", r.Added},
+		{"Removed", "removed", r.Removed},
+		{"Duration changes", "duration", r.DurationChanges},
+	}
+}
+
+func (r *runComparison) summary() string {
+	return fmt.Sprintf("%v new failure(s), %v fixed, %v added, %v removed and %v duration change(s)",
+		len(r.NewFailures), len(r.Fixed), len(r.Added), len(r.Removed), len(r.DurationChanges))
+}
+
+// formatDuration formats a duration in seconds, or returns an empty string if
+// the test isn't part of the run
+func formatDuration(seconds float64, result string) string {
+	if result == "" {
+		return ""
+	}
+	return fmt.Sprintf("%.0fs", seconds)
+}
+
+// formatDurationChange formats the relative duration change, e.g. +50%
+func formatDurationChange(t testChange) string {
+	return fmt.Sprintf("%+.0f%%", t.durationChange()*100)
+}
+
+func printComparisonTable(r *runComparison) {
+	var rows [][]string
+	for _, section := range r.sections() {
+		for _, t := range section.changes {
+			change := section.change
+			if section.change == "duration" {
+				change = formatDurationChange(t)
+			}
+			rows = append(rows, []string{strconv.Itoa(t.ID), t.Title, change, t.ResultA, t.ResultB,
+				formatDuration(t.DurationA, t.ResultA), formatDuration(t.DurationB, t.ResultB)})
+		}
+	}
+	fmt.Fprintf(resultsOut, "Run %v compared to run %v: %v\n", r.RunB, r.RunA, r.summary())
+	if len(rows) > 0 {
+		headers := []string{"Test ID", "Test", "Change", fmt.Sprintf("Run %v", r.RunA), fmt.Sprintf("Run %v", r.RunB),
+			fmt.Sprintf("Duration %v", r.RunA), fmt.Sprintf("Duration %v", r.RunB)}
+		printResourceTable(headers, rows)
+	}
+}
+
+func printComparisonMarkdown(r *runComparison) {
+	escape := strings.NewReplacer("|", "\\|", "\n", " ")
+	fmt.Fprintf(resultsOut, "## Run %v compared to run %v\n\n", r.RunB, r.RunA)
+	fmt.Fprintf(resultsOut, "%v.\n", r.summary())
+	for _, section := range r.sections() {
+		if len(section.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(resultsOut, "\n### %v\n\n", section.title)
+		if section.change == "duration" {
+			fmt.Fprintf(resultsOut, "| Test ID | Test | Run %v | Run %v | Change |\n", r.RunA, r.RunB)
+			fmt.Fprintln(resultsOut, "| --- | --- | --- | --- | --- |")
+			for _, t := range section.changes {
+				fmt.Fprintf(resultsOut, "| %v | %v | %v | %v | %v |\n", t.ID, escape.Replace(t.Title),
+					formatDuration(t.DurationA, t.ResultA), formatDuration(t.DurationB, t.ResultB), formatDurationChange(t))
+			}
+			continue
+		}
+		fmt.Fprintf(resultsOut, "| Test ID | Test | Run %v | Run %v |\n", r.RunA, r.RunB)
+		fmt.Fprintln(resultsOut, "| --- | --- | --- | --- |")
+		for _, t := range section.changes {
+			fmt.Fprintf(resultsOut, "| %v | %v | %v | %v |\n", t.ID, escape.Replace(t.Title), t.ResultA, t.ResultB)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeCompareAPI struct {
+	tests map[int][]rainforest.RunTest
+}
+
+func (f fakeCompareAPI) GetRunTests(runID int) ([]rainforest.RunTest, error) {
+	return f.tests[runID], nil
+}
+
+var compareTestRuns = fakeCompareAPI{tests: map[int][]rainforest.RunTest{
+	10: {
+		{ID: 1, Title: "Login", Result: "passed", Duration: 60},
+		{ID: 2, Title: "Checkout", Result: "passed", Duration: 100},
+		{ID: 3, Title: "Search | filters", Result: "failed", Duration: 30},
+		{ID: 4, Title: "Signup", Result: "passed", Duration: 40},
+		{ID: 6, Title: "Logout", Result: "passed", Duration: 10},
+	},
+	11: {
+		{ID: 1, Title: "Login", Result: "passed", Duration: 90},
+		{ID: 2, Title: "Checkout", Result: "failed", Duration: 50},
+		{ID: 3, Title: "Search | filters", Result: "passed", Duration: 31},
+		{ID: 5, Title: "Profile", Result: "passed", Duration: 20},
+		{ID: 6, Title: "Logout", Result: "passed", Duration: 14},
+	},
+}}
+
+func TestCompareRunTests(t *testing.T) {
+	got := compareRunTests(10, 11, compareTestRuns.tests[10], compareTestRuns.tests[11], 0.25)
+	want := &runComparison{
+		RunA:        10,
+		RunB:        11,
+		NewFailures: []testChange{{ID: 2, Title: "Checkout", ResultA: "passed", ResultB: "failed", DurationA: 100, DurationB: 50}},
+		Fixed:       []testChange{{ID: 3, Title: "Search | filters", ResultA: "failed", ResultB: "passed", DurationA: 30, DurationB: 31}},
+		Added:       []testChange{{ID: 5, Title: "Profile", ResultB: "passed", DurationB: 20}},
+		Removed:     []testChange{{ID: 4, Title: "Signup", ResultA: "passed", DurationA: 40}},
+		// Logout is 40% slower but only by 4 seconds
+		DurationChanges: []testChange{{ID: 1, Title: "Login", ResultA: "passed", ResultB: "passed", DurationA: 60, DurationB: 90}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareRunTests returned %+v, want %+v", got, want)
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	defer func(w io.Writer) { resultsOut = w }(resultsOut)
+
+	out := &bytes.Buffer{}
+	tablesOut = out
+	resultsOut = out
+	c := newFakeContext(map[string]interface{}{"format": "markdown", "duration-threshold": 25}, cli.Args{"10", "11"})
+	err := compareRuns(c, compareTestRuns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"## Run 11 compared to run 10\n\n1 new failure(s), 1 fixed, 1 added, 1 removed and 1 duration change(s).\n",
+		"### New failures\n\n| Test ID | Test | Run 10 | Run 11 |\n| --- | --- | --- | --- |\n| 2 | Checkout | passed | failed |\n",
+		"| 3 | Search \\| filters | failed | passed |",
+		"| 5 | Profile |  | passed |",
+		"| 1 | Login | 60s | 90s | +50% |",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%v", want, out.String())
+		}
+	}
+
+	out.Reset()
+	c = newFakeContext(map[string]interface{}{"format": "table", "duration-threshold": 25}, cli.Args{"10", "11"})
+	err = compareRuns(c, compareTestRuns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"new failure", "fixed", "added", "removed", "+50%"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the table:\n%v", want, out.String())
+		}
+	}
+
+	out.Reset()
+	c = newFakeContext(map[string]interface{}{"format": "json", "duration-threshold": 100}, cli.Args{"10", "11"})
+	err = compareRuns(c, compareTestRuns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var comparison runComparison
+	err = json.Unmarshal(out.Bytes(), &comparison)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison.RunB != 11 || len(comparison.NewFailures) != 1 || len(comparison.DurationChanges) != 0 {
+		t.Errorf("Unexpected JSON output:\n%v", out.String())
+	}
+
+	for _, args := range []cli.Args{{"10"}, {"10", "abc"}} {
+		c = newFakeContext(map[string]interface{}{"format": "table"}, args)
+		if err = compareRuns(c, compareTestRuns); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// defaultConfigPath is where the config file is looked up when --config is
+// not given. It's fine for it to be missing.
+const defaultConfigPath = ".rainforest.json"
+
+// config holds the settings from the JSON config file
+type config struct {
+	GitTrigger   gitTriggerConfig   `json:"git_trigger"`
+	AutoMetadata autoMetadataConfig `json:"auto_metadata"`
+	// Matrix lists the legs of run --matrix
+	Matrix []matrixLeg `json:"matrix"`
+}
+
+// autoMetadataConfig holds the templates used by run --auto-metadata, e.g.
+// "{{.Branch}} @ {{.ShortSHA}}". The fields of runMetadata are available.
+type autoMetadataConfig struct {
+	Release     string `json:"release"`
+	Description string `json:"description"`
+}
+
+// gitTriggerConfig configures run --git-trigger
+type gitTriggerConfig struct {
+	Branches []branchRule `json:"branches"`
+}
+
+// branchRule configures the git trigger for the branches matching Branch
+type branchRule struct {
+	// Branch is a glob pattern, e.g. "release/*"
+	Branch string `json:"branch"`
+	// Skip never triggers runs for the branch
+	Skip bool `json:"skip"`
+	// AlwaysRun triggers runs even when no commit asks for one
+	AlwaysRun     bool     `json:"always_run"`
+	Tags          []string `json:"tags"`
+	Browsers      []string `json:"browsers"`
+	EnvironmentID int      `json:"environment_id"`
+}
+
+// loadConfig reads the config file given with --config, or the default one
+// if it exists.
+func loadConfig(c cliContext) (*config, error) {
+	configPath := c.GlobalString("config")
+	if configPath == "" {
+		configPath = defaultConfigPath
+	}
+
+	cfg := &config{}
+	f, err := os.Open(configPath)
+	if os.IsNotExist(err) && configPath == defaultConfigPath {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config file %v: %v", configPath, err)
+	}
+
+	for _, rule := range cfg.GitTrigger.Branches {
+		if _, err = path.Match(rule.Branch, ""); err != nil {
+			return nil, fmt.Errorf("Invalid branch pattern %v in %v: %v", rule.Branch, configPath, err)
+		}
+	}
+
+	for _, tmpl := range []string{cfg.AutoMetadata.Release, cfg.AutoMetadata.Description} {
+		if _, err = renderMetadata(tmpl, runMetadata{}); err != nil {
+			return nil, fmt.Errorf("Invalid auto_metadata template in %v: %v", configPath, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// ruleFor returns the first branch rule matching branch, or nil.
+func (g gitTriggerConfig) ruleFor(branch string) *branchRule {
+	if branch == "" {
+		return nil
+	}
+	for i, rule := range g.Branches {
+		if ok, _ := path.Match(rule.Branch, branch); ok {
+			return &g.Branches[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	dir, err := ioutil.TempDir("", "rainforest-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(path, []byte(contents), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"git_trigger": {
+			"branches": [
+				{"branch": "docs/*", "skip": true},
+				{"branch": "master", "always_run": true, "tags": ["smoke"], "browsers": ["chrome"], "environment_id": 12}
+			]
+		}
+	}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	cfg, err := loadConfig(newFakeContext(map[string]interface{}{"config": path}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		branch string
+		want   *branchRule
+	}{
+		{"docs/readme", &branchRule{Branch: "docs/*", Skip: true}},
+		{"docs/a/b", nil},
+		{"master", &branchRule{Branch: "master", AlwaysRun: true, Tags: []string{"smoke"}, Browsers: []string{"chrome"}, EnvironmentID: 12}},
+		{"feature", nil},
+		{"", nil},
+	}
+	for _, tc := range testCases {
+		if got := cfg.GitTrigger.ruleFor(tc.branch); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ruleFor(%v) returned %+v, want %+v", tc.branch, got, tc.want)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	// A missing default config file is fine
+	cfg, err := loadConfig(newFakeContext(map[string]interface{}{}, cli.Args{}))
+	if err != nil || !reflect.DeepEqual(cfg, &config{}) {
+		t.Errorf("Expected an empty config, got %+v, %v", cfg, err)
+	}
+
+	_, err = loadConfig(newFakeContext(map[string]interface{}{"config": "/does/not/exist.json"}, cli.Args{}))
+	if err == nil {
+		t.Error("Expected an error for a missing config file")
+	}
+
+	for _, contents := range []string{
+		`{"git_trigger": {"branches": [{"brunch": "master"}]}}`,
+		`{"git_trigger": {"branches": [{"branch": "[master"}]}}`,
+		`{`,
+	} {
+		path := writeConfigFile(t, contents)
+		defer os.RemoveAll(filepath.Dir(path))
+		_, err = loadConfig(newFakeContext(map[string]interface{}{"config": path}, cli.Args{}))
+		if err == nil {
+			t.Errorf("Expected an error for config %v", contents)
+		}
+	}
+}
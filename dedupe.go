@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// stepLocation is the position of a step sequence in a test
+type stepLocation struct {
+	test  *rainforest.RFTest
+	start int
+}
+
+// duplicateSequence is a sequence of steps repeated across the suite
+type duplicateSequence struct {
+	steps     []interface{}
+	locations []stepLocation
+}
+
+// stepToken returns a comparable representation of a step. Only plain steps
+// are considered, embedded tests break up sequences. The redirect of the
+// first step of a sequence is kept on the embed after extracting, so it's
+// only part of the token for the following steps.
+func stepToken(step interface{}, withRedirect bool) (string, bool) {
+	s, ok := step.(rainforest.RFTestStep)
+	if !ok {
+		return "", false
+	}
+	token := s.Action + "\x00" + s.Response
+	if withRedirect {
+		token += "\x00" + strconv.FormatBool(s.Redirect)
+	}
+	return token, true
+}
+
+// sequenceKey returns the key of the length steps starting at start, or
+// false if they are not all plain steps.
+func sequenceKey(steps []interface{}, start, length int) (string, bool) {
+	tokens := make([]string, length)
+	for i := range tokens {
+		token, ok := stepToken(steps[start+i], i > 0)
+		if !ok {
+			return "", false
+		}
+		tokens[i] = token
+	}
+	return strings.Join(tokens, "\x01"), true
+}
+
+// findDuplicateSequences finds sequences of at least minLength plain steps
+// that occur at least minOccurrences times across the tests. Sequences are
+// extended as long as all of their occurrences keep matching, and sequences
+// fully contained in longer reported ones are left out.
+func findDuplicateSequences(tests []*rainforest.RFTest, minLength, minOccurrences int) []duplicateSequence {
+	tests = append([]*rainforest.RFTest{}, tests...)
+	sort.Slice(tests, func(i, j int) bool { return tests[i].RFMLPath < tests[j].RFMLPath })
+
+	var keys []string
+	windows := map[string][]stepLocation{}
+	for _, test := range tests {
+		for start := 0; start+minLength <= len(test.Steps); start++ {
+			key, ok := sequenceKey(test.Steps, start, minLength)
+			if !ok {
+				continue
+			}
+			if _, ok = windows[key]; !ok {
+				keys = append(keys, key)
+			}
+			windows[key] = append(windows[key], stepLocation{test, start})
+		}
+	}
+
+	var candidates []duplicateSequence
+	for _, key := range keys {
+		// Drop occurrences overlapping with the previous one in the same test
+		var locations []stepLocation
+		for _, loc := range windows[key] {
+			if n := len(locations); n > 0 && locations[n-1].test == loc.test && loc.start < locations[n-1].start+minLength {
+				continue
+			}
+			locations = append(locations, loc)
+		}
+		if len(locations) < minOccurrences {
+			continue
+		}
+
+		length := minLength
+		for canExtendSequence(locations, length) {
+			length++
+		}
+
+		first := locations[0]
+		candidates = append(candidates, duplicateSequence{
+			steps:     first.test.Steps[first.start : first.start+length],
+			locations: locations,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if len(candidates[i].steps) != len(candidates[j].steps) {
+			return len(candidates[i].steps) > len(candidates[j].steps)
+		}
+		return len(candidates[i].locations) > len(candidates[j].locations)
+	})
+
+	var result []duplicateSequence
+	covered := map[*rainforest.RFTest][]bool{}
+	for _, candidate := range candidates {
+		length := len(candidate.steps)
+		isCovered := true
+		for _, loc := range candidate.locations {
+			for i := loc.start; i < loc.start+length; i++ {
+				if c := covered[loc.test]; c == nil || !c[i] {
+					isCovered = false
+				}
+			}
+		}
+		if isCovered {
+			continue
+		}
+
+		for _, loc := range candidate.locations {
+			if covered[loc.test] == nil {
+				covered[loc.test] = make([]bool, len(loc.test.Steps))
+			}
+			for i := loc.start; i < loc.start+length; i++ {
+				covered[loc.test][i] = true
+			}
+		}
+		result = append(result, candidate)
+	}
+
+	return result
+}
+
+// canExtendSequence returns true if every occurrence is followed by the same
+// plain step without running into the next occurrence.
+func canExtendSequence(locations []stepLocation, length int) bool {
+	var want string
+	for i, loc := range locations {
+		end := loc.start + length
+		if end >= len(loc.test.Steps) {
+			return false
+		}
+		if i+1 < len(locations) && locations[i+1].test == loc.test && locations[i+1].start <= end {
+			return false
+		}
+		token, ok := stepToken(loc.test.Steps[end], true)
+		if !ok || (i > 0 && token != want) {
+			return false
+		}
+		want = token
+	}
+	return true
+}
+
+// suggestedRFMLID returns an unused RFML ID for an extracted sequence based on
+// its first action. IDs whose file already exists next to the first
+// occurrence are skipped too, as that's where the test is extracted to.
+func suggestedRFMLID(seq duplicateSequence, used map[string]bool) string {
+	base := sanitizeTestTitle(seq.steps[0].(rainforest.RFTestStep).Action)
+	base = strings.Trim(base, "_")
+	if base == "" {
+		base = "shared_steps"
+	}
+
+	var dir string
+	if len(seq.locations) > 0 {
+		dir = filepath.Dir(seq.locations[0].test.RFMLPath)
+	}
+	taken := func(id string) bool {
+		if used[id] {
+			return true
+		}
+		if dir == "" {
+			return false
+		}
+		_, err := os.Stat(filepath.Join(dir, id+".rfml"))
+		return !os.IsNotExist(err)
+	}
+
+	id := base
+	for i := 2; taken(id); i++ {
+		id = base + "_" + strconv.Itoa(i)
+	}
+	used[id] = true
+	return id
+}
+
+// duplicateOccurrence is the JSON representation of a sequence location
+type duplicateOccurrence struct {
+	Path      string `json:"path"`
+	RFMLID    string `json:"rfml_id"`
+	FirstStep int    `json:"first_step"`
+	LastStep  int    `json:"last_step"`
+}
+
+// duplicateResult is the JSON representation of a duplicate sequence
+type duplicateResult struct {
+	Steps            int                   `json:"steps"`
+	FirstAction      string                `json:"first_action"`
+	Occurrences      []duplicateOccurrence `json:"occurrences"`
+	SuggestedRFMLID  string                `json:"suggested_rfml_id"`
+	SuggestedCommand string                `json:"suggested_command"`
+}
+
+// newDuplicateResults describes the duplicates and suggests an unused RFML ID
+// for extracting each of them.
+func newDuplicateResults(duplicates []duplicateSequence, suite []*rainforest.RFTest) []duplicateResult {
+	used := map[string]bool{}
+	for _, test := range suite {
+		used[test.RFMLID] = true
+	}
+
+	results := make([]duplicateResult, len(duplicates))
+	for i, dup := range duplicates {
+		length := len(dup.steps)
+		occurrences := make([]duplicateOccurrence, len(dup.locations))
+		for j, loc := range dup.locations {
+			occurrences[j] = duplicateOccurrence{
+				Path:      loc.test.RFMLPath,
+				RFMLID:    loc.test.RFMLID,
+				FirstStep: loc.start + 1,
+				LastStep:  loc.start + length,
+			}
+		}
+
+		rfmlID := suggestedRFMLID(dup, used)
+		first := occurrences[0]
+		results[i] = duplicateResult{
+			Steps:           length,
+			FirstAction:     dup.steps[0].(rainforest.RFTestStep).Action,
+			Occurrences:     occurrences,
+			SuggestedRFMLID: rfmlID,
+			SuggestedCommand: fmt.Sprintf("rainforest extract %v --steps %v-%v --rfml-id %v",
+				first.Path, first.FirstStep, first.LastStep, rfmlID),
+		}
+	}
+	return results
+}
+
+// extractDuplicates extracts each duplicate sequence into its own test. The
+// suite is re-read after each extraction as steps and files move around.
+func extractDuplicates(files []string, duplicates []duplicateSequence, results []duplicateResult, dryRun bool) error {
+	for i, dup := range duplicates {
+		suite, err := readRFMLFiles(files)
+		if err != nil {
+			return err
+		}
+
+		result := results[i]
+		source := dup.locations[0].test
+		newTest := newEmbeddableTest(result.SuggestedRFMLID, result.FirstAction, source, dup.steps)
+		outputPath := filepath.Join(filepath.Dir(source.RFMLPath), result.SuggestedRFMLID+".rfml")
+		if _, err = os.Stat(outputPath); err == nil {
+			return fmt.Errorf("%v already exists", outputPath)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		changed, err := extractStepSequence(suite, dup.steps, newTest, outputPath, dryRun)
+		if err == errStepsNotFound {
+			// An earlier extraction already replaced these steps
+			log.Printf("Skipping %v, its steps were already extracted", result.SuggestedRFMLID)
+			continue
+		} else if err != nil {
+			return err
+		}
+		log.Printf("Extracted %v to %v, %v test(s) now embed it", result.SuggestedRFMLID, outputPath, changed)
+	}
+	return nil
+}
+
+// dedupeRFML reports repeated step sequences in the local suite and
+// optionally extracts them into embedded tests.
+func dedupeRFML(c cliContext) error {
+	format := c.String("format")
+	switch format {
+	case "":
+		format = "table"
+	case "table", "json":
+	default:
+		return cli.NewExitError("Invalid format specified, use one of table or json", 1)
+	}
+
+	minLength := c.Int("min-length")
+	if minLength == 0 {
+		minLength = 3
+	}
+	minOccurrences := c.Int("min-occurrences")
+	if minOccurrences == 0 {
+		minOccurrences = 2
+	}
+	if minLength < 2 || minOccurrences < 2 {
+		return cli.NewExitError("Minimum length and occurrences must be at least 2", 1)
+	}
+
+	files := []string(c.Args())
+	if len(files) == 0 {
+		files = []string{c.String("test-folder")}
+	}
+	suite, err := readRFMLFiles(files)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	duplicates := findDuplicateSequences(suite, minLength, minOccurrences)
+	results := newDuplicateResults(duplicates, suite)
+
+	switch format {
+	case "table":
+		rows := make([][]string, len(results))
+		for i, result := range results {
+			locations := make([]string, len(result.Occurrences))
+			for j, occ := range result.Occurrences {
+				locations[j] = fmt.Sprintf("%v:%v-%v", occ.Path, occ.FirstStep, occ.LastStep)
+			}
+			rows[i] = []string{
+				strconv.Itoa(result.Steps),
+				strconv.Itoa(len(result.Occurrences)),
+				result.FirstAction,
+				strings.Join(locations, ", "),
+				result.SuggestedRFMLID,
+			}
+		}
+		printResourceTable([]string{"Steps", "Occurrences", "First Action", "Locations", "Suggested RFML ID"}, rows)
+		if !c.Bool("extract") {
+			for _, result := range results {
+				fmt.Fprintln(resultsOut, result.SuggestedCommand)
+			}
+		}
+	case "json":
+		encoder := json.NewEncoder(resultsOut)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(results)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	if c.Bool("extract") {
+		err = extractDuplicates(files, duplicates, results, c.Bool("dry-run"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	return nil
+}
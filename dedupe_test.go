@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func dedupeTestStep(name string) rainforest.RFTestStep {
+	return rainforest.RFTestStep{Action: "Do " + name, Response: "Did " + name + "?", Redirect: true}
+}
+
+func TestFindDuplicateSequences(t *testing.T) {
+	a, b, c, d, x, y := dedupeTestStep("a"), dedupeTestStep("b"), dedupeTestStep("c"),
+		dedupeTestStep("d"), dedupeTestStep("x"), dedupeTestStep("y")
+	firstNoRedirect := a
+	firstNoRedirect.Redirect = false
+	interiorNoRedirect := b
+	interiorNoRedirect.Redirect = false
+
+	t1 := &rainforest.RFTest{RFMLID: "t1", RFMLPath: "t1.rfml", Steps: []interface{}{x, a, b, c, d, y}}
+	t2 := &rainforest.RFTest{RFMLID: "t2", RFMLPath: "t2.rfml", Steps: []interface{}{firstNoRedirect, b, c, d}}
+	// Redirect differences inside the sequence and embeds break it up
+	t3 := &rainforest.RFTest{RFMLID: "t3", RFMLPath: "t3.rfml", Steps: []interface{}{a, interiorNoRedirect, c, d}}
+	t4 := &rainforest.RFTest{RFMLID: "t4", RFMLPath: "t4.rfml", Steps: []interface{}{
+		a, b, rainforest.RFEmbeddedTest{RFMLID: "t1"}, c, d, y,
+	}}
+
+	// describe returns the duplicates as "length: test@step, ..." strings
+	describe := func(dups []duplicateSequence) []string {
+		var result []string
+		for _, dup := range dups {
+			var locations []string
+			for _, loc := range dup.locations {
+				locations = append(locations, fmt.Sprintf("%v@%v", loc.test.RFMLID, loc.start))
+			}
+			result = append(result, fmt.Sprintf("%v: %v", len(dup.steps), strings.Join(locations, ", ")))
+		}
+		return result
+	}
+
+	dups := findDuplicateSequences([]*rainforest.RFTest{t4, t3, t2, t1}, 3, 2)
+	want := []string{
+		// a, b, c, d only differs in the redirect of the first step
+		"4: t1@1, t2@0",
+		// t3 has a different redirect on b, but it starts the sequence
+		"3: t1@2, t2@1, t3@1",
+		"3: t1@3, t4@3",
+	}
+	if got := describe(dups); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected duplicates %v, want %v", got, want)
+	}
+	if steps := []interface{}{a, b, c, d}; !reflect.DeepEqual(dups[0].steps, steps) {
+		t.Errorf("Unexpected duplicate steps %v, want %v", dups[0].steps, steps)
+	}
+
+	// Sequences found fewer times are left out
+	dups = findDuplicateSequences([]*rainforest.RFTest{t4, t3, t2, t1}, 2, 4)
+	if got, want := describe(dups), []string{"2: t1@3, t2@2, t3@2, t4@3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected duplicates %v, want %v", got, want)
+	}
+
+	// Repeats within a test don't overlap
+	t5 := &rainforest.RFTest{RFMLID: "t5", RFMLPath: "t5.rfml", Steps: []interface{}{a, a, a, a, a}}
+	dups = findDuplicateSequences([]*rainforest.RFTest{t5}, 2, 2)
+	if len(dups) != 1 || len(dups[0].steps) != 2 || !reflect.DeepEqual(dups[0].locations, []stepLocation{{t5, 0}, {t5, 2}}) {
+		t.Errorf("Unexpected duplicates within a test %+v", dups)
+	}
+}
+
+func TestSuggestedRFMLID(t *testing.T) {
+	seq := duplicateSequence{steps: []interface{}{
+		rainforest.RFTestStep{Action: "Log in as admin!", Response: "OK?"},
+	}}
+	used := map[string]bool{"log_in_as_admin": true}
+
+	if got := suggestedRFMLID(seq, used); got != "log_in_as_admin_2" {
+		t.Errorf("Unexpected suggestion %v", got)
+	}
+	if got := suggestedRFMLID(seq, used); got != "log_in_as_admin_3" {
+		t.Errorf("Unexpected suggestion %v", got)
+	}
+
+	// Files without a matching RFML ID are not overwritten either
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+	err := ioutil.WriteFile(filepath.Join(dir, "log_in_as_admin_4.rfml"), []byte("# hand written\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq.locations = []stepLocation{{test: &rainforest.RFTest{RFMLPath: filepath.Join(dir, "a.rfml")}}}
+	if got := suggestedRFMLID(seq, used); got != "log_in_as_admin_5" {
+		t.Errorf("Unexpected suggestion %v", got)
+	}
+}
+
+func TestDedupeRFML(t *testing.T) {
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+
+	resultsOut = &bytes.Buffer{}
+	tablesOut = &bytes.Buffer{}
+	defer func() {
+		resultsOut = os.Stdout
+		tablesOut = os.Stdout
+	}()
+
+	login, menu, logout := dedupeTestStep("login"), dedupeTestStep("menu"), dedupeTestStep("logout")
+	writeRFMLFile(t, filepath.Join(dir, "a/a2.rfml"), &rainforest.RFTest{RFMLID: "a2", Title: "a2", Execute: true,
+		Steps: []interface{}{login, menu, logout}})
+	writeRFMLFile(t, filepath.Join(dir, "b/b1.rfml"), &rainforest.RFTest{RFMLID: "b1", Title: "b1", Execute: true,
+		Steps: []interface{}{dedupeTestStep("other"), login, menu, logout}})
+
+	err := dedupeRFML(newFakeContext(map[string]interface{}{"format": "json"}, cli.Args{dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []duplicateResult
+	err = json.Unmarshal(resultsOut.(*bytes.Buffer).Bytes(), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Steps != 3 || results[0].SuggestedRFMLID != "do_login" ||
+		len(results[0].Occurrences) != 2 || results[0].Occurrences[1].FirstStep != 2 {
+		t.Fatalf("Unexpected results %+v", results)
+	}
+
+	resultsOut.(*bytes.Buffer).Reset()
+	err = dedupeRFML(newFakeContext(map[string]interface{}{"test-folder": dir}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resultsOut.(*bytes.Buffer).String(), "--steps 1-3 --rfml-id do_login") {
+		t.Errorf("Expected an extract suggestion, got %v", resultsOut)
+	}
+
+	err = dedupeRFML(newFakeContext(map[string]interface{}{"test-folder": dir, "extract": true}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extracted, err := readRFMLFile(filepath.Join(dir, "a/do_login.rfml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extracted.Execute || len(extracted.Steps) != 3 {
+		t.Errorf("Unexpected extracted test %+v", extracted)
+	}
+	b1, err := readRFMLFile(filepath.Join(dir, "b/b1.rfml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{dedupeTestStep("other"), rainforest.RFEmbeddedTest{RFMLID: "do_login", Redirect: true}}
+	if !reflect.DeepEqual(b1.Steps, want) {
+		t.Errorf("Unexpected b1 steps %v, want %v", b1.Steps, want)
+	}
+
+	// An existing file at the output path is never written over
+	duplicates := []duplicateSequence{{steps: []interface{}{login, menu}, locations: []stepLocation{{test: b1}}}}
+	results = []duplicateResult{{SuggestedRFMLID: "b1", FirstAction: login.Action}}
+	err = extractDuplicates([]string{dir}, duplicates, results, false)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected an error for the existing file, got %v", err)
+	}
+
+	if err = dedupeRFML(newFakeContext(map[string]interface{}{"min-length": 1}, cli.Args{dir})); err == nil {
+		t.Error("Expected an error for a minimum length of 1")
+	}
+}
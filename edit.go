@@ -0,0 +1,410 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// rfmlSelector picks local tests based on their metadata and location.
+// An empty selector matches every test.
+type rfmlSelector struct {
+	tags      []string
+	pathGlobs []string
+	featureID int
+	title     *regexp.Regexp
+}
+
+// newRFMLSelector builds a selector from the --tag, --path, --feature-id
+// and --title flags.
+func newRFMLSelector(c cliContext) (*rfmlSelector, error) {
+	s := &rfmlSelector{
+		tags:      getTags(c),
+		pathGlobs: c.StringSlice("path"),
+		featureID: c.Int("feature-id"),
+	}
+
+	for _, glob := range s.pathGlobs {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("Invalid path pattern %v: %v", glob, err)
+		}
+	}
+
+	if title := c.String("title"); title != "" {
+		var err error
+		s.title, err = regexp.Compile(title)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid title pattern %v: %v", title, err)
+		}
+	}
+
+	return s, nil
+}
+
+// matches returns true if the test satisfies all of the selector's criteria.
+func (s *rfmlSelector) matches(test *rainforest.RFTest) bool {
+	if len(s.tags) > 0 && !anyMember(s.tags, test.Tags) {
+		return false
+	}
+
+	if len(s.pathGlobs) > 0 {
+		matched := false
+		for _, glob := range s.pathGlobs {
+			// Globs may either describe the whole path or just the file name
+			if ok, _ := filepath.Match(glob, test.RFMLPath); ok {
+				matched = true
+			} else if ok, _ := filepath.Match(glob, filepath.Base(test.RFMLPath)); ok {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if s.featureID != 0 && int(test.FeatureID) != s.featureID {
+		return false
+	}
+
+	if s.title != nil && !s.title.MatchString(test.Title) {
+		return false
+	}
+
+	return true
+}
+
+// rfmlEdit describes the metadata changes to apply to each selected test.
+// Empty string fields are left untouched.
+type rfmlEdit struct {
+	addTags    []string
+	removeTags []string
+	priority   string
+	state      string
+	browsers   []string
+	featureID  string
+	execute    string
+}
+
+// newRFMLEdit builds and validates the edit from the --add-tag, --remove-tag
+// and --set-* flags.
+func newRFMLEdit(c cliContext) (*rfmlEdit, error) {
+	e := &rfmlEdit{
+		addTags:    expandStringSlice(c.StringSlice("add-tag")),
+		removeTags: expandStringSlice(c.StringSlice("remove-tag")),
+		browsers:   expandStringSlice(c.StringSlice("set-browsers")),
+	}
+
+	switch priority := strings.ToUpper(c.String("set-priority")); priority {
+	case "", "P1", "P2", "P3":
+		e.priority = priority
+	case "NONE":
+		e.priority = "none"
+	default:
+		return nil, errors.New("Priority must be one of P1, P2, P3 or none")
+	}
+
+	switch state := c.String("set-state"); state {
+	case "", "enabled", "disabled", "draft":
+		e.state = state
+	default:
+		return nil, errors.New("State must be one of enabled, disabled or draft")
+	}
+
+	if featureID := c.String("set-feature-id"); featureID != "" && featureID != "none" {
+		if _, err := strconv.Atoi(featureID); err != nil {
+			return nil, errors.New("Feature ID must be a valid integer or none")
+		}
+	}
+	e.featureID = c.String("set-feature-id")
+
+	if execute := c.String("set-execute"); execute != "" {
+		value, err := strconv.ParseBool(execute)
+		if err != nil {
+			return nil, errors.New("Execute value must be a valid boolean")
+		}
+		e.execute = strconv.FormatBool(value)
+	}
+
+	if len(e.addTags) == 0 && len(e.removeTags) == 0 && len(e.browsers) == 0 &&
+		e.priority == "" && e.state == "" && e.featureID == "" && e.execute == "" {
+		return nil, errors.New("No changes specified, use one of the --add-tag, --remove-tag or --set-* options")
+	}
+
+	return e, nil
+}
+
+// apply returns the RFML file lines of test with the edit applied.
+func (e *rfmlEdit) apply(lines []string, test *rainforest.RFTest) []string {
+	if len(e.addTags) > 0 || len(e.removeTags) > 0 {
+		tags := []string{}
+		for _, tag := range test.Tags {
+			if !anyMember(e.removeTags, []string{tag}) {
+				tags = append(tags, tag)
+			}
+		}
+		for _, tag := range e.addTags {
+			if !anyMember(tags, []string{tag}) {
+				tags = append(tags, tag)
+			}
+		}
+
+		if len(tags) > 0 {
+			lines = setRFMLHeader(lines, "tags", strings.Join(tags, ", "))
+		} else {
+			lines = removeRFMLHeader(lines, "tags")
+		}
+	}
+
+	if len(e.browsers) > 0 {
+		lines = setRFMLHeader(lines, "browsers", strings.Join(e.browsers, ", "))
+	}
+
+	if e.priority == "none" {
+		// An empty priority removes the priority when uploading
+		lines = setRFMLHeader(lines, "priority", "")
+	} else if e.priority != "" {
+		lines = setRFMLHeader(lines, "priority", e.priority)
+	}
+
+	if e.state != "" {
+		lines = setRFMLHeader(lines, "state", e.state)
+	}
+
+	if e.featureID == "none" {
+		// An empty feature ID removes the feature when uploading
+		lines = setRFMLHeader(lines, "feature_id", "")
+	} else if e.featureID != "" {
+		lines = setRFMLHeader(lines, "feature_id", e.featureID)
+	}
+
+	if e.execute != "" {
+		lines = setRFMLHeader(lines, "execute", e.execute)
+	}
+
+	return lines
+}
+
+// rfmlHeaderKey returns the metadata key of an RFML comment line, if any.
+func rfmlHeaderKey(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") || strings.HasPrefix(line, "#!") {
+		return "", false
+	}
+	content := line[1:]
+	if !strings.Contains(content, ":") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.SplitN(content, ":", 2)[0]), true
+}
+
+// setRFMLHeader replaces the value of the key metadata line or, if the file
+// doesn't have one, adds it at the end of the header.
+func setRFMLHeader(lines []string, key, value string) []string {
+	newLine := strings.TrimRight("# "+key+": "+value, " ")
+	for i, line := range lines {
+		if k, ok := rfmlHeaderKey(line); ok && k == key {
+			result := append([]string{}, lines...)
+			result[i] = newLine
+			return result
+		}
+	}
+
+	// Find the end of the header, i.e. the first line that's not a comment.
+	// Redirects belong to the first step, so we keep them after the new line.
+	insertAt := 0
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			break
+		}
+		if k, ok := rfmlHeaderKey(line); !ok || k != "redirect" {
+			insertAt = i + 1
+		}
+	}
+
+	result := make([]string, 0, len(lines)+1)
+	result = append(result, lines[:insertAt]...)
+	result = append(result, newLine)
+	return append(result, lines[insertAt:]...)
+}
+
+// removeRFMLHeader removes the key metadata line from the file.
+func removeRFMLHeader(lines []string, key string) []string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if k, ok := rfmlHeaderKey(line); ok && k == key {
+			continue
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// editRFML applies bulk metadata changes to the selected local RFML tests and
+// optionally uploads the changed tests.
+func editRFML(c cliContext, api rfmlAPI) error {
+	selector, err := newRFMLSelector(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	edit, err := newRFMLEdit(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	files := []string(c.Args())
+	if len(files) == 0 {
+		files = []string{c.String("test-folder")}
+	}
+	tests, err := readRFMLFiles(files)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	dryRun := c.Bool("dry-run")
+	var edited []*rainforest.RFTest
+	for _, test := range tests {
+		if !selector.matches(test) {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(test.RFMLPath)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		lines := strings.Split(string(contents), "\n")
+		newLines := edit.apply(lines, test)
+		if strings.Join(newLines, "\n") == string(contents) {
+			continue
+		}
+
+		if dryRun {
+			fmt.Fprint(resultsOut, unifiedDiff(test.RFMLPath, lines, newLines))
+			edited = append(edited, test)
+			continue
+		}
+
+		err = ioutil.WriteFile(test.RFMLPath, []byte(strings.Join(newLines, "\n")), 0666)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		log.Printf("Updated %v", test.RFMLPath)
+
+		// Re-read the test so that what we upload is exactly what's on disk
+		test, err = readRFMLFile(test.RFMLPath)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		edited = append(edited, test)
+	}
+
+	if dryRun {
+		log.Printf("%v test(s) would be changed", len(edited))
+		return nil
+	}
+	log.Printf("Changed %v test(s)", len(edited))
+
+	if c.Bool("push") && len(edited) > 0 {
+		err = uploadRFMLFiles(edited, false, api)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	return nil
+}
+
+// unifiedDiff returns a unified diff of two versions of the named file.
+func unifiedDiff(name string, a, b []string) string {
+	const context = 3
+
+	// Longest common subsequence table, RFML files are small enough for O(n*m)
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type diffLine struct {
+		op   byte
+		text string
+		// line numbers (0-based) in a and b at this point of the script
+		ai, bi int
+	}
+	var script []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			script = append(script, diffLine{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			script = append(script, diffLine{'-', a[i], i, j})
+			i++
+		default:
+			script = append(script, diffLine{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %v\n+++ %v\n", name, name)
+	for start := 0; start < len(script); {
+		if script[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// Extend the hunk while changes are within 2*context lines of each other
+		hunkStart := start - context
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		end := start
+		for k := start; k < len(script) && k-end <= 2*context; k++ {
+			if script[k].op != ' ' {
+				end = k
+			}
+		}
+		hunkEnd := end + context + 1
+		if hunkEnd > len(script) {
+			hunkEnd = len(script)
+		}
+
+		aCount, bCount := 0, 0
+		for _, l := range script[hunkStart:hunkEnd] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%v,%v +%v,%v @@\n", script[hunkStart].ai+1, aCount, script[hunkStart].bi+1, bCount)
+		for _, l := range script[hunkStart:hunkEnd] {
+			fmt.Fprintf(&out, "%c%v\n", l.op, l.text)
+		}
+
+		start = hunkEnd
+	}
+
+	return out.String()
+}
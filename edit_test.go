@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestRFMLSelector(t *testing.T) {
+	test := &rainforest.RFTest{
+		RFMLID:    "checkout",
+		Title:     "Checkout with a credit card",
+		Tags:      []string{"checkout", "smoke"},
+		FeatureID: 42,
+		RFMLPath:  "spec/rainforest/checkout/credit_card.rfml",
+	}
+
+	testCases := []struct {
+		mappings map[string]interface{}
+		want     bool
+	}{
+		{
+			mappings: map[string]interface{}{},
+			want:     true,
+		},
+		{
+			mappings: map[string]interface{}{"tag": []string{"foo,smoke"}},
+			want:     true,
+		},
+		{
+			mappings: map[string]interface{}{"tag": []string{"foo"}},
+			want:     false,
+		},
+		{
+			mappings: map[string]interface{}{"path": []string{"spec/rainforest/checkout/*"}},
+			want:     true,
+		},
+		{
+			mappings: map[string]interface{}{"path": []string{"credit_*.rfml"}},
+			want:     true,
+		},
+		{
+			mappings: map[string]interface{}{"path": []string{"login/*"}},
+			want:     false,
+		},
+		{
+			mappings: map[string]interface{}{"feature-id": 42, "title": "(?i)credit card$"},
+			want:     true,
+		},
+		{
+			mappings: map[string]interface{}{"feature-id": 43},
+			want:     false,
+		},
+		{
+			mappings: map[string]interface{}{"tag": []string{"smoke"}, "title": "^Login"},
+			want:     false,
+		},
+	}
+
+	for _, tc := range testCases {
+		s, err := newRFMLSelector(newFakeContext(tc.mappings, cli.Args{}))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := s.matches(test); got != tc.want {
+			t.Errorf("Selector %v returned %v, want %v", tc.mappings, got, tc.want)
+		}
+	}
+
+	_, err := newRFMLSelector(newFakeContext(map[string]interface{}{"title": "("}, cli.Args{}))
+	if err == nil {
+		t.Error("Expected an error for an invalid title pattern")
+	}
+}
+
+func TestRFMLEditApply(t *testing.T) {
+	lines := strings.Split(`#! login
+# title: Login
+# start_uri: /
+# tags: foo, bar
+# a comment
+# redirect: false
+
+Log in
+Are you logged in?
+`, "\n")
+	test := &rainforest.RFTest{RFMLID: "login", Tags: []string{"foo", "bar"}}
+
+	e := &rfmlEdit{
+		addTags:    []string{"baz", "foo"},
+		removeTags: []string{"bar"},
+		priority:   "P1",
+		featureID:  "none",
+		execute:    "false",
+	}
+	got := strings.Join(e.apply(lines, test), "\n")
+	want := `#! login
+# title: Login
+# start_uri: /
+# tags: foo, baz
+# a comment
+# priority: P1
+# feature_id:
+# execute: false
+# redirect: false
+
+Log in
+Are you logged in?
+`
+	if got != want {
+		t.Errorf("Unexpected edit result.\nGot:\n%v\nWant:\n%v", got, want)
+	}
+
+	// Removing all tags drops the line
+	e = &rfmlEdit{removeTags: []string{"foo", "bar"}}
+	got = strings.Join(e.apply(lines, test), "\n")
+	if strings.Contains(got, "# tags") {
+		t.Errorf("Expected tags line to be removed, got:\n%v", got)
+	}
+}
+
+func TestNewRFMLEdit(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{},
+		{"set-priority": "P4"},
+		{"set-state": "broken"},
+		{"set-feature-id": "abc"},
+		{"set-execute": "maybe"},
+	}
+	for _, mappings := range invalid {
+		if _, err := newRFMLEdit(newFakeContext(mappings, cli.Args{})); err == nil {
+			t.Errorf("Expected an error for %v", mappings)
+		}
+	}
+
+	e, err := newRFMLEdit(newFakeContext(map[string]interface{}{
+		"set-priority":   "p2",
+		"set-feature-id": "12",
+		"set-execute":    "1",
+		"set-browsers":   []string{"chrome,firefox"},
+	}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &rfmlEdit{
+		priority:  "P2",
+		featureID: "12",
+		execute:   "true",
+		browsers:  []string{"chrome", "firefox"},
+	}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("newRFMLEdit returned %#v, want %#v", e, want)
+	}
+}
+
+func TestEditRFML(t *testing.T) {
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+
+	resultsOut = &bytes.Buffer{}
+	defer func() {
+		resultsOut = os.Stdout
+	}()
+
+	mappings := map[string]interface{}{
+		"test-folder": dir,
+		"tag":         []string{"foo"},
+		"add-tag":     []string{"retagged"},
+		"dry-run":     true,
+	}
+	api := new(watchRfmlAPI)
+
+	// Dry run only prints the diff
+	err := editRFML(newFakeContext(mappings, cli.Args{}), api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := resultsOut.(*bytes.Buffer).String()
+	if !strings.Contains(diff, "-# tags: foo, baz\n+# tags: foo, baz, retagged\n") {
+		t.Errorf("Expected diff of a1 tags, got:\n%v", diff)
+	}
+	test, err := readRFMLFile(filepath.Join(dir, "a/a1.rfml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anyMember(test.Tags, []string{"retagged"}) {
+		t.Error("Dry run should not have modified the file")
+	}
+
+	// Real run rewrites the files and pushes them
+	mappings["dry-run"] = false
+	mappings["push"] = true
+	err = editRFML(newFakeContext(mappings, cli.Args{}), api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests, err := readRFMLFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var retagged []string
+	for _, test := range tests {
+		if anyMember(test.Tags, []string{"retagged"}) {
+			retagged = append(retagged, test.RFMLID)
+		}
+	}
+	sort.Strings(retagged)
+	if want := []string{"a1", "b3"}; !reflect.DeepEqual(retagged, want) {
+		t.Errorf("Expected %v to be retagged, got %v", want, retagged)
+	}
+
+	uploaded := api.updatedTests()
+	sort.Strings(uploaded)
+	if want := []string{"a1", "b3"}; !reflect.DeepEqual(uploaded, want) {
+		t.Errorf("Expected %v to be uploaded, got %v", want, uploaded)
+	}
+
+	// Steps are left untouched
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "a/a1.rfml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), "- b4") {
+		t.Errorf("Expected embedded test to be kept, got:\n%v", string(contents))
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+	b := []string{"1", "2", "3", "4", "five", "6", "7", "8", "9", "10", "11", "12", "13"}
+
+	got := unifiedDiff("file", a, b)
+	want := `--- file
++++ file
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if got != want {
+		t.Errorf("Unexpected diff.\nGot:\n%v\nWant:\n%v", got, want)
+	}
+}
+
+// payloadRfmlAPI records the JSON sent for each updated test
+type payloadRfmlAPI struct {
+	watchRfmlAPI
+	payloads map[string]string
+}
+
+func (p *payloadRfmlAPI) UpdateTest(test *rainforest.RFTest) error {
+	body, err := json.Marshal(test)
+	if err != nil {
+		return err
+	}
+	p.payloads[test.RFMLID] = string(body)
+	return p.watchRfmlAPI.UpdateTest(test)
+}
+
+func TestEditRFMLRemovePriority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainforest-edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRFMLFile(t, filepath.Join(dir, "a1.rfml"), &rainforest.RFTest{RFMLID: "a1", Title: "a1", Priority: "P1", Execute: true,
+		Steps: []interface{}{rainforest.RFTestStep{Action: "Log in", Response: "Are you logged in?"}}})
+
+	api := &payloadRfmlAPI{payloads: map[string]string{}}
+	c := newFakeContext(map[string]interface{}{"test-folder": dir, "set-priority": "none", "push": true}, cli.Args{})
+	err = editRFML(c, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The priority is removed remotely too, not just left out
+	if payload := api.payloads["a1"]; !strings.Contains(payload, `"priority":null`) {
+		t.Errorf("Expected a null priority to be pushed, got %v", payload)
+	}
+	test, err := readRFMLFile(filepath.Join(dir, "a1.rfml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if test.Priority != "" {
+		t.Errorf("Expected no priority locally, got %v", test.Priority)
+	}
+}
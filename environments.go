@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// environmentsAPI manages the environments of the account
+type environmentsAPI interface {
+	GetEnvironments() ([]rainforest.Environment, error)
+	DeleteEnvironment(int) error
+}
+
+// temporaryEnvironmentName returns the name of the temporary environment for
+// --custom-url: the --environment-name, or else the git branch or the run
+// description so temporary environments can be told apart.
+func temporaryEnvironmentName(c cliContext, description string) string {
+	if name := c.String("environment-name"); name != "" {
+		return name
+	}
+	label := ""
+	if repo, err := getRepoInfo(); err == nil {
+		label = repo.Branch
+	}
+	if label == "" {
+		label = description
+	}
+	if label == "" {
+		return rainforest.DefaultTemporaryEnvironmentName
+	}
+	return fmt.Sprintf("%v (%v)", rainforest.DefaultTemporaryEnvironmentName, label)
+}
+
+// temporaryEnvironment returns a temporary environment for the URL, reusing
+// an existing one for the same URL, and the same --environment-name if given,
+// unless --new-environment is given. Created environments are recorded to be
+// deleted with --delete-environment.
+func (r *runner) temporaryEnvironment(c cliContext, url, description string) (*rainforest.Environment, error) {
+	if !c.Bool("new-environment") {
+		environments, err := r.client.GetEnvironments()
+		if err != nil {
+			return nil, err
+		}
+		name := c.String("environment-name")
+		for _, environment := range environments {
+			if environment.IsTemporary && environment.URL == url && (name == "" || environment.Name == name) {
+				log.Printf("Reusing temporary environment %v for %v", environment.Name, url)
+				return &environment, nil
+			}
+		}
+	}
+
+	environment, err := r.client.CreateTemporaryEnvironment(temporaryEnvironmentName(c, description), url)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created temporary environment with name %v", environment.Name)
+	r.createdEnvironment = environment
+	return environment, nil
+}
+
+// runStarted records a run that may use the temporary environment
+func (r *runner) runStarted(runID int) {
+	r.activeRunsMu.Lock()
+	defer r.activeRunsMu.Unlock()
+	if r.activeRuns == nil {
+		r.activeRuns = map[int]bool{}
+	}
+	r.activeRuns[runID] = true
+}
+
+// runDone records that a run reached a final state or was cancelled
+func (r *runner) runDone(runID int) {
+	r.activeRunsMu.Lock()
+	defer r.activeRunsMu.Unlock()
+	delete(r.activeRuns, runID)
+}
+
+// deleteTemporaryEnvironment deletes the temporary environment created for
+// the run, if any. It's kept while runs may still be executing, e.g. after a
+// --timeout that leaves the run going or with --fail-fast. Failures are
+// logged only, the environments cleanup command gets rid of leftovers.
+func (r *runner) deleteTemporaryEnvironment() {
+	if r.createdEnvironment == nil {
+		return
+	}
+	r.activeRunsMu.Lock()
+	active := len(r.activeRuns)
+	r.activeRunsMu.Unlock()
+	if active > 0 {
+		log.Printf("Keeping temporary environment %v, %v run(s) may still be using it", r.createdEnvironment.Name, active)
+		return
+	}
+	err := r.client.DeleteEnvironment(r.createdEnvironment.ID)
+	if err != nil {
+		log.Printf("Unable to delete temporary environment %v: %v", r.createdEnvironment.Name, err)
+		return
+	}
+	log.Printf("Deleted temporary environment %v", r.createdEnvironment.Name)
+	r.createdEnvironment = nil
+}
+
+// cleanupEnvironmentsAPI finds and deletes the temporary environments that
+// are no longer used
+type cleanupEnvironmentsAPI interface {
+	environmentsAPI
+	runsAPI
+}
+
+// environmentUse is an environment and when it was last used
+type environmentUse struct {
+	rainforest.Environment
+	lastUsed time.Time
+}
+
+// staleEnvironments returns the temporary environments that haven't been
+// used since the cutoff, by a run or by being created. Environments reused
+// by a pipeline are only stale once their latest run is old.
+func staleEnvironments(api runsAPI, environments []rainforest.Environment, cutoff time.Time) ([]environmentUse, error) {
+	var stale []environmentUse
+	for _, environment := range environments {
+		if !environment.IsTemporary || environment.CreatedAt.IsZero() || !environment.CreatedAt.Before(cutoff) {
+			continue
+		}
+		runs, err := api.GetRuns(rainforest.RunFilters{EnvironmentID: environment.ID}, 1)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get the runs of environment %v: %v", environment.ID, err)
+		}
+		use := environmentUse{Environment: environment, lastUsed: environment.CreatedAt}
+		if len(runs) > 0 && runs[0].CreatedAt.After(use.lastUsed) {
+			use.lastUsed = runs[0].CreatedAt
+		}
+		if use.lastUsed.Before(cutoff) {
+			stale = append(stale, use)
+		}
+	}
+	return stale, nil
+}
+
+// cleanupEnvironments deletes the temporary environments not used for
+// --older-than, or only lists them with --dry-run
+func cleanupEnvironments(c cliContext, api cleanupEnvironmentsAPI) error {
+	olderThan, err := time.ParseDuration(c.String("older-than"))
+	if err != nil || olderThan < 0 {
+		return cli.NewExitError(fmt.Sprintf("Invalid --older-than %v, use a duration such as 24h", c.String("older-than")), 1)
+	}
+	environments, err := api.GetEnvironments()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	stale, err := staleEnvironments(api, environments, timeNow().Add(-olderThan))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if len(stale) == 0 {
+		log.Printf("No temporary environments unused for %v", olderThan)
+		return nil
+	}
+
+	dryRun := c.Bool("dry-run")
+	var failed []string
+	rows := make([][]string, len(stale))
+	for i, environment := range stale {
+		status := "would be deleted"
+		if !dryRun {
+			status = "deleted"
+			err = api.DeleteEnvironment(environment.ID)
+			if err != nil {
+				status = "failed: " + err.Error()
+				failed = append(failed, strconv.Itoa(environment.ID))
+			}
+		}
+		rows[i] = []string{strconv.Itoa(environment.ID), environment.Name, environment.URL,
+			environment.lastUsed.Format(time.RFC3339), status}
+	}
+	printResourceTable([]string{"Environment ID", "Environment Name", "URL", "Last Used", "Status"}, rows)
+
+	if len(failed) > 0 {
+		return cli.NewExitError(fmt.Sprintf("Unable to delete environment(s) %v", strings.Join(failed, ", ")), 1)
+	}
+	return nil
+}
+
+// manageEnvironmentsAPI creates, updates and deletes environments and their
+// URLs for each site
+type manageEnvironmentsAPI interface {
+	GetEnvironment(int) (*rainforest.Environment, error)
+	CreateEnvironment(rainforest.EnvironmentParams) (*rainforest.Environment, error)
+	UpdateEnvironment(int, string) (*rainforest.Environment, error)
+	DeleteEnvironment(int) error
+	GetSiteEnvironments(int) ([]rainforest.SiteEnvironment, error)
+	SetSiteURL(int, int, string) error
+}
+
+// siteURL is a --site-url option, the URL of the environment for a site
+type siteURL struct {
+	siteID int
+	url    string
+}
+
+// getSiteURLs reads the --site-url SITE_ID=URL options
+func getSiteURLs(c cliContext) ([]siteURL, error) {
+	var urls []siteURL
+	for _, value := range c.StringSlice("site-url") {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid --site-url %v, use SITE_ID=URL", value)
+		}
+		siteID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid site ID %v", parts[0])
+		}
+		urls = append(urls, siteURL{siteID: siteID, url: parts[1]})
+	}
+	return urls, nil
+}
+
+// setSiteURLs sets the URLs of the environment for each site
+func setSiteURLs(api manageEnvironmentsAPI, environmentID int, urls []siteURL) error {
+	for _, u := range urls {
+		err := api.SetSiteURL(u.siteID, environmentID, u.url)
+		if err != nil {
+			return fmt.Errorf("Unable to set the URL of environment %v for site %v: %v", environmentID, u.siteID, err)
+		}
+		log.Printf("Set the URL of environment %v for site %v to %v", environmentID, u.siteID, u.url)
+	}
+	return nil
+}
+
+// environmentIDArgs returns the environment IDs given as arguments
+func environmentIDArgs(c cliContext) ([]int, error) {
+	if len(c.Args()) == 0 {
+		return nil, errors.New("Specify the ID of the environment")
+	}
+	ids := make([]int, len(c.Args()))
+	for i, arg := range c.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid environment ID %v", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// environmentDetails is the JSON output of environments show
+type environmentDetails struct {
+	*rainforest.Environment
+	Sites []rainforest.SiteEnvironment `json:"sites"`
+}
+
+// showEnvironment prints the environment and its URL for each site
+func showEnvironment(c cliContext, api manageEnvironmentsAPI) error {
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return cli.NewExitError(fmt.Sprintf("Invalid format %v, use table or json", format), 1)
+	}
+	ids, err := environmentIDArgs(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	environment, err := api.GetEnvironment(ids[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	sites, err := api.GetSiteEnvironments(environment.ID)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(resultsOut)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(environmentDetails{Environment: environment, Sites: sites})
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	createdAt := ""
+	if !environment.CreatedAt.IsZero() {
+		createdAt = environment.CreatedAt.Format(time.RFC3339)
+	}
+	printResourceTable([]string{"Environment ID", "Environment Name", "URL", "Temporary", "Created At"}, [][]string{{
+		strconv.Itoa(environment.ID), environment.Name, environment.URL, strconv.FormatBool(environment.IsTemporary), createdAt,
+	}})
+	rows := make([][]string, len(sites))
+	for i, site := range sites {
+		rows[i] = []string{strconv.Itoa(site.SiteID), strconv.Itoa(site.ID), site.URL}
+	}
+	printResourceTable([]string{"Site ID", "Site Environment ID", "URL"}, rows)
+	return nil
+}
+
+// createEnvironment creates an environment and sets its site URLs. The ID of
+// the environment is printed for scripts to pick up.
+func createEnvironment(c cliContext, api manageEnvironmentsAPI) error {
+	name := c.String("name")
+	if name == "" {
+		return cli.NewExitError("Specify the --name of the environment", 1)
+	}
+	urls, err := getSiteURLs(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	environment, err := api.CreateEnvironment(rainforest.EnvironmentParams{
+		Name:        name,
+		URL:         c.String("url"),
+		IsTemporary: c.Bool("temporary"),
+	})
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	log.Printf("Created environment %v with ID %v", environment.Name, environment.ID)
+
+	err = setSiteURLs(api, environment.ID, urls)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Fprintln(resultsOut, environment.ID)
+	return nil
+}
+
+// updateEnvironment renames the environment and updates its site URLs
+func updateEnvironment(c cliContext, api manageEnvironmentsAPI) error {
+	ids, err := environmentIDArgs(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	urls, err := getSiteURLs(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	name := c.String("name")
+	if name == "" && len(urls) == 0 {
+		return cli.NewExitError("Specify a new --name or --site-url for the environment", 1)
+	}
+
+	if name != "" {
+		environment, err := api.UpdateEnvironment(ids[0], name)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		log.Printf("Renamed environment %v to %v", environment.ID, environment.Name)
+	}
+	err = setSiteURLs(api, ids[0], urls)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+// deleteEnvironments deletes the environments given as arguments
+func deleteEnvironments(c cliContext, api manageEnvironmentsAPI) error {
+	ids, err := environmentIDArgs(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	for _, id := range ids {
+		err = api.DeleteEnvironment(id)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Unable to delete environment %v: %v", id, err), 1)
+		}
+		log.Printf("Deleted environment %v", id)
+	}
+	return nil
+}
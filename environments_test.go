@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/gittrigger"
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestTemporaryEnvironmentName(t *testing.T) {
+	defer func(f func() (gitTrigger.RepoInfo, error)) { getRepoInfo = f }(getRepoInfo)
+	getRepoInfo = func() (gitTrigger.RepoInfo, error) {
+		return gitTrigger.RepoInfo{Branch: "feature/checkout"}, nil
+	}
+
+	c := newFakeContext(map[string]interface{}{"environment-name": "review app"}, cli.Args{})
+	if got := temporaryEnvironmentName(c, "nightly"); got != "review app" {
+		t.Errorf("Expected the given name, got %v", got)
+	}
+	c = newFakeContext(map[string]interface{}{}, cli.Args{})
+	if got, want := temporaryEnvironmentName(c, "nightly"), "temporary-env-for-custom-url-via-CLI (feature/checkout)"; got != want {
+		t.Errorf("temporaryEnvironmentName returned %v, want %v", got, want)
+	}
+
+	getRepoInfo = func() (gitTrigger.RepoInfo, error) { return gitTrigger.RepoInfo{}, errors.New("no repo") }
+	if got, want := temporaryEnvironmentName(c, "nightly"), "temporary-env-for-custom-url-via-CLI (nightly)"; got != want {
+		t.Errorf("temporaryEnvironmentName returned %v, want %v", got, want)
+	}
+	if got := temporaryEnvironmentName(c, ""); got != rainforest.DefaultTemporaryEnvironmentName {
+		t.Errorf("Expected the default name, got %v", got)
+	}
+}
+
+func TestTemporaryEnvironment(t *testing.T) {
+	existing := rainforest.Environment{ID: 5, Name: "review app", URL: "https://review.example.com", IsTemporary: true}
+	client := &fakeRunnerClient{
+		environment: rainforest.Environment{ID: 6, Name: "new"},
+		environments: []rainforest.Environment{
+			{ID: 4, Name: "staging", URL: "https://staging.example.com"},
+			existing,
+		},
+	}
+	r := newRunner()
+	r.client = client
+
+	// Only temporary environments are reused
+	c := newFakeContext(map[string]interface{}{"environment-name": "review app"}, cli.Args{})
+	env, err := r.temporaryEnvironment(c, "https://staging.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ID != 6 || r.createdEnvironment == nil || client.environmentName != "review app" {
+		t.Errorf("Expected a new environment, got %+v", env)
+	}
+
+	r.createdEnvironment = nil
+	env, err = r.temporaryEnvironment(c, "https://review.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*env, existing) || r.createdEnvironment != nil {
+		t.Errorf("Expected the existing environment to be reused, got %+v", env)
+	}
+
+	// An explicit name has to match too
+	c = newFakeContext(map[string]interface{}{"environment-name": "other review app"}, cli.Args{})
+	env, err = r.temporaryEnvironment(c, "https://review.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ID != 6 || client.environmentName != "other review app" {
+		t.Errorf("Expected a new environment with the given name, got %+v", env)
+	}
+
+	c = newFakeContext(map[string]interface{}{"new-environment": true}, cli.Args{})
+	env, err = r.temporaryEnvironment(c, "https://review.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ID != 6 {
+		t.Errorf("Expected a new environment with --new-environment, got %+v", env)
+	}
+}
+
+func TestMakeRunParamsAutoMetadataEnvironmentName(t *testing.T) {
+	defer func(f func() (bool, string)) { whichCI = f }(whichCI)
+	whichCI = func() (bool, string) { return false, "" }
+	defer func(f func() (gitTrigger.RepoInfo, error)) { getRepoInfo = f }(getRepoInfo)
+	getRepoInfo = func() (gitTrigger.RepoInfo, error) {
+		return gitTrigger.RepoInfo{Commit: gitTrigger.Commit{SHA: "abc123", Message: "Fix checkout\n\nDetails"}}, nil
+	}
+
+	client := &fakeRunnerClient{environment: rainforest.Environment{ID: 6, Name: "new"}}
+	r := newRunner()
+	r.client = client
+	c := newFakeContext(map[string]interface{}{
+		"custom-url":      "https://review.example.com",
+		"new-environment": true,
+		"auto-metadata":   true,
+	}, cli.Args{"all"})
+
+	params, err := r.makeRunParams(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Description != "Fix checkout" || params.Release != "abc123" {
+		t.Errorf("Unexpected metadata %+v", params)
+	}
+	// The environment is named after the generated description
+	if want := "temporary-env-for-custom-url-via-CLI (Fix checkout)"; client.environmentName != want {
+		t.Errorf("Environment named %v, want %v", client.environmentName, want)
+	}
+}
+
+func TestStartRunDeleteEnvironment(t *testing.T) {
+	for _, reuse := range []bool{false, true} {
+		client := &fakeRerunClient{results: map[int]string{1: "passed"}}
+		client.environment = rainforest.Environment{ID: 6, Name: "new"}
+		if reuse {
+			client.environments = []rainforest.Environment{{ID: 5, URL: "https://review.example.com", IsTemporary: true}}
+		}
+		r := newRunner()
+		r.client = client
+		c := newFakeContext(map[string]interface{}{
+			"custom-url":         "https://review.example.com",
+			"delete-environment": true,
+		}, cli.Args{})
+
+		err := r.startRun(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Reused environments are left alone
+		want := []int{6}
+		if reuse {
+			want = nil
+		}
+		if !reflect.DeepEqual(client.deletedEnvironments, want) {
+			t.Errorf("Deleted environments %v, want %v", client.deletedEnvironments, want)
+		}
+	}
+
+	c := newFakeContext(map[string]interface{}{"delete-environment": true, "background": true}, cli.Args{})
+	if err := newRunner().startRun(c); err == nil {
+		t.Error("Expected an error with --background")
+	}
+}
+
+func TestStartRunDeleteEnvironmentTimeout(t *testing.T) {
+	for _, action := range []string{"exit", "cancel"} {
+		client := &fakePollClient{statuses: []rainforest.RunStatus{{State: "in_progress"}}}
+		client.environment = rainforest.Environment{ID: 6, Name: "new"}
+		r := newRunner()
+		r.client = client
+		c := newFakeContext(map[string]interface{}{
+			"custom-url":         "https://review.example.com",
+			"delete-environment": true,
+			"timeout":            "20ms",
+			"timeout-action":     action,
+			"poll-interval":      "1ms",
+		}, cli.Args{})
+
+		if err := r.startRun(c); err == nil {
+			t.Errorf("%v: expected a timeout error", action)
+		}
+		// The environment is only deleted once the run can't use it anymore
+		var want []int
+		if action == "cancel" {
+			want = []int{6}
+		}
+		if !reflect.DeepEqual(client.deletedEnvironments, want) {
+			t.Errorf("%v: deleted environments %v, want %v", action, client.deletedEnvironments, want)
+		}
+	}
+}
+
+type fakeEnvironmentsAPI struct {
+	environments []rainforest.Environment
+	// runs are the runs of each environment, most recent first
+	runs    map[int][]rainforest.Run
+	deleted []int
+}
+
+func (f *fakeEnvironmentsAPI) GetRuns(filters rainforest.RunFilters, limit int) ([]rainforest.Run, error) {
+	runs := f.runs[filters.EnvironmentID]
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (f *fakeEnvironmentsAPI) GetEnvironments() ([]rainforest.Environment, error) {
+	return f.environments, nil
+}
+
+func (f *fakeEnvironmentsAPI) DeleteEnvironment(environmentID int) error {
+	if environmentID == 3 {
+		return errors.New("in use")
+	}
+	f.deleted = append(f.deleted, environmentID)
+	return nil
+}
+
+func TestCleanupEnvironments(t *testing.T) {
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	now := time.Date(2020, 6, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	out := &bytes.Buffer{}
+	tablesOut = out
+
+	api := &fakeEnvironmentsAPI{environments: []rainforest.Environment{
+		{ID: 1, Name: "staging", CreatedAt: now.AddDate(0, -1, 0)},
+		{ID: 2, Name: "old review app", IsTemporary: true, CreatedAt: now.Add(-48 * time.Hour)},
+		{ID: 4, Name: "new review app", IsTemporary: true, CreatedAt: now.Add(-time.Hour)},
+		{ID: 5, Name: "unknown age", IsTemporary: true},
+		{ID: 6, Name: "reused review app", IsTemporary: true, CreatedAt: now.AddDate(0, 0, -5)},
+	}, runs: map[int][]rainforest.Run{
+		2: {{CreatedAt: now.Add(-36 * time.Hour)}},
+		6: {{CreatedAt: now.Add(-2 * time.Hour)}, {CreatedAt: now.AddDate(0, 0, -5)}},
+	}}
+
+	c := newFakeContext(map[string]interface{}{"older-than": "24h", "dry-run": true}, cli.Args{})
+	err := cleanupEnvironments(c, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(api.deleted) != 0 || !strings.Contains(out.String(), "would be deleted") || !strings.Contains(out.String(), "old review app") {
+		t.Errorf("Expected a dry run listing the old environment, deleted %v:\n%v", api.deleted, out.String())
+	}
+	// Environments are stale from their latest run, not their creation
+	if !strings.Contains(out.String(), now.Add(-36*time.Hour).Format(time.RFC3339)) || strings.Contains(out.String(), "reused review app") {
+		t.Errorf("Expected the last use of the unused environment only:\n%v", out.String())
+	}
+
+	c = newFakeContext(map[string]interface{}{"older-than": "24h"}, cli.Args{})
+	err = cleanupEnvironments(c, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2}; !reflect.DeepEqual(api.deleted, want) {
+		t.Errorf("Deleted environments %v, want %v", api.deleted, want)
+	}
+
+	api.environments = append(api.environments, rainforest.Environment{ID: 3, IsTemporary: true, CreatedAt: now.AddDate(0, 0, -3)})
+	if err = cleanupEnvironments(c, api); err == nil || !strings.Contains(err.Error(), "3") {
+		t.Errorf("Expected an error for the environment that couldn't be deleted, got %v", err)
+	}
+
+	c = newFakeContext(map[string]interface{}{"older-than": "a day"}, cli.Args{})
+	if err = cleanupEnvironments(c, api); err == nil {
+		t.Error("Expected an error for an invalid duration")
+	}
+}
+
+// fakeManageEnvironmentsAPI records the environment changes
+type fakeManageEnvironmentsAPI struct {
+	environments map[int]*rainforest.Environment
+	sites        []rainforest.SiteEnvironment
+	created      []rainforest.EnvironmentParams
+	deleted      []int
+}
+
+func (f *fakeManageEnvironmentsAPI) GetEnvironment(id int) (*rainforest.Environment, error) {
+	env, ok := f.environments[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return env, nil
+}
+
+func (f *fakeManageEnvironmentsAPI) CreateEnvironment(params rainforest.EnvironmentParams) (*rainforest.Environment, error) {
+	f.created = append(f.created, params)
+	env := &rainforest.Environment{ID: 40 + len(f.created), Name: params.Name, URL: params.URL, IsTemporary: params.IsTemporary}
+	f.environments[env.ID] = env
+	return env, nil
+}
+
+func (f *fakeManageEnvironmentsAPI) UpdateEnvironment(id int, name string) (*rainforest.Environment, error) {
+	env, err := f.GetEnvironment(id)
+	if err != nil {
+		return nil, err
+	}
+	env.Name = name
+	return env, nil
+}
+
+func (f *fakeManageEnvironmentsAPI) DeleteEnvironment(id int) error {
+	if _, ok := f.environments[id]; !ok {
+		return errors.New("not found")
+	}
+	delete(f.environments, id)
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func (f *fakeManageEnvironmentsAPI) GetSiteEnvironments(id int) ([]rainforest.SiteEnvironment, error) {
+	var sites []rainforest.SiteEnvironment
+	for _, site := range f.sites {
+		if site.EnvironmentID == id {
+			sites = append(sites, site)
+		}
+	}
+	return sites, nil
+}
+
+func (f *fakeManageEnvironmentsAPI) SetSiteURL(siteID, id int, url string) error {
+	for i, site := range f.sites {
+		if site.SiteID == siteID && site.EnvironmentID == id {
+			f.sites[i].URL = url
+			return nil
+		}
+	}
+	return errors.New("SiteEnvironment not found")
+}
+
+func TestCreateAndUpdateEnvironment(t *testing.T) {
+	defer func(w io.Writer) { resultsOut = w }(resultsOut)
+	out := &bytes.Buffer{}
+	resultsOut = out
+
+	api := &fakeManageEnvironmentsAPI{
+		environments: map[int]*rainforest.Environment{},
+		sites:        []rainforest.SiteEnvironment{{ID: 1, SiteID: 10, EnvironmentID: 41}, {ID: 2, SiteID: 11, EnvironmentID: 41}},
+	}
+	c := newFakeContext(map[string]interface{}{
+		"name":     "preview-42",
+		"url":      "https://pr-42.example.com",
+		"site-url": []string{"11=https://api.pr-42.example.com"},
+	}, cli.Args{})
+	err := createEnvironment(c, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []rainforest.EnvironmentParams{{Name: "preview-42", URL: "https://pr-42.example.com"}}; !reflect.DeepEqual(api.created, want) {
+		t.Errorf("Created %+v, want %+v", api.created, want)
+	}
+	if api.sites[1].URL != "https://api.pr-42.example.com" {
+		t.Errorf("Expected the site URL to be set, got %+v", api.sites)
+	}
+	// The ID is printed for scripts
+	if out.String() != "41\n" {
+		t.Errorf("Expected the environment ID, got %q", out.String())
+	}
+
+	c = newFakeContext(map[string]interface{}{
+		"name":     "preview-43",
+		"site-url": []string{"10=https://pr-43.example.com"},
+	}, cli.Args{"41"})
+	err = updateEnvironment(c, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api.environments[41].Name != "preview-43" || api.sites[0].URL != "https://pr-43.example.com" {
+		t.Errorf("Unexpected update %+v %+v", api.environments[41], api.sites)
+	}
+
+	for _, tc := range []struct {
+		flags map[string]interface{}
+		args  cli.Args
+	}{
+		{map[string]interface{}{}, cli.Args{}},
+		{map[string]interface{}{"name": "x", "site-url": []string{"abc=https://example.com"}}, cli.Args{}},
+		{map[string]interface{}{"name": "x", "site-url": []string{"12"}}, cli.Args{}},
+		{map[string]interface{}{"name": "x", "site-url": []string{"12=https://example.com"}}, cli.Args{}},
+	} {
+		if err = createEnvironment(newFakeContext(tc.flags, tc.args), api); err == nil {
+			t.Errorf("Expected create to fail with %v", tc.flags)
+		}
+	}
+	for _, tc := range []struct {
+		flags map[string]interface{}
+		args  cli.Args
+	}{
+		{map[string]interface{}{"name": "x"}, cli.Args{}},
+		{map[string]interface{}{}, cli.Args{"41"}},
+		{map[string]interface{}{"name": "x"}, cli.Args{"abc"}},
+		{map[string]interface{}{"name": "x"}, cli.Args{"99"}},
+	} {
+		if err = updateEnvironment(newFakeContext(tc.flags, tc.args), api); err == nil {
+			t.Errorf("Expected update to fail with %v %v", tc.flags, tc.args)
+		}
+	}
+}
+
+func TestShowEnvironment(t *testing.T) {
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	defer func(w io.Writer) { resultsOut = w }(resultsOut)
+	out := &bytes.Buffer{}
+	tablesOut = out
+	resultsOut = out
+
+	api := &fakeManageEnvironmentsAPI{
+		environments: map[int]*rainforest.Environment{7: {ID: 7, Name: "staging"}},
+		sites: []rainforest.SiteEnvironment{
+			{ID: 1, SiteID: 10, EnvironmentID: 7, URL: "https://staging.example.com"},
+			{ID: 2, SiteID: 10, EnvironmentID: 8, URL: "https://qa.example.com"},
+		},
+	}
+	err := showEnvironment(newFakeContext(map[string]interface{}{"format": "table"}, cli.Args{"7"}), api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "staging") || !strings.Contains(out.String(), "https://staging.example.com") ||
+		strings.Contains(out.String(), "qa.example.com") {
+		t.Errorf("Unexpected output:\n%v", out.String())
+	}
+
+	out.Reset()
+	err = showEnvironment(newFakeContext(map[string]interface{}{"format": "json"}, cli.Args{"7"}), api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var details struct {
+		ID    int                          `json:"id"`
+		Sites []rainforest.SiteEnvironment `json:"sites"`
+	}
+	err = json.Unmarshal(out.Bytes(), &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.ID != 7 || len(details.Sites) != 1 {
+		t.Errorf("Unexpected JSON output:\n%v", out.String())
+	}
+
+	for _, args := range []cli.Args{{}, {"99"}} {
+		if err = showEnvironment(newFakeContext(map[string]interface{}{"format": "table"}, args), api); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
+
+func TestDeleteEnvironments(t *testing.T) {
+	api := &fakeManageEnvironmentsAPI{environments: map[int]*rainforest.Environment{7: {ID: 7}, 8: {ID: 8}}}
+	err := deleteEnvironments(newFakeContext(map[string]interface{}{}, cli.Args{"7", "8"}), api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{7, 8}; !reflect.DeepEqual(api.deleted, want) {
+		t.Errorf("Deleted %v, want %v", api.deleted, want)
+	}
+	if err = deleteEnvironments(newFakeContext(map[string]interface{}{}, cli.Args{"7"}), api); err == nil {
+		t.Error("Expected an error for a missing environment")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// parseStepRange parses a 1-based, inclusive step range such as "3" or "2-5"
+// into start and end indexes of a steps slice.
+func parseStepRange(stepRange string) (int, int, error) {
+	parts := strings.SplitN(stepRange, "-", 2)
+	first, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid step range %v", stepRange)
+	}
+	last := first
+	if len(parts) == 2 {
+		last, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid step range %v", stepRange)
+		}
+	}
+	if first < 1 || last < first {
+		return 0, 0, fmt.Errorf("Invalid step range %v", stepRange)
+	}
+	return first - 1, last, nil
+}
+
+// stepRedirect returns the redirect setting of a step or an embedded test.
+func stepRedirect(step interface{}) bool {
+	switch s := step.(type) {
+	case rainforest.RFTestStep:
+		return s.Redirect
+	case rainforest.RFEmbeddedTest:
+		return s.Redirect
+	}
+	return false
+}
+
+// sameStep compares two steps, optionally ignoring their redirect setting.
+func sameStep(a, b interface{}, ignoreRedirect bool) bool {
+	if ignoreRedirect {
+		return sameStep(withRedirect(a, true), withRedirect(b, true), false)
+	}
+	return a == b
+}
+
+// withRedirect returns a copy of the step with the given redirect setting.
+func withRedirect(step interface{}, redirect bool) interface{} {
+	switch s := step.(type) {
+	case rainforest.RFTestStep:
+		s.Redirect = redirect
+		return s
+	case rainforest.RFEmbeddedTest:
+		s.Redirect = redirect
+		return s
+	}
+	return step
+}
+
+// replaceStepSequence replaces every occurrence of seq in steps with an
+// embed of rfmlID. The redirect of the first replaced step is kept on the
+// embed, as it decides what happens when the embedded test starts. It returns
+// the new steps and the number of replacements.
+func replaceStepSequence(steps []interface{}, seq []interface{}, rfmlID string) ([]interface{}, int) {
+	result := []interface{}{}
+	replaced := 0
+	for i := 0; i < len(steps); {
+		matched := len(seq) > 0 && i+len(seq) <= len(steps)
+		for j := 0; matched && j < len(seq); j++ {
+			matched = sameStep(steps[i+j], seq[j], j == 0)
+		}
+
+		if matched {
+			result = append(result, rainforest.RFEmbeddedTest{RFMLID: rfmlID, Redirect: stepRedirect(steps[i])})
+			replaced++
+			i += len(seq)
+		} else {
+			result = append(result, steps[i])
+			i++
+		}
+	}
+	return result, replaced
+}
+
+// errStepsNotFound is returned when no test contains the steps to extract
+var errStepsNotFound = errors.New("The selected steps could not be found")
+
+// newEmbeddableTest returns a test with the given steps that is only run
+// when embedded in other tests.
+func newEmbeddableTest(rfmlID, title string, source *rainforest.RFTest, seq []interface{}) *rainforest.RFTest {
+	steps := make([]interface{}, len(seq))
+	copy(steps, seq)
+	steps[0] = withRedirect(steps[0], true)
+
+	return &rainforest.RFTest{
+		RFMLID:   rfmlID,
+		Title:    title,
+		StartURI: source.StartURI,
+		SiteID:   source.SiteID,
+		State:    "enabled",
+		Execute:  false,
+		Steps:    steps,
+	}
+}
+
+// extractRFML moves a range of steps of a test into a new test and embeds it
+// instead of the same steps in every test of the local suite.
+func extractRFML(c cliContext) error {
+	if len(c.Args()) != 1 {
+		return cli.NewExitError("Specify the RFML file to extract the steps from", 1)
+	}
+	rfmlID := c.String("rfml-id")
+	if rfmlID == "" {
+		return cli.NewExitError("Specify the RFML ID of the new test with --rfml-id", 1)
+	}
+	start, end, err := parseStepRange(c.String("steps"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	suite, selected, err := readRFMLSuite(c.String("test-folder"), c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	source := selected[0]
+
+	if _, ok := rfmlTestsByID(suite)[rfmlID]; ok {
+		return cli.NewExitError(fmt.Sprintf("A test with RFML ID %v already exists", rfmlID), 1)
+	}
+	if end > len(source.Steps) {
+		return cli.NewExitError(fmt.Sprintf("%v only has %v steps", source.RFMLPath, len(source.Steps)), 1)
+	}
+
+	outputPath := c.String("output")
+	if outputPath == "" {
+		outputPath = filepath.Join(filepath.Dir(source.RFMLPath), rfmlID+".rfml")
+	}
+	if _, err = os.Stat(outputPath); err == nil {
+		return cli.NewExitError(fmt.Sprintf("%v already exists", outputPath), 1)
+	} else if !os.IsNotExist(err) {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	title := c.String("title")
+	if title == "" {
+		title = rfmlID
+	}
+	seq := source.Steps[start:end]
+	newTest := newEmbeddableTest(rfmlID, title, source, seq)
+
+	changed, err := extractStepSequence(suite, seq, newTest, outputPath, c.Bool("dry-run"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("dry-run") {
+		log.Printf("%v test(s) would embed %v", changed, rfmlID)
+	} else {
+		log.Printf("Extracted %v to %v, %v test(s) now embed it", rfmlID, outputPath, changed)
+	}
+	return nil
+}
+
+// extractStepSequence writes newTest to outputPath and replaces seq with an
+// embed of it in every test of the suite. It returns the number of changed
+// tests.
+func extractStepSequence(suite []*rainforest.RFTest, seq []interface{}, newTest *rainforest.RFTest, outputPath string, dryRun bool) (int, error) {
+	// Find the changes before writing anything
+	sort.Slice(suite, func(i, j int) bool { return suite[i].RFMLPath < suite[j].RFMLPath })
+	var changed []*rainforest.RFTest
+	for _, test := range suite {
+		steps, replaced := replaceStepSequence(test.Steps, seq, newTest.RFMLID)
+		if replaced == 0 {
+			continue
+		}
+		changedTest := *test
+		changedTest.Steps = steps
+		changed = append(changed, &changedTest)
+	}
+	if len(changed) == 0 {
+		return 0, errStepsNotFound
+	}
+
+	err := rewriteRFMLTest(outputPath, newTest, dryRun)
+	if err != nil {
+		return 0, err
+	}
+	for _, test := range changed {
+		err = rewriteRFMLTest(test.RFMLPath, test, dryRun)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(changed), nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestParseStepRange(t *testing.T) {
+	testCases := []struct {
+		stepRange  string
+		start, end int
+		valid      bool
+	}{
+		{"3", 2, 3, true},
+		{"2-5", 1, 5, true},
+		{" 1 - 2 ", 0, 2, true},
+		{"0-2", 0, 0, false},
+		{"4-2", 0, 0, false},
+		{"a-b", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		start, end, err := parseStepRange(tc.stepRange)
+		if (err == nil) != tc.valid {
+			t.Errorf("parseStepRange(%q) returned error %v", tc.stepRange, err)
+			continue
+		}
+		if tc.valid && (start != tc.start || end != tc.end) {
+			t.Errorf("parseStepRange(%q) returned %v, %v, want %v, %v", tc.stepRange, start, end, tc.start, tc.end)
+		}
+	}
+}
+
+func TestReplaceStepSequence(t *testing.T) {
+	login := rainforest.RFTestStep{Action: "Log in", Response: "OK?", Redirect: true}
+	menu := rainforest.RFTestStep{Action: "Open menu", Response: "OK?", Redirect: true}
+	other := rainforest.RFTestStep{Action: "Other", Response: "OK?", Redirect: true}
+	noRedirect := func(s rainforest.RFTestStep) rainforest.RFTestStep {
+		s.Redirect = false
+		return s
+	}
+
+	steps := []interface{}{
+		noRedirect(login), menu,
+		other,
+		login, noRedirect(menu),
+		login, menu,
+	}
+	got, replaced := replaceStepSequence(steps, []interface{}{login, menu}, "login")
+	want := []interface{}{
+		rainforest.RFEmbeddedTest{RFMLID: "login", Redirect: false},
+		other,
+		login, noRedirect(menu),
+		rainforest.RFEmbeddedTest{RFMLID: "login", Redirect: true},
+	}
+	if replaced != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("replaceStepSequence returned %v (%v replaced), want %v", got, replaced, want)
+	}
+}
+
+func TestExtractRFML(t *testing.T) {
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+
+	login := rainforest.RFTestStep{Action: "Log in", Response: "Logged in?", Redirect: true}
+	menu := rainforest.RFTestStep{Action: "Open menu", Response: "Menu open?", Redirect: true}
+	pay := rainforest.RFTestStep{Action: "Pay", Response: "Paid?", Redirect: true}
+
+	a2Path := filepath.Join(dir, "a/a2.rfml")
+	b1Path := filepath.Join(dir, "b/b1.rfml")
+	writeRFMLFile(t, a2Path, &rainforest.RFTest{RFMLID: "a2", Title: "a2", SiteID: 7, Execute: true,
+		Steps: []interface{}{login, menu, pay}})
+	writeRFMLFile(t, b1Path, &rainforest.RFTest{RFMLID: "b1", Title: "b1", Execute: true,
+		Steps: []interface{}{pay, login, menu}})
+
+	mappings := map[string]interface{}{
+		"test-folder": dir,
+		"steps":       "1-2",
+		"rfml-id":     "login",
+		"title":       "Log in",
+	}
+
+	// The new RFML ID must be unique
+	mappings["rfml-id"] = "b1"
+	if err := extractRFML(newFakeContext(mappings, cli.Args{a2Path})); err == nil {
+		t.Error("Expected an error for a duplicate RFML ID")
+	}
+	mappings["rfml-id"] = "login"
+
+	err := extractRFML(newFakeContext(mappings, cli.Args{a2Path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTest, err := readRFMLFile(filepath.Join(dir, "a/login.rfml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newTest.Title != "Log in" || newTest.Execute || newTest.SiteID != 7 ||
+		!reflect.DeepEqual(newTest.Steps, []interface{}{login, menu}) {
+		t.Errorf("Unexpected extracted test %+v", newTest)
+	}
+
+	embed := rainforest.RFEmbeddedTest{RFMLID: "login", Redirect: true}
+	for path, want := range map[string][]interface{}{
+		a2Path: {embed, pay},
+		b1Path: {pay, embed},
+	} {
+		test, err := readRFMLFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(test.Steps, want) {
+			t.Errorf("Unexpected steps in %v: %v, want %v", path, test.Steps, want)
+		}
+	}
+
+	// The suite is still valid
+	tests, err := readRFMLFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = validateRFMLFiles(tests, true, nil); err != nil {
+		t.Errorf("Expected a valid suite after extracting, got %v", err)
+	}
+
+	// Extracting into an existing file fails without touching anything
+	contents, _ := ioutil.ReadFile(a2Path)
+	mappings["rfml-id"] = "other"
+	mappings["output"] = b1Path
+	if err = extractRFML(newFakeContext(mappings, cli.Args{a2Path})); err == nil {
+		t.Error("Expected an error for an existing output file")
+	}
+	if after, _ := ioutil.ReadFile(a2Path); string(after) != string(contents) {
+		t.Error("Expected a2 not to be modified")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// rfmlQuery filters the local suite on top of what rfmlSelector supports.
+type rfmlQuery struct {
+	selector *rfmlSelector
+	text     string
+	priority string
+	state    string
+	browsers []string
+	siteID   int
+	embeds   string
+	untagged bool
+}
+
+// newRFMLQuery builds a query from the find command flags.
+func newRFMLQuery(c cliContext) (*rfmlQuery, error) {
+	selector, err := newRFMLSelector(c)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &rfmlQuery{
+		selector: selector,
+		text:     strings.ToLower(c.String("text")),
+		state:    c.String("state"),
+		browsers: expandStringSlice(c.StringSlice("browser")),
+		siteID:   c.Int("site-id"),
+		embeds:   c.String("embeds"),
+		untagged: c.Bool("untagged"),
+	}
+
+	switch priority := strings.ToUpper(c.String("priority")); priority {
+	case "", "P1", "P2", "P3":
+		q.priority = priority
+	case "NONE":
+		q.priority = "none"
+	default:
+		return nil, errors.New("Priority must be one of P1, P2, P3 or none")
+	}
+
+	if q.untagged && len(selector.tags) > 0 {
+		return nil, errors.New("--untagged cannot be used together with --tag")
+	}
+
+	return q, nil
+}
+
+// run returns the tests matching the query, keeping their order.
+func (q *rfmlQuery) run(tests []*rainforest.RFTest) []*rainforest.RFTest {
+	testsByID := rfmlTestsByID(tests)
+
+	var result []*rainforest.RFTest
+	for _, test := range tests {
+		if q.matches(test, testsByID) {
+			result = append(result, test)
+		}
+	}
+	return result
+}
+
+func (q *rfmlQuery) matches(test *rainforest.RFTest, testsByID map[string]*rainforest.RFTest) bool {
+	if !q.selector.matches(test) {
+		return false
+	}
+	if q.untagged && len(test.Tags) > 0 {
+		return false
+	}
+	if q.priority == "none" && test.Priority != "" {
+		return false
+	} else if q.priority != "none" && q.priority != "" && test.Priority != q.priority {
+		return false
+	}
+	if q.state != "" && test.State != q.state {
+		return false
+	}
+	if len(q.browsers) > 0 && !anyMember(q.browsers, test.Browsers) {
+		return false
+	}
+	if q.siteID != 0 && test.SiteID != q.siteID {
+		return false
+	}
+	if q.embeds != "" && !embedsRFMLID(test, q.embeds, testsByID, map[string]bool{}) {
+		return false
+	}
+	if q.text != "" && !stepsContainText(test, q.text) {
+		return false
+	}
+	return true
+}
+
+// stepsContainText returns true if any action or question of the test
+// contains the lowercased text.
+func stepsContainText(test *rainforest.RFTest, text string) bool {
+	for _, step := range test.Steps {
+		if s, ok := step.(rainforest.RFTestStep); ok {
+			if strings.Contains(strings.ToLower(s.Action), text) ||
+				strings.Contains(strings.ToLower(s.Response), text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rfmlTestsByID indexes tests by their RFML ID.
+func rfmlTestsByID(tests []*rainforest.RFTest) map[string]*rainforest.RFTest {
+	testsByID := make(map[string]*rainforest.RFTest, len(tests))
+	for _, test := range tests {
+		testsByID[test.RFMLID] = test
+	}
+	return testsByID
+}
+
+// embeddedRFMLIDs returns the RFML IDs of the tests directly embedded in test.
+func embeddedRFMLIDs(test *rainforest.RFTest) []string {
+	var ids []string
+	for _, step := range test.Steps {
+		if embed, ok := step.(rainforest.RFEmbeddedTest); ok {
+			ids = append(ids, embed.RFMLID)
+		}
+	}
+	return ids
+}
+
+// embedsRFMLID returns true if test embeds the rfmlID test either directly or
+// through other embedded tests. visited guards against circular embeds.
+func embedsRFMLID(test *rainforest.RFTest, rfmlID string, testsByID map[string]*rainforest.RFTest, visited map[string]bool) bool {
+	visited[test.RFMLID] = true
+	for _, id := range embeddedRFMLIDs(test) {
+		if id == rfmlID {
+			return true
+		}
+		if embedded, ok := testsByID[id]; ok && !visited[id] {
+			if embedsRFMLID(embedded, rfmlID, testsByID, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findResult is the JSON representation of a found test.
+type findResult struct {
+	RFMLID    string   `json:"rfml_id"`
+	Title     string   `json:"title"`
+	Path      string   `json:"path"`
+	Tags      []string `json:"tags"`
+	Priority  string   `json:"priority,omitempty"`
+	State     string   `json:"state"`
+	Browsers  []string `json:"browsers,omitempty"`
+	SiteID    int      `json:"site_id,omitempty"`
+	FeatureID int      `json:"feature_id,omitempty"`
+	Execute   bool     `json:"execute"`
+}
+
+// findRFML searches the local RFML suite and prints the matching tests.
+func findRFML(c cliContext) error {
+	format := c.String("format")
+	switch format {
+	case "":
+		format = "paths"
+	case "paths", "ids", "json":
+	default:
+		return cli.NewExitError("Invalid format specified, use one of paths, ids or json", 1)
+	}
+
+	query, err := newRFMLQuery(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	files := []string(c.Args())
+	if len(files) == 0 {
+		files = []string{c.String("test-folder")}
+	}
+	tests, err := readRFMLFiles(files)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	found := query.run(tests)
+
+	switch format {
+	case "paths":
+		for _, test := range found {
+			fmt.Fprintln(resultsOut, test.RFMLPath)
+		}
+	case "ids":
+		for _, test := range found {
+			fmt.Fprintln(resultsOut, test.RFMLID)
+		}
+	case "json":
+		results := make([]findResult, len(found))
+		for i, test := range found {
+			tags := test.Tags
+			if tags == nil {
+				tags = []string{}
+			}
+			featureID := int(test.FeatureID)
+			if featureID < 0 {
+				// Feature is being removed
+				featureID = 0
+			}
+			results[i] = findResult{
+				RFMLID:    test.RFMLID,
+				Title:     test.Title,
+				Path:      test.RFMLPath,
+				Tags:      tags,
+				Priority:  test.Priority,
+				State:     test.State,
+				Browsers:  test.Browsers,
+				SiteID:    test.SiteID,
+				FeatureID: featureID,
+				Execute:   test.Execute,
+			}
+		}
+		encoder := json.NewEncoder(resultsOut)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(results)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	return nil
+}
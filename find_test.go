@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestRFMLQuery(t *testing.T) {
+	login := &rainforest.RFTest{
+		RFMLID:   "login",
+		Tags:     []string{"auth"},
+		Priority: "P1",
+		State:    "enabled",
+		Browsers: []string{"chrome"},
+		SiteID:   12,
+		Steps: []interface{}{
+			rainforest.RFTestStep{Action: "Enter your Password", Response: "Are you logged in?"},
+		},
+	}
+	checkout := &rainforest.RFTest{
+		RFMLID: "checkout",
+		State:  "disabled",
+		Steps: []interface{}{
+			rainforest.RFEmbeddedTest{RFMLID: "cart"},
+			rainforest.RFTestStep{Action: "Pay", Response: "Did the payment go through?"},
+		},
+	}
+	cart := &rainforest.RFTest{
+		RFMLID: "cart",
+		Tags:   []string{"shop"},
+		State:  "enabled",
+		Steps: []interface{}{
+			rainforest.RFEmbeddedTest{RFMLID: "login"},
+		},
+	}
+	tests := []*rainforest.RFTest{login, checkout, cart}
+
+	testCases := []struct {
+		mappings map[string]interface{}
+		want     []string
+	}{
+		{
+			mappings: map[string]interface{}{},
+			want:     []string{"login", "checkout", "cart"},
+		},
+		{
+			mappings: map[string]interface{}{"text": "password"},
+			want:     []string{"login"},
+		},
+		{
+			mappings: map[string]interface{}{"text": "PAYMENT"},
+			want:     []string{"checkout"},
+		},
+		{
+			mappings: map[string]interface{}{"untagged": true},
+			want:     []string{"checkout"},
+		},
+		{
+			mappings: map[string]interface{}{"priority": "p1"},
+			want:     []string{"login"},
+		},
+		{
+			mappings: map[string]interface{}{"priority": "none", "state": "enabled"},
+			want:     []string{"cart"},
+		},
+		{
+			mappings: map[string]interface{}{"browser": []string{"firefox,chrome"}, "site-id": 12},
+			want:     []string{"login"},
+		},
+		{
+			mappings: map[string]interface{}{"embeds": "login"},
+			want:     []string{"checkout", "cart"},
+		},
+		{
+			mappings: map[string]interface{}{"embeds": "login", "tag": []string{"shop"}},
+			want:     []string{"cart"},
+		},
+	}
+
+	for _, tc := range testCases {
+		q, err := newRFMLQuery(newFakeContext(tc.mappings, cli.Args{}))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		var got []string
+		for _, test := range q.run(tests) {
+			got = append(got, test.RFMLID)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Query %v returned %v, want %v", tc.mappings, got, tc.want)
+		}
+	}
+
+	_, err := newRFMLQuery(newFakeContext(map[string]interface{}{"untagged": true, "tag": []string{"foo"}}, cli.Args{}))
+	if err == nil {
+		t.Error("Expected an error when using --untagged with --tag")
+	}
+}
+
+func TestEmbedsRFMLIDCircular(t *testing.T) {
+	a := &rainforest.RFTest{RFMLID: "a", Steps: []interface{}{rainforest.RFEmbeddedTest{RFMLID: "b"}}}
+	b := &rainforest.RFTest{RFMLID: "b", Steps: []interface{}{rainforest.RFEmbeddedTest{RFMLID: "a"}}}
+	testsByID := rfmlTestsByID([]*rainforest.RFTest{a, b})
+
+	if embedsRFMLID(a, "c", testsByID, map[string]bool{}) {
+		t.Error("Expected a not to embed c")
+	}
+}
+
+func TestFindRFML(t *testing.T) {
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+
+	out := &bytes.Buffer{}
+	resultsOut = out
+	defer func() {
+		resultsOut = os.Stdout
+	}()
+
+	// Paths
+	err := findRFML(newFakeContext(map[string]interface{}{"embeds": "b5"}, cli.Args{dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Fields(out.String())
+	sort.Strings(got)
+	want := []string{filepath.Join(dir, "a/a1.rfml"), filepath.Join(dir, "b/b/b4.rfml")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected paths %v, got %v", want, got)
+	}
+
+	// IDs
+	out.Reset()
+	err = findRFML(newFakeContext(map[string]interface{}{"test-folder": dir, "tag": []string{"foo"}, "format": "ids"}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = strings.Fields(out.String())
+	sort.Strings(got)
+	if want := []string{"a1", "b3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected IDs %v, got %v", want, got)
+	}
+
+	// JSON
+	out.Reset()
+	err = findRFML(newFakeContext(map[string]interface{}{"tag": []string{"bar"}, "format": "json"}, cli.Args{dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []findResult
+	err = json.Unmarshal(out.Bytes(), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].RFMLID != "a3" || !results[0].Execute ||
+		!reflect.DeepEqual(results[0].Tags, []string{"bar"}) {
+		t.Errorf("Unexpected JSON results: %+v", results)
+	}
+
+	err = findRFML(newFakeContext(map[string]interface{}{"format": "xml"}, cli.Args{dir}))
+	if err == nil {
+		t.Error("Expected an error for an invalid format")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// flakyAPI is the part of the API used to find and tag flaky tests
+type flakyAPI interface {
+	runsAPI
+	GetRunTests(int) ([]rainforest.RunTest, error)
+	GetTest(int) (*rainforest.RFTest, error)
+	UpdateTest(*rainforest.RFTest) error
+}
+
+// testHistory is the record of a test across runs
+type testHistory struct {
+	TestID   int     `json:"test_id"`
+	Name     string  `json:"name"`
+	Runs     int     `json:"runs"`
+	Failures int     `json:"failures"`
+	Flips    int     `json:"flips"`
+	FlipRate float64 `json:"flip_rate"`
+	// PassedOnRerun counts the failures fixed by rerunning the failed tests
+	PassedOnRerun int    `json:"passed_on_rerun"`
+	LastFailedRun string `json:"last_failed_run,omitempty"`
+
+	lastPassed bool
+}
+
+// record adds the result of the test in run to its history. The latest
+// title of the test is kept.
+func (h *testHistory) record(run rainforest.Run, test rainforest.RunTest) {
+	passed := test.Result == "passed"
+	if h.Runs > 0 && passed != h.lastPassed {
+		h.Flips++
+	}
+	h.Runs++
+	h.lastPassed = passed
+	h.Name = test.Title
+
+	if !passed {
+		h.Failures++
+		h.LastFailedRun = run.FrontendURL
+		if h.LastFailedRun == "" {
+			h.LastFailedRun = strconv.Itoa(run.ID)
+		}
+	}
+	if h.Runs > 1 {
+		h.FlipRate = float64(h.Flips) / float64(h.Runs-1)
+	}
+}
+
+// flaky returns true if the test both passed and failed
+func (h *testHistory) flaky() bool {
+	return h.Flips > 0
+}
+
+// isRerun returns true if the run has exactly the tests that failed in the
+// run before it, which is what rerunning the failed tests of a run starts.
+// Runs don't record what they rerun, so this is a guess: a filtered run of
+// just those tests is taken for a rerun too, and a run with any other test
+// isn't one.
+func isRerun(tests, previous []rainforest.RunTest) bool {
+	failed := map[int]bool{}
+	for _, test := range previous {
+		if test.Result == "failed" {
+			failed[test.ID] = true
+		}
+	}
+	if len(tests) == 0 || len(tests) != len(failed) {
+		return false
+	}
+	for _, test := range tests {
+		if !failed[test.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+// testHistories builds the history of every test, by test ID, from the test
+// results of the runs, which are given most recent first like GetRuns
+// returns them. Reruns of failed tests only count towards PassedOnRerun,
+// and tests without a passed or failed result are left out.
+func testHistories(runs []rainforest.Run, runTests map[int][]rainforest.RunTest) []*testHistory {
+	var histories []*testHistory
+	byID := map[int]*testHistory{}
+	var previous []rainforest.RunTest
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		tests, ok := runTests[run.ID]
+		if !ok {
+			continue
+		}
+		rerun := isRerun(tests, previous)
+		previous = tests
+
+		for _, test := range tests {
+			if test.Result != "passed" && test.Result != "failed" {
+				continue
+			}
+			h, ok := byID[test.ID]
+			if rerun {
+				if ok && test.Result == "passed" {
+					h.PassedOnRerun++
+				}
+				continue
+			}
+			if !ok {
+				h = &testHistory{TestID: test.ID}
+				byID[test.ID] = h
+				histories = append(histories, h)
+			}
+			h.record(run, test)
+		}
+	}
+	return histories
+}
+
+// rankFlakyTests returns the flaky tests, the flakiest first
+func rankFlakyTests(histories []*testHistory) []*testHistory {
+	var flaky []*testHistory
+	for _, h := range histories {
+		if h.flaky() {
+			flaky = append(flaky, h)
+		}
+	}
+	sort.SliceStable(flaky, func(i, j int) bool {
+		a, b := flaky[i], flaky[j]
+		if a.FlipRate != b.FlipRate {
+			return a.FlipRate > b.FlipRate
+		}
+		if a.PassedOnRerun != b.PassedOnRerun {
+			return a.PassedOnRerun > b.PassedOnRerun
+		}
+		return a.Failures > b.Failures
+	})
+	return flaky
+}
+
+// fetchRunTests fetches the test results of the runs. Runs whose tests
+// can't be fetched are skipped.
+func fetchRunTests(api flakyAPI, runs []rainforest.Run) map[int][]rainforest.RunTest {
+	runTests := map[int][]rainforest.RunTest{}
+	for _, run := range runs {
+		tests, err := api.GetRunTests(run.ID)
+		if err != nil {
+			log.Printf("Skipping run %v, unable to get its tests: %v", run.ID, err)
+			continue
+		}
+		runTests[run.ID] = tests
+	}
+	return runTests
+}
+
+// findFlakyTests ranks the tests that flip between passing and failing in
+// the recent runs, and tags the worst offenders if asked to.
+func findFlakyTests(c cliContext, api flakyAPI) error {
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return cli.NewExitError(fmt.Sprintf("Invalid format %v, use table or json", format), 1)
+	}
+	last := c.Int("last")
+	if last < 2 {
+		return cli.NewExitError("--last needs at least 2 runs to compare", 1)
+	}
+
+	filters := rainforest.RunFilters{
+		State:         "complete",
+		EnvironmentID: c.Int("environment-id"),
+		RunGroupID:    c.Int("run-group"),
+		CreatedByCLI:  c.Bool("created-by-cli"),
+	}
+	runs, err := api.GetRuns(filters, last)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	log.Printf("Analyzing the results of %v run(s)", len(runs))
+
+	flaky := rankFlakyTests(testHistories(runs, fetchRunTests(api, runs)))
+
+	if format == "json" {
+		encoder := json.NewEncoder(resultsOut)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(flaky)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	} else {
+		printFlakyTests(flaky)
+	}
+
+	if n := c.Int("tag-flaky"); n > 0 {
+		if n > len(flaky) {
+			n = len(flaky)
+		}
+		err = tagFlakyTests(api, flaky[:n], c.String("flaky-tag"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	return nil
+}
+
+func printFlakyTests(flaky []*testHistory) {
+	if len(flaky) == 0 {
+		log.Print("No flaky tests found")
+		return
+	}
+	rows := make([][]string, len(flaky))
+	for i, h := range flaky {
+		rows[i] = []string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(h.TestID),
+			h.Name,
+			strconv.Itoa(h.Runs),
+			strconv.Itoa(h.Failures),
+			fmt.Sprintf("%.0f%%", h.FlipRate*100),
+			strconv.Itoa(h.PassedOnRerun),
+			h.LastFailedRun,
+		}
+	}
+	printResourceTable([]string{"Rank", "Test ID", "Test", "Runs", "Failures", "Flip Rate", "Passed On Rerun", "Last Failure"}, rows)
+}
+
+// tagFlakyTests adds the tag to the tests
+func tagFlakyTests(api flakyAPI, flaky []*testHistory, tag string) error {
+	for _, h := range flaky {
+		test, err := api.GetTest(h.TestID)
+		if err != nil {
+			return err
+		}
+		if anyMember(test.Tags, []string{tag}) {
+			continue
+		}
+		test.Tags = append(test.Tags, tag)
+		err = api.UpdateTest(test)
+		if err != nil {
+			return err
+		}
+		log.Printf("Tagged %v as %v", h.Name, tag)
+	}
+	return nil
+}
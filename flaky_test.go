@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeFlakyClient struct {
+	testRfmlAPI
+	fakeRunsAPI
+	runTests map[int][]rainforest.RunTest
+}
+
+func (f *fakeFlakyClient) GetRunTests(runID int) ([]rainforest.RunTest, error) {
+	return f.runTests[runID], nil
+}
+
+// newFakeFlakyClient serves 5 runs. Run 5 reruns the failed tests of run 4,
+// the Checkout test was renamed after run 1 and two tests are called Search.
+func newFakeFlakyClient() *fakeFlakyClient {
+	var runs []rainforest.Run
+	for id := 5; id > 0; id-- {
+		run := rainforest.Run{}
+		run.ID = id
+		run.FrontendURL = "https://app.rainforestqa.com/runs/" + strconv.Itoa(id)
+		runs = append(runs, run)
+	}
+	results := func(login, checkout, search string) []rainforest.RunTest {
+		return []rainforest.RunTest{
+			{ID: 1, Title: "Login", Result: login},
+			{ID: 2, Title: "Checkout", Result: checkout},
+			{ID: 3, Title: "Search", Result: search},
+			{ID: 4, Title: "Search", Result: "passed"},
+		}
+	}
+	runTests := map[int][]rainforest.RunTest{
+		1: results("passed", "passed", "failed"),
+		2: results("passed", "failed", "failed"),
+		3: results("passed", "passed", "passed"),
+		4: results("passed", "failed", "passed"),
+		5: {{ID: 2, Title: "Checkout", Result: "passed"}},
+	}
+	runTests[1][1].Title = "Check out"
+
+	return &fakeFlakyClient{fakeRunsAPI: fakeRunsAPI{runs: runs}, runTests: runTests}
+}
+
+func TestRankFlakyTests(t *testing.T) {
+	client := newFakeFlakyClient()
+	flaky := rankFlakyTests(testHistories(client.runs, fetchRunTests(client, client.runs)))
+
+	var got []testHistory
+	for _, h := range flaky {
+		got = append(got, *h)
+	}
+	want := []testHistory{
+		{TestID: 2, Name: "Checkout", Runs: 4, Failures: 2, Flips: 3, FlipRate: 1, PassedOnRerun: 1, LastFailedRun: "https://app.rainforestqa.com/runs/4"},
+		{TestID: 3, Name: "Search", Runs: 4, Failures: 2, Flips: 1, FlipRate: 1.0 / 3, LastFailedRun: "https://app.rainforestqa.com/runs/2", lastPassed: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankFlakyTests returned %+v, want %+v", got, want)
+	}
+}
+
+func TestIsRerun(t *testing.T) {
+	previous := []rainforest.RunTest{{ID: 1, Result: "failed"}, {ID: 2, Result: "passed"}, {ID: 3, Result: "failed"}}
+	testCases := []struct {
+		tests []rainforest.RunTest
+		want  bool
+	}{
+		{[]rainforest.RunTest{{ID: 3}, {ID: 1}}, true},
+		{[]rainforest.RunTest{{ID: 1}, {ID: 2}}, false},
+		{[]rainforest.RunTest{{ID: 1}, {ID: 2}, {ID: 3}}, false},
+		// A filtered run of only some of the failed tests is a run of its own
+		{[]rainforest.RunTest{{ID: 1}}, false},
+		// Reruns only have the failed tests, a run adding another one isn't a rerun
+		{[]rainforest.RunTest{{ID: 1}, {ID: 3}, {ID: 4}}, false},
+		// Known misclassification: a filtered run of exactly the failed tests
+		// can't be told apart from a rerun
+		{[]rainforest.RunTest{{ID: 1, Result: "passed"}, {ID: 3, Result: "failed"}}, true},
+		{nil, false},
+	}
+	for _, tc := range testCases {
+		if got := isRerun(tc.tests, previous); got != tc.want {
+			t.Errorf("isRerun(%v) returned %v, want %v", tc.tests, got, tc.want)
+		}
+	}
+}
+
+func TestFindFlakyTests(t *testing.T) {
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	defer func(w io.Writer) { resultsOut = w }(resultsOut)
+
+	client := newFakeFlakyClient()
+	client.tests = []rainforest.RFTest{
+		{TestID: 2, Title: "Checkout", Tags: []string{"smoke"}},
+		{TestID: 3, Title: "Search"},
+		{TestID: 4, Title: "Search"},
+	}
+	var updated []*rainforest.RFTest
+	client.handleUpdateTest = func(test *rainforest.RFTest) {
+		updated = append(updated, test)
+	}
+
+	out := &bytes.Buffer{}
+	tablesOut = out
+	c := newFakeContext(map[string]interface{}{
+		"format":         "table",
+		"last":           5,
+		"environment-id": 12,
+		"tag-flaky":      5,
+		"flaky-tag":      "flaky",
+	}, cli.Args{})
+	err := findFlakyTests(c, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.limit != 5 || client.filters != (rainforest.RunFilters{State: "complete", EnvironmentID: 12}) {
+		t.Errorf("Unexpected run filters %+v and limit %v", client.filters, client.limit)
+	}
+	for _, want := range []string{"1 |       2 | Checkout", "100%", "2 |       3 | Search", "33%"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the table:\n%v", want, out.String())
+		}
+	}
+	// Only the flaky one of the Search tests is tagged
+	if len(updated) != 2 || updated[0].TestID != 2 || !reflect.DeepEqual(updated[0].Tags, []string{"smoke", "flaky"}) ||
+		updated[1].TestID != 3 || !reflect.DeepEqual(updated[1].Tags, []string{"flaky"}) {
+		t.Errorf("Unexpected updated tests %+v", updated)
+	}
+
+	out = &bytes.Buffer{}
+	resultsOut = out
+	c = newFakeContext(map[string]interface{}{"format": "json", "last": 5}, cli.Args{})
+	err = findFlakyTests(c, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flaky []testHistory
+	err = json.Unmarshal(out.Bytes(), &flaky)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flaky) != 2 || flaky[0].Name != "Checkout" || flaky[0].PassedOnRerun != 1 {
+		t.Errorf("Unexpected JSON output:\n%v", out.String())
+	}
+
+	c = newFakeContext(map[string]interface{}{"format": "table", "last": 1}, cli.Args{})
+	if err = findFlakyTests(c, client); err == nil {
+		t.Error("Expected an error for a single run")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// flattenSteps returns the steps of test with all embedded tests replaced by
+// their own steps, recursively. The first step of an expanded test takes the
+// redirect setting of the embed it replaces.
+func flattenSteps(test *rainforest.RFTest, testsByID map[string]*rainforest.RFTest, visiting map[string]bool) ([]interface{}, error) {
+	if visiting[test.RFMLID] {
+		return nil, fmt.Errorf("Circular embedded test %v", test.RFMLID)
+	}
+	visiting[test.RFMLID] = true
+	defer delete(visiting, test.RFMLID)
+
+	steps := []interface{}{}
+	for _, step := range test.Steps {
+		embed, ok := step.(rainforest.RFEmbeddedTest)
+		if !ok {
+			steps = append(steps, step)
+			continue
+		}
+
+		embedded, ok := testsByID[embed.RFMLID]
+		if !ok {
+			return nil, fmt.Errorf("%v embeds %v which could not be found", test.RFMLID, embed.RFMLID)
+		}
+		embeddedSteps, err := flattenSteps(embedded, testsByID, visiting)
+		if err != nil {
+			return nil, err
+		}
+		if len(embeddedSteps) > 0 {
+			first := embeddedSteps[0].(rainforest.RFTestStep)
+			first.Redirect = embed.Redirect
+			embeddedSteps[0] = first
+		}
+		steps = append(steps, embeddedSteps...)
+	}
+
+	return steps, nil
+}
+
+// formatRFMLTest returns the RFML file contents for test.
+func formatRFMLTest(test *rainforest.RFTest) (string, error) {
+	// The reader keeps the trailing newline of comments in the description,
+	// which would otherwise turn into an extra empty comment on every rewrite.
+	t := *test
+	t.Description = strings.TrimRight(t.Description, "\n")
+
+	var buf bytes.Buffer
+	err := rainforest.NewRFMLWriter(&buf).WriteRFMLTest(&t)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// rewriteRFMLTest writes test to path, or only prints the diff to the current
+// contents of the file when dryRun is set.
+func rewriteRFMLTest(path string, test *rainforest.RFTest, dryRun bool) error {
+	contents, err := formatRFMLTest(test)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		// Missing files show up as a diff against an empty file
+		oldContents, _ := ioutil.ReadFile(path)
+		var oldLines []string
+		if len(oldContents) > 0 {
+			oldLines = strings.Split(string(oldContents), "\n")
+		}
+		fmt.Fprint(resultsOut, unifiedDiff(path, oldLines, strings.Split(contents, "\n")))
+		return nil
+	}
+
+	err = ioutil.WriteFile(path, []byte(contents), 0666)
+	if err != nil {
+		return err
+	}
+	log.Printf("Updated %v", path)
+	return nil
+}
+
+// readRFMLSuite reads the test folder and makes sure the given files are part
+// of the returned tests, even when they live outside of the folder. It returns
+// the tests of the given files in the same order.
+func readRFMLSuite(testFolder string, files []string) ([]*rainforest.RFTest, []*rainforest.RFTest, error) {
+	suite, err := readRFMLFiles([]string{testFolder})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byPath := map[string]*rainforest.RFTest{}
+	for _, test := range suite {
+		if absPath, err := filepath.Abs(test.RFMLPath); err == nil {
+			byPath[absPath] = test
+		}
+	}
+
+	selected := make([]*rainforest.RFTest, len(files))
+	for i, file := range files {
+		absPath, err := filepath.Abs(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if test, ok := byPath[absPath]; ok {
+			selected[i] = test
+			continue
+		}
+
+		test, err := readRFMLFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		suite = append(suite, test)
+		byPath[absPath] = test
+		selected[i] = test
+	}
+
+	return suite, selected, nil
+}
+
+// flattenRFML replaces the embedded tests of the given RFML files with their
+// steps, using the local test suite to look up the embedded tests.
+func flattenRFML(c cliContext) error {
+	files := []string(c.Args())
+	if len(files) == 0 {
+		return cli.NewExitError("Specify the RFML files to flatten", 1)
+	}
+
+	suite, tests, err := readRFMLSuite(c.String("test-folder"), files)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	testsByID := rfmlTestsByID(suite)
+
+	// Flatten everything before writing so we don't leave a half done job behind
+	flattened := make([][]interface{}, len(tests))
+	for i, test := range tests {
+		flattened[i], err = flattenSteps(test, testsByID, map[string]bool{})
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	for i, test := range tests {
+		if len(embeddedRFMLIDs(test)) == 0 {
+			log.Printf("%v has no embedded tests", test.RFMLPath)
+			continue
+		}
+
+		flatTest := *test
+		flatTest.Steps = flattened[i]
+		err = rewriteRFMLTest(test.RFMLPath, &flatTest, c.Bool("dry-run"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	return nil
+}
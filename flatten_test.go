@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestFlattenSteps(t *testing.T) {
+	login := &rainforest.RFTest{RFMLID: "login", Steps: []interface{}{
+		rainforest.RFTestStep{Action: "Log in", Response: "OK?", Redirect: true},
+		rainforest.RFTestStep{Action: "Open menu", Response: "OK?", Redirect: false},
+	}}
+	cart := &rainforest.RFTest{RFMLID: "cart", Steps: []interface{}{
+		rainforest.RFEmbeddedTest{RFMLID: "login", Redirect: true},
+		rainforest.RFTestStep{Action: "Add item", Response: "OK?", Redirect: true},
+	}}
+	checkout := &rainforest.RFTest{RFMLID: "checkout", Steps: []interface{}{
+		rainforest.RFTestStep{Action: "Open", Response: "OK?", Redirect: true},
+		rainforest.RFEmbeddedTest{RFMLID: "cart", Redirect: false},
+	}}
+	testsByID := rfmlTestsByID([]*rainforest.RFTest{login, cart, checkout})
+
+	got, err := flattenSteps(checkout, testsByID, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		rainforest.RFTestStep{Action: "Open", Response: "OK?", Redirect: true},
+		rainforest.RFTestStep{Action: "Log in", Response: "OK?", Redirect: false},
+		rainforest.RFTestStep{Action: "Open menu", Response: "OK?", Redirect: false},
+		rainforest.RFTestStep{Action: "Add item", Response: "OK?", Redirect: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenSteps returned %v, want %v", got, want)
+	}
+
+	// Missing and circular embeds are errors
+	login.Steps = []interface{}{rainforest.RFEmbeddedTest{RFMLID: "checkout"}}
+	if _, err = flattenSteps(checkout, testsByID, map[string]bool{}); err == nil {
+		t.Error("Expected an error for circular embedded tests")
+	}
+	login.Steps = []interface{}{rainforest.RFEmbeddedTest{RFMLID: "missing"}}
+	if _, err = flattenSteps(checkout, testsByID, map[string]bool{}); err == nil {
+		t.Error("Expected an error for a missing embedded test")
+	}
+}
+
+func TestFlattenRFML(t *testing.T) {
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+
+	resultsOut = &bytes.Buffer{}
+	defer func() {
+		resultsOut = os.Stdout
+	}()
+
+	b5Path := filepath.Join(dir, "b/b/b5.rfml")
+	writeRFMLFile(t, b5Path, &rainforest.RFTest{
+		RFMLID:      "b5",
+		Title:       "b5",
+		Description: "a comment\n",
+		Execute:     true,
+		Steps: []interface{}{
+			rainforest.RFTestStep{Action: "Do b5", Response: "Did b5?", Redirect: true},
+		},
+	})
+
+	a1Path := filepath.Join(dir, "a/a1.rfml")
+	before, err := ioutil.ReadFile(a1Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mappings := map[string]interface{}{"test-folder": dir, "dry-run": true}
+	err = flattenRFML(newFakeContext(mappings, cli.Args{a1Path, b5Path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := resultsOut.(*bytes.Buffer).String(); !strings.Contains(diff, "-- b4\n+Do b5\n+Did b5?\n") {
+		t.Errorf("Unexpected dry run diff:\n%v", diff)
+	}
+	after, err := ioutil.ReadFile(a1Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Dry run should not have modified the file")
+	}
+
+	mappings["dry-run"] = false
+	err = flattenRFML(newFakeContext(mappings, cli.Args{a1Path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := readRFMLFile(a1Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{rainforest.RFTestStep{Action: "Do b5", Response: "Did b5?", Redirect: true}}
+	if !reflect.DeepEqual(test.Steps, want) {
+		t.Errorf("Expected a1 to be flattened to %v, got %v", want, test.Steps)
+	}
+	if !reflect.DeepEqual(test.Tags, []string{"foo", "baz"}) {
+		t.Errorf("Expected a1 to keep its tags, got %v", test.Tags)
+	}
+}
+
+func TestFormatRFMLTestKeepsDescription(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rfml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.rfml")
+	err = ioutil.WriteFile(path, []byte("#! test\n# title: Test\n# a comment\n\nDo it\nDone?\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewriting a test several times doesn't change it
+	for i := 0; i < 2; i++ {
+		test, err := readRFMLFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rewriteRFMLTest(path, test, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	test, err := readRFMLFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if test.Description != "a comment\n" {
+		t.Errorf("Unexpected description %q", test.Description)
+	}
+}
@@ -1,17 +1,71 @@
 package gitTrigger
 
 import (
-	"bytes"
-	"os/exec"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 const gitTriggerString = "@rainforest"
 
+// Commit trailers used to configure runs from commit messages
+const (
+	tagsTrailer        = "rainforest-tags"
+	browsersTrailer    = "rainforest-browsers"
+	environmentTrailer = "rainforest-environment"
+	skipTrailer        = "rainforest-skip"
+)
+
+// trailerRegex matches a "Key: value" trailer line
+var trailerRegex = regexp.MustCompile(`^([A-Za-z0-9-]+):\s*(.*)$`)
+
+// tagRegex matches the #tags of commits mentioning the trigger
+var tagRegex = regexp.MustCompile(`#([\w_-]+)`)
+
+// branchEnvVars hold the branch name on CI systems, in order of preference
+var branchEnvVars = []string{
+	"GITHUB_HEAD_REF",
+	"GITHUB_REF_NAME",
+	"CIRCLE_BRANCH",
+	"CI_COMMIT_REF_NAME",
+	"BUILD_SOURCEBRANCHNAME",
+	"TRAVIS_BRANCH",
+	"BITBUCKET_BRANCH",
+	"BRANCH_NAME",
+}
+
+// Commit is a git commit considered by the trigger
+type Commit struct {
+	SHA     string
+	Message string
+}
+
+// ShortSHA returns the abbreviated commit SHA
+func (c Commit) ShortSHA() string {
+	if len(c.SHA) > 7 {
+		return c.SHA[:7]
+	}
+	return c.SHA
+}
+
+// Subject returns the first line of the commit message
+func (c Commit) Subject() string {
+	return strings.SplitN(c.Message, "\n", 2)[0]
+}
+
 type gitTrigger struct {
 	Trigger    string
 	LastCommit string
+	// Commits in the scanned range, newest first
+	Commits []Commit
 }
 
 func NewGitTrigger() (gitTrigger, error) {
@@ -23,53 +77,300 @@ func NewGitTrigger() (gitTrigger, error) {
 	return newGit, nil
 }
 
+// NewGitTriggerForRange creates a trigger that scans all the commits in
+// commitRange (e.g. origin/master..HEAD) instead of just the latest one.
+func NewGitTriggerForRange(commitRange string) (gitTrigger, error) {
+	if commitRange == "" {
+		return NewGitTrigger()
+	}
+	newGit := gitTrigger{Trigger: gitTriggerString}
+	err := newGit.getCommits(commitRange)
+	if err != nil {
+		return gitTrigger{}, err
+	}
+	return newGit, nil
+}
+
 func (g *gitTrigger) getLatestCommit() error {
-	var out bytes.Buffer
-	cmd := exec.Command("git", "log", "-1", "--pretty=%B")
-	cmd.Stdout = &out
-	err := cmd.Run()
+	info, err := GetRepoInfo()
 	if err != nil {
 		return err
 	}
-	g.LastCommit = strings.TrimSpace(out.String())
+	g.Commits = []Commit{info.Commit}
+	g.LastCommit = info.Message
 	return nil
 }
 
-func (g *gitTrigger) GetRemote() (string, error) {
-	var out bytes.Buffer
-	cmd := exec.Command("bash", "-c", "git remote | head -n 1")
-	cmd.Stdout = &out
-	err := cmd.Run()
+// getCommits reads the commits in commitRange, newest first. Like git log,
+// "a..b" selects the commits reachable from b but not from a, and a single
+// revision selects all of its ancestors. Symmetric "a...b" ranges aren't
+// supported.
+func (g *gitTrigger) getCommits(commitRange string) error {
+	if strings.Contains(commitRange, "...") {
+		return fmt.Errorf("Unsupported commit range %v, use a..b instead", commitRange)
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return err
+	}
 
+	from, to := "", commitRange
+	if i := strings.Index(commitRange, ".."); i >= 0 {
+		from, to = commitRange[:i], commitRange[i+2:]
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+
+	excluded := map[plumbing.Hash]bool{}
+	if from != "" {
+		fromHash, err := resolveRevision(repo, from)
+		if err != nil {
+			return err
+		}
+		iter, err := repo.Log(&git.LogOptions{From: fromHash})
+		if err != nil {
+			return err
+		}
+		err = iter.ForEach(func(c *object.Commit) error {
+			excluded[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	toHash, err := resolveRevision(repo, to)
 	if err != nil {
-		return "", err
+		return err
+	}
+	iter, err := repo.Log(&git.LogOptions{From: toHash, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return err
 	}
-	remote_name := strings.TrimSpace(out.String())
 
-	out.Reset()
-	cmd.Stdout = &out
+	g.Commits = []Commit{}
+	err = iter.ForEach(func(c *object.Commit) error {
+		if !excluded[c.Hash] {
+			g.Commits = append(g.Commits, newCommit(c))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(g.Commits) > 0 {
+		g.LastCommit = g.Commits[0].Message
+	}
+	return nil
+}
 
-	cmd = exec.Command("git", "remote", "get-url", "--all", remote_name)
-	cmd.Stdout = &out
-	err = cmd.Run()
+// commits returns the scanned commits, falling back to the LastCommit message
+func (g gitTrigger) commits() []Commit {
+	if len(g.Commits) > 0 {
+		return g.Commits
+	}
+	return []Commit{{Message: g.LastCommit}}
+}
+
+// GetBranch returns the current branch name. CI systems usually check out a
+// detached HEAD, so their environment variables are used as a fallback.
+func (g gitTrigger) GetBranch() string {
+	info, err := GetRepoInfo()
+	if err != nil {
+		return branchFromEnv()
+	}
+	return info.Branch
+}
+
+// GetRemote returns the URL of the first remote, sorted by name
+func (g *gitTrigger) GetRemote() (string, error) {
+	info, err := GetRepoInfo()
 	if err != nil {
 		return "", err
 	}
+	if info.RemoteURL == "" {
+		return "", errors.New("No git remote found")
+	}
+	return info.RemoteURL, nil
+}
+
+// GetChangedFiles returns the absolute paths of the files that changed since
+// the merge base of ref and HEAD, including uncommitted changes and untracked
+// files.
+func (g gitTrigger) GetChangedFiles(ref string) ([]string, error) {
+	repo, err := openRepository()
+	if err != nil {
+		return nil, err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	root := worktree.Filesystem.Root()
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
+	refHash, err := resolveRevision(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	refCommit, err := repo.CommitObject(refHash)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	// Like git diff ref...HEAD, changes made on ref since HEAD branched off
+	// don't count
+	bases, err := refCommit.MergeBase(headCommit)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("No common ancestor of %v and HEAD", ref)
+	}
+	refTree, err := bases[0].Tree()
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(refTree, headTree)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string]bool{}
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" {
+				changed[name] = true
+			}
+		}
+	}
+
+	// Uncommitted changes, untracked files included
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+	for name, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			changed[name] = true
+		}
+	}
+
+	files := make([]string, 0, len(changed))
+	for name := range changed {
+		files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseTrailers returns the trailers ("Key: value" lines in the last
+// paragraph) of a commit message, keyed by their lowercased name. Like git,
+// the trailers need a paragraph of their own after the subject.
+func parseTrailers(message string) map[string]string {
+	trailers := map[string]string{}
+	paragraphs := strings.Split(strings.TrimSpace(strings.Replace(message, "\r\n", "\n", -1)), "\n\n")
+	if len(paragraphs) < 2 {
+		return trailers
+	}
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if match := trailerRegex.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			trailers[strings.ToLower(match[1])] = strings.TrimSpace(match[2])
+		}
+	}
+	return trailers
+}
 
-	return strings.TrimSpace(strings.Split(strings.ReplaceAll(out.String(), "\r\n", "\n"), "\n")[0]), nil
+// triggers returns true if the commit asks for a run, either by mentioning
+// the trigger or with a run option trailer.
+func (g gitTrigger) triggers(commit Commit) bool {
+	if strings.Contains(commit.Message, g.Trigger) {
+		return true
+	}
+	trailers := parseTrailers(commit.Message)
+	for _, key := range []string{tagsTrailer, browsersTrailer, environmentTrailer} {
+		if _, ok := trailers[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TriggeringCommit returns the newest commit that triggers a run, or nil.
+func (g gitTrigger) TriggeringCommit() *Commit {
+	for _, commit := range g.commits() {
+		if g.triggers(commit) {
+			commit := commit
+			return &commit
+		}
+	}
+	return nil
 }
 
 func (g gitTrigger) CheckTrigger() bool {
-	shouldTrigger := strings.Contains(g.LastCommit, g.Trigger)
-	return shouldTrigger
+	return g.TriggeringCommit() != nil
+}
+
+// Skip returns true if any of the commits has a "Rainforest-Skip: true" trailer
+func (g gitTrigger) Skip() bool {
+	for _, commit := range g.commits() {
+		if skip, err := strconv.ParseBool(parseTrailers(commit.Message)[skipTrailer]); err == nil && skip {
+			return true
+		}
+	}
+	return false
+}
+
+// optionsCommit returns the commit run options are read from: the
+// triggering commit or, if there is none, the latest one.
+func (g gitTrigger) optionsCommit() Commit {
+	if commit := g.TriggeringCommit(); commit != nil {
+		return *commit
+	}
+	return g.commits()[0]
 }
 
+// splitTrailer splits a comma or space separated trailer value
+func splitTrailer(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// GetTags returns the #tags of a commit mentioning the trigger and the tags
+// from the Rainforest-Tags trailer
 func (g gitTrigger) GetTags() []string {
-	tagRegex, _ := regexp.Compile("#([\\w_-]+)")
-	foundTags := tagRegex.FindAllString(g.LastCommit, -1)
-	strippedTags := make([]string, len(foundTags))
-	for i, tag := range foundTags {
-		strippedTags[i] = strings.Replace(tag, "#", "", 1)
+	message := g.optionsCommit().Message
+	strippedTags := []string{}
+	if strings.Contains(message, g.Trigger) {
+		for _, match := range tagRegex.FindAllStringSubmatch(message, -1) {
+			strippedTags = append(strippedTags, match[1])
+		}
 	}
-	return strippedTags
+	return append(strippedTags, splitTrailer(parseTrailers(message)[tagsTrailer])...)
+}
+
+// GetBrowsers returns the browsers from the Rainforest-Browsers trailer
+func (g gitTrigger) GetBrowsers() []string {
+	return splitTrailer(parseTrailers(g.optionsCommit().Message)[browsersTrailer])
+}
+
+// GetEnvironment returns the value of the Rainforest-Environment trailer
+func (g gitTrigger) GetEnvironment() string {
+	return parseTrailers(g.optionsCommit().Message)[environmentTrailer]
 }
@@ -2,9 +2,12 @@ package gitTrigger
 
 import (
 	"bytes"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -79,6 +82,7 @@ func makeFakeRepoWithCommit(t *testing.T, commitMsg string) {
 		deleteFakeRepo(t)
 		t.Fatal("Couldn't commit to the test repo.")
 	}
+	resetRepoInfo()
 }
 
 func addFakeGitRemote(t *testing.T, remote_name string, remote_url string) {
@@ -90,6 +94,7 @@ func addFakeGitRemote(t *testing.T, remote_name string, remote_url string) {
 	if err != nil {
 		t.Fatal("Couldn't add the remote in the test repo.")
 	}
+	resetRepoInfo()
 }
 
 func TestNewGitTrigger(t *testing.T) {
@@ -164,6 +169,73 @@ func TestGetRemoteMissing(t *testing.T) {
 	}
 }
 
+func TestGetChangedFiles(t *testing.T) {
+	fakeGit := gitTrigger{Trigger: "@rainforest"}
+	makeFakeRepoWithCommit(t, "initial")
+	defer deleteFakeRepo(t)
+
+	for _, name := range []string{"committed.rfml", "changed.rfml", "unchanged.rfml"} {
+		err := ioutil.WriteFile(name, []byte(name), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"add", "changed.rfml", "unchanged.rfml"},
+		{"commit", "-m", "base"},
+		{"tag", "base"},
+		{"checkout", "-q", "-b", "upstream"},
+		{"commit", "--allow-empty", "-m", "upstream change"},
+		{"rm", "-q", "unchanged.rfml"},
+		{"commit", "-m", "upstream removal"},
+		{"checkout", "-q", "-"},
+		{"add", "committed.rfml"},
+		{"commit", "-m", "new test"},
+	} {
+		if err := exec.Command("git", args...).Run(); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+	err := ioutil.WriteFile("changed.rfml", []byte("changed"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile("untracked.rfml", []byte("untracked"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := fakeGit.GetChangedFiles("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := os.Getwd()
+	root, _ = filepath.EvalSymlinks(root)
+	want := []string{
+		filepath.Join(root, "changed.rfml"),
+		filepath.Join(root, "committed.rfml"),
+		filepath.Join(root, "untracked.rfml"),
+	}
+	sort.Strings(files)
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("GetChangedFiles returned %v, want %v", files, want)
+	}
+
+	// Changes on the ref after branching off don't count
+	files, err = fakeGit.GetChangedFiles("upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("GetChangedFiles returned %v, want %v", files, want)
+	}
+
+	if _, err = fakeGit.GetChangedFiles("not-a-ref"); err == nil {
+		t.Error("Expected an error for an unknown ref")
+	}
+}
+
 func TestCheckTrigger(t *testing.T) {
 	fakeGit := gitTrigger{Trigger: "@rainforest"}
 	var testCases = []struct {
@@ -221,3 +293,129 @@ func TestGetTags(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTrailers(t *testing.T) {
+	message := "Fix checkout\n\nRainforest-Tags: foo: bar\nsome text\n\nSigned-off-by: Someone <someone@example.com>\r\nRainforest-Browsers: chrome, firefox\r\n"
+	want := map[string]string{
+		"signed-off-by":       "Someone <someone@example.com>",
+		"rainforest-browsers": "chrome, firefox",
+	}
+	if got := parseTrailers(message); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTrailers returned %v, want %v", got, want)
+	}
+
+	// The subject is never a trailer
+	if got := parseTrailers("Fix: checkout\nRainforest-Tags: foo"); len(got) != 0 {
+		t.Errorf("Expected no trailers in a single paragraph, got %v", got)
+	}
+}
+
+func TestTrailers(t *testing.T) {
+	fakeGit := gitTrigger{
+		Trigger: "@rainforest",
+		Commits: []Commit{
+			{SHA: "3333333333", Message: "Fix typo"},
+			{SHA: "2222222222", Message: "Add checkout\n\nFixes #123\n\nRainforest-Tags: checkout, smoke\nRainforest-Browsers: chrome firefox\nRainforest-Environment: 42"},
+			{SHA: "1111111111", Message: "Older change @rainforest #old"},
+		},
+	}
+
+	commit := fakeGit.TriggeringCommit()
+	if commit == nil || commit.SHA != "2222222222" || commit.ShortSHA() != "2222222" || commit.Subject() != "Add checkout" {
+		t.Fatalf("Unexpected triggering commit %+v", commit)
+	}
+	if !fakeGit.CheckTrigger() {
+		t.Error("Expected trailers to trigger a run")
+	}
+	if got, want := fakeGit.GetTags(), []string{"checkout", "smoke"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTags returned %v, want %v", got, want)
+	}
+	if got, want := fakeGit.GetBrowsers(), []string{"chrome", "firefox"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBrowsers returned %v, want %v", got, want)
+	}
+	if got := fakeGit.GetEnvironment(); got != "42" {
+		t.Errorf("GetEnvironment returned %v, want 42", got)
+	}
+	if fakeGit.Skip() {
+		t.Error("Expected the run not to be skipped")
+	}
+
+	fakeGit.Commits[0].Message = "Fix typo\n\nRainforest-Skip: true"
+	if !fakeGit.Skip() {
+		t.Error("Expected the run to be skipped")
+	}
+
+	fakeGit.Commits = fakeGit.Commits[:1]
+	if fakeGit.CheckTrigger() {
+		t.Error("Expected no triggering commit")
+	}
+}
+
+func TestNewGitTriggerForRange(t *testing.T) {
+	makeFakeRepoWithCommit(t, "initial")
+	defer deleteFakeRepo(t)
+
+	for _, args := range [][]string{
+		{"tag", "base"},
+		{"commit", "--allow-empty", "-m", "Trigger @rainforest #foo"},
+		{"commit", "--allow-empty", "-m", "Unrelated"},
+	} {
+		if err := exec.Command("git", args...).Run(); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+	resetRepoInfo()
+
+	git, err := NewGitTriggerForRange("base..HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(git.Commits) != 2 || git.LastCommit != "Unrelated" {
+		t.Fatalf("Unexpected commits %+v", git.Commits)
+	}
+	commit := git.TriggeringCommit()
+	if commit == nil || commit.Message != "Trigger @rainforest #foo" || len(commit.SHA) != 40 {
+		t.Errorf("Unexpected triggering commit %+v", commit)
+	}
+
+	if _, err = NewGitTriggerForRange("base...HEAD"); err == nil {
+		t.Error("Expected an error for a symmetric range")
+	}
+
+	// Without a range only the latest commit is considered
+	git, err = NewGitTriggerForRange("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if git.CheckTrigger() {
+		t.Error("Expected the latest commit not to trigger a run")
+	}
+}
+
+func TestGetBranch(t *testing.T) {
+	makeFakeRepoWithCommit(t, "initial")
+	defer deleteFakeRepo(t)
+
+	if err := exec.Command("git", "checkout", "-q", "-b", "feature/checkout").Run(); err != nil {
+		t.Fatal(err)
+	}
+	resetRepoInfo()
+	fakeGit := gitTrigger{Trigger: "@rainforest"}
+	if branch := fakeGit.GetBranch(); branch != "feature/checkout" {
+		t.Errorf("GetBranch returned %v, want feature/checkout", branch)
+	}
+
+	// Detached HEADs fall back to CI environment variables
+	if err := exec.Command("git", "checkout", "-q", "--detach").Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, envVar := range branchEnvVars {
+		defer os.Setenv(envVar, os.Getenv(envVar))
+		os.Unsetenv(envVar)
+	}
+	os.Setenv("BRANCH_NAME", "ci-branch")
+	resetRepoInfo()
+	if branch := fakeGit.GetBranch(); branch != "ci-branch" {
+		t.Errorf("GetBranch returned %v, want ci-branch", branch)
+	}
+}
@@ -0,0 +1,132 @@
+package gitTrigger
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// RepoInfo describes the checked out commit of the repository
+type RepoInfo struct {
+	Commit
+	Author      string
+	AuthorEmail string
+	// Branch is empty for a detached HEAD outside of CI
+	Branch string
+	// RemoteURL is the URL of the first remote, sorted by name, if any
+	RemoteURL string
+}
+
+var (
+	repoInfoMutex sync.Mutex
+	repoInfo      *RepoInfo
+	repoInfoErr   error
+)
+
+// GetRepoInfo returns information about the repository in the working
+// directory. It's read once and cached for the rest of the process.
+func GetRepoInfo() (RepoInfo, error) {
+	repoInfoMutex.Lock()
+	defer repoInfoMutex.Unlock()
+
+	if repoInfo == nil && repoInfoErr == nil {
+		var info RepoInfo
+		info, repoInfoErr = readRepoInfo()
+		if repoInfoErr == nil {
+			repoInfo = &info
+		}
+	}
+	if repoInfoErr != nil {
+		return RepoInfo{}, repoInfoErr
+	}
+	return *repoInfo, nil
+}
+
+// resetRepoInfo clears the cached repository information
+func resetRepoInfo() {
+	repoInfoMutex.Lock()
+	defer repoInfoMutex.Unlock()
+	repoInfo = nil
+	repoInfoErr = nil
+}
+
+func readRepoInfo() (RepoInfo, error) {
+	repo, err := openRepository()
+	if err != nil {
+		return RepoInfo{}, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return RepoInfo{}, fmt.Errorf("Couldn't read git HEAD: %v", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return RepoInfo{}, err
+	}
+
+	info := RepoInfo{
+		Commit:      newCommit(commit),
+		Author:      commit.Author.Name,
+		AuthorEmail: commit.Author.Email,
+	}
+	if head.Name().IsBranch() {
+		info.Branch = head.Name().Short()
+	} else {
+		info.Branch = branchFromEnv()
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return RepoInfo{}, err
+	}
+	sort.Slice(remotes, func(i, j int) bool {
+		return remotes[i].Config().Name < remotes[j].Config().Name
+	})
+	if len(remotes) > 0 && len(remotes[0].Config().URLs) > 0 {
+		info.RemoteURL = remotes[0].Config().URLs[0]
+	}
+
+	return info, nil
+}
+
+// openRepository opens the repository containing the working directory
+func openRepository() (*git.Repository, error) {
+	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't open git repository: %v", err)
+	}
+	return repo, nil
+}
+
+// resolveRevision resolves a branch, tag, SHA or expression such as HEAD~2
+func resolveRevision(repo *git.Repository, rev string) (plumbing.Hash, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("Unknown git revision %v: %v", rev, err)
+	}
+	return *hash, nil
+}
+
+func newCommit(c *object.Commit) Commit {
+	return Commit{SHA: c.Hash.String(), Message: strings.TrimSpace(c.Message)}
+}
+
+// branchFromEnv returns the branch name set by the CI system, if any
+func branchFromEnv() string {
+	for _, envVar := range branchEnvVars {
+		if branch := os.Getenv(envVar); branch != "" {
+			return branch
+		}
+	}
+	return ""
+}
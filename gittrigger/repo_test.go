@@ -0,0 +1,81 @@
+package gitTrigger
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGetRepoInfo(t *testing.T) {
+	makeFakeRepoWithCommit(t, "initial")
+	defer deleteFakeRepo(t)
+	if err := exec.Command("git", "commit", "--allow-empty", "-m", "Add checkout tests\n\nRainforest-Tags: checkout").Run(); err != nil {
+		t.Fatal(err)
+	}
+	addFakeGitRemote(t, "upstream", "git@github.com:rainforestapp/upstream.git")
+	addFakeGitRemote(t, "origin", "git@github.com:rainforestapp/rainforest-cli.git")
+
+	var out bytes.Buffer
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	sha := strings.TrimSpace(out.String())
+	if err := exec.Command("git", "checkout", "-q", "-b", "feature/info").Run(); err != nil {
+		t.Fatal(err)
+	}
+	resetRepoInfo()
+
+	info, err := GetRepoInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RepoInfo{
+		Commit:      Commit{SHA: sha, Message: "Add checkout tests\n\nRainforest-Tags: checkout"},
+		Author:      "Rainforest QA",
+		AuthorEmail: "test@rainforestqa.com",
+		Branch:      "feature/info",
+		RemoteURL:   "git@github.com:rainforestapp/rainforest-cli.git",
+	}
+	if info != want {
+		t.Errorf("GetRepoInfo returned %+v, want %+v", info, want)
+	}
+	if info.ShortSHA() != sha[:7] || info.Subject() != "Add checkout tests" {
+		t.Errorf("Unexpected short SHA %v or subject %v", info.ShortSHA(), info.Subject())
+	}
+
+	// The information is cached until reset
+	if err = exec.Command("git", "commit", "--allow-empty", "-m", "Another commit").Run(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ = GetRepoInfo(); info.SHA != sha {
+		t.Errorf("Expected the cached SHA %v, got %v", sha, info.SHA)
+	}
+	resetRepoInfo()
+	if info, _ = GetRepoInfo(); info.SHA == sha || info.Message != "Another commit" {
+		t.Errorf("Expected the new commit, got %+v", info.Commit)
+	}
+}
+
+func TestGetRepoInfoMissingRepo(t *testing.T) {
+	resetRepoInfo()
+	defer resetRepoInfo()
+
+	// The test runs in the gittrigger directory, move out of any repository
+	dir, err := ioutil.TempDir("", "rainforest-no-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	if _, err = GetRepoInfo(); err == nil {
+		t.Error("Expected an error outside of a git repository")
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// matrixLeg is one combination of run options in a run matrix. Empty options
+// are taken from the command line.
+type matrixLeg struct {
+	Name          string   `json:"name"`
+	EnvironmentID int      `json:"environment_id"`
+	Browsers      []string `json:"browsers"`
+	Crowd         string   `json:"crowd"`
+}
+
+// matrixResult tracks the run started for a matrix leg
+type matrixResult struct {
+	leg    matrixLeg
+	params rainforest.RunParams
+	status *rainforest.RunStatus
+	// report is nil if the JUnit results are not needed or not available
+	report   *junitReport
+	timedOut bool
+	err      error
+}
+
+// label returns the name of the leg, or a description of its options
+func (l matrixLeg) label() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	var parts []string
+	if l.EnvironmentID != 0 {
+		parts = append(parts, "environment "+strconv.Itoa(l.EnvironmentID))
+	}
+	if len(l.Browsers) > 0 {
+		parts = append(parts, strings.Join(l.Browsers, "+"))
+	}
+	if l.Crowd != "" {
+		parts = append(parts, l.Crowd)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// apply returns the run params for the leg. The leg is appended to the
+// description to tell the runs apart.
+func (l matrixLeg) apply(params rainforest.RunParams) rainforest.RunParams {
+	if l.EnvironmentID != 0 {
+		params.EnvironmentID = l.EnvironmentID
+	}
+	if len(l.Browsers) > 0 {
+		params.Browsers = expandStringSlice(l.Browsers)
+	}
+	if l.Crowd != "" {
+		params.Crowd = l.Crowd
+	}
+	if params.Description == "" {
+		params.Description = l.label()
+	} else {
+		params.Description = fmt.Sprintf("%v [%v]", params.Description, l.label())
+	}
+	return params
+}
+
+// parseMatrixLeg parses a --matrix-leg value such as
+// "name=staging environment-id=12 browser=chrome,firefox crowd=automation"
+func parseMatrixLeg(spec string) (matrixLeg, error) {
+	leg := matrixLeg{}
+	for _, field := range strings.Fields(spec) {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return matrixLeg{}, fmt.Errorf("Invalid matrix option %v, expected KEY=VALUE", field)
+		}
+		switch parts[0] {
+		case "name":
+			leg.Name = parts[1]
+		case "environment-id":
+			id, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return matrixLeg{}, fmt.Errorf("Invalid matrix environment ID %v", parts[1])
+			}
+			leg.EnvironmentID = id
+		case "browser":
+			leg.Browsers = append(leg.Browsers, parts[1])
+		case "crowd":
+			leg.Crowd = parts[1]
+		default:
+			return matrixLeg{}, fmt.Errorf("Unknown matrix option %v, use name, environment-id, browser or crowd", parts[0])
+		}
+	}
+	return leg, nil
+}
+
+// getMatrixLegs returns the legs given with --matrix-leg or, with --matrix,
+// the ones from the config file.
+func getMatrixLegs(c cliContext) ([]matrixLeg, error) {
+	var legs []matrixLeg
+	for _, spec := range c.StringSlice("matrix-leg") {
+		leg, err := parseMatrixLeg(spec)
+		if err != nil {
+			return nil, err
+		}
+		legs = append(legs, leg)
+	}
+
+	if len(legs) == 0 && c.Bool("matrix") {
+		cfg, err := loadConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(cfg.Matrix) == 0 {
+			return nil, errors.New("--matrix needs legs in the config file or given with --matrix-leg")
+		}
+		legs = cfg.Matrix
+	}
+
+	for _, leg := range legs {
+		if leg.label() == "" {
+			return nil, errors.New("Matrix legs need at least one of name, environment, browsers or crowd")
+		}
+		if !isValidCrowd(leg.Crowd) {
+			return nil, fmt.Errorf("Invalid crowd %v in matrix leg %v", leg.Crowd, leg.label())
+		}
+	}
+	return legs, nil
+}
+
+// matrixJunitFile returns the file of a leg for a JUnit report or another
+// report file, e.g. results.staging.xml for results.xml. The leg index is
+// used when the label doesn't make a unique file name.
+func matrixJunitFile(junitFile string, legs []matrixLeg, i int) string {
+	slug := func(leg matrixLeg) string {
+		return strings.Trim(sanitizeTestTitle(leg.label()), "_")
+	}
+	name := slug(legs[i])
+	for j, leg := range legs {
+		if name == "" || (j != i && slug(leg) == name) {
+			name = strconv.Itoa(i + 1)
+			break
+		}
+	}
+
+	ext := filepath.Ext(junitFile)
+	return fmt.Sprintf("%v.%v%v", strings.TrimSuffix(junitFile, ext), name, ext)
+}
+
+// runMatrix starts one run per leg, monitors them concurrently and fails if
+// any of them fails. Each run is recorded in the --state-file as soon as it
+// starts, so runs aren't lost if a later leg can't be started.
+func (r *runner) runMatrix(c cliContext, params rainforest.RunParams, legs []matrixLeg) error {
+	results := make([]matrixResult, len(legs))
+	for i, leg := range legs {
+		legParams := leg.apply(params)
+		runStatus, err := r.client.CreateRun(legParams)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Unable to start matrix leg %v: %v", leg.label(), err), 1)
+		}
+		r.runStarted(runStatus.ID)
+		log.Printf("Matrix leg %v:", leg.label())
+		r.showRunCreated(runStatus)
+		results[i] = matrixResult{leg: leg, params: legParams, status: runStatus}
+
+		if path := c.String("state-file"); path != "" {
+			err = recordStartedRuns(path, []startedRun{newStartedRun(runStatus, legParams, leg.label())})
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+		}
+	}
+
+	if c.Bool("bg") {
+		printMatrixTable(results)
+		return nil
+	}
+
+	policy, err := getRunPolicy(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	failed, outcome, err := r.monitorRuns(c, policy, results)
+	if err != nil {
+		return cli.NewExitError(err.Error(), policy.exitCodes["error"])
+	}
+	if outcome != "passed" {
+		return cli.NewExitError(fmt.Sprintf("%v of %v matrix legs failed", failed, len(results)), policy.exitCodes[outcome])
+	}
+	return nil
+}
+
+// outcomeSeverity orders the outcomes of runs, the combined outcome of
+// several runs is the most severe one
+var outcomeSeverity = map[string]int{"passed": 0, "no_result": 1, "failed": 2, "error": 3}
+
+// monitorRuns waits for the runs concurrently and prints their combined
+// status. The JUnit reports, --report-format reports, annotations and
+// notifications are done for each run, with report files named after the
+// run like its JUnit file. It returns how many of the runs didn't pass
+// according to the run policy and their combined outcome. Runs that timed
+// out or couldn't be monitored have the error outcome.
+func (r *runner) monitorRuns(c cliContext, policy *runPolicy, results []matrixResult) (int, string, error) {
+	poll, err := getPollSettings(c)
+	if err != nil {
+		return 0, "", err
+	}
+	err = policy.loadKnownIssues(r.client)
+	if err != nil {
+		return 0, "", err
+	}
+	reportOutputs, err := getReportOutputs(c)
+	if err != nil {
+		return 0, "", err
+	}
+	annotator, err := getAnnotator(c)
+	if err != nil {
+		return 0, "", err
+	}
+	notifyTargets, err := getNotifyTargets(c)
+	if err != nil {
+		return 0, "", err
+	}
+	notifyTemplate, err := getNotifyTemplate(c)
+	if err != nil {
+		return 0, "", err
+	}
+	needReport := len(reportOutputs) > 0 || annotator != nil || len(notifyTargets) > 0
+
+	legs := make([]matrixLeg, len(results))
+	for i, res := range results {
+		legs[i] = res.leg
+	}
+	junitFile := c.String("junit-file")
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res := &results[i]
+			runID := res.status.ID
+			status, err := pollRunStatus(r.client, runID, policy, res.leg.label()+": ", poll)
+			if err == errRunTimeout {
+				r.handleRunTimeout(c, runID, poll)
+				res.timedOut = true
+				res.err = fmt.Errorf("timed out after %v", poll.timeout)
+			} else if err != nil {
+				res.err = err
+				return
+			}
+			if status != nil {
+				res.status = status
+				if status.StateDetails.IsFinalState {
+					r.runDone(runID)
+				}
+			}
+			if junitFile != "" || needReport {
+				legJunitFile := ""
+				if junitFile != "" {
+					legJunitFile = matrixJunitFile(junitFile, legs, i)
+				}
+				res.report, err = fetchRunResults(r.client, runID, legJunitFile)
+				if err != nil {
+					log.Printf("%v: Unable to get the JUnit report of run %v: %v", res.leg.label(), runID, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	printMatrixTable(results)
+
+	failed := 0
+	combined := "passed"
+	for i, res := range results {
+		outcome := "error"
+		if res.err != nil {
+			log.Printf("%v: %v", res.leg.label(), res.err)
+		} else {
+			outcome, err = policy.outcome(r.client, res.status)
+			if err != nil {
+				log.Printf("%v: %v", res.leg.label(), err)
+				outcome = "error"
+			}
+		}
+		if outcome != "passed" {
+			failed++
+		}
+		if outcomeSeverity[outcome] > outcomeSeverity[combined] {
+			combined = outcome
+		}
+		if needReport && (res.err == nil || res.timedOut) {
+			r.reportLeg(c, res, outcome == "passed", legOutputs(reportOutputs, legs, i), annotator, notifyTargets, notifyTemplate)
+		}
+	}
+	return failed, combined, nil
+}
+
+// legOutputs returns the report outputs of a leg, with the files named after
+// the leg
+func legOutputs(outputs []reportOutput, legs []matrixLeg, i int) []reportOutput {
+	legOutputs := make([]reportOutput, len(outputs))
+	for j, output := range outputs {
+		if output.path != "" {
+			output.path = matrixJunitFile(output.path, legs, i)
+		}
+		legOutputs[j] = output
+	}
+	return legOutputs
+}
+
+// reportLeg writes the reports, annotations and notifications of a finished
+// leg. Failures are only logged, they don't fail the leg.
+func (r *runner) reportLeg(c cliContext, res matrixResult, passed bool, outputs []reportOutput, a annotator,
+	targets []notifyTarget, tmpl *template.Template) {
+	report := &runReport{status: res.status, junit: res.report}
+	if len(targets) > 0 {
+		sendNotifications(targets, tmpl, newRunNotification(report, res.timedOut))
+	}
+	err := writeReports(outputs, report)
+	if err != nil {
+		log.Printf("%v: %v", res.leg.label(), err)
+	}
+	if a != nil && !passed {
+		annotateFailedTests(a, r.client, report, rfmlSources(c))
+	}
+}
+
+// printMatrixTable prints the combined status of the matrix runs
+func printMatrixTable(results []matrixResult) {
+	rows := make([][]string, len(results))
+	for i, res := range results {
+		environment := "default"
+		if res.params.EnvironmentID != 0 {
+			environment = strconv.Itoa(res.params.EnvironmentID)
+		}
+		crowd := res.params.Crowd
+		if crowd == "" {
+			crowd = "default"
+		}
+		status := res.status
+		rows[i] = []string{
+			res.leg.label(),
+			strconv.Itoa(status.ID),
+			environment,
+			strings.Join(res.params.Browsers, ", "),
+			crowd,
+			status.State,
+			status.Result,
+			strconv.Itoa(status.CurrentProgress.Passed),
+			strconv.Itoa(status.CurrentProgress.Failed),
+			status.FrontendURL,
+		}
+	}
+	printResourceTable([]string{"Name", "Run ID", "Environment", "Browsers", "Crowd", "State", "Result", "Passed", "Failed", "URL"}, rows)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// fakeMatrixClient starts runs with increasing IDs that finish with the
+// result set for their environment
+type fakeMatrixClient struct {
+	fakeRunnerClient
+	results map[int]string
+	created []rainforest.RunParams
+	// maxRuns fails starting more runs, if set
+	maxRuns int
+}
+
+func (f *fakeMatrixClient) CreateRun(p rainforest.RunParams) (*rainforest.RunStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxRuns > 0 && len(f.created) >= f.maxRuns {
+		return nil, errors.New("too many runs")
+	}
+	f.created = append(f.created, p)
+	return &rainforest.RunStatus{ID: 100 + len(f.created), State: "queued"}, nil
+}
+
+func (f *fakeMatrixClient) CheckRunStatus(runID int) (*rainforest.RunStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := &rainforest.RunStatus{ID: runID, State: "complete", Result: f.results[f.created[runID-101].EnvironmentID]}
+	status.StateDetails.IsFinalState = true
+	return status, nil
+}
+
+func TestParseMatrixLeg(t *testing.T) {
+	leg, err := parseMatrixLeg("name=staging environment-id=12 browser=chrome,firefox crowd=automation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := matrixLeg{Name: "staging", EnvironmentID: 12, Browsers: []string{"chrome,firefox"}, Crowd: "automation"}
+	if !reflect.DeepEqual(leg, want) {
+		t.Errorf("parseMatrixLeg returned %+v, want %+v", leg, want)
+	}
+
+	for _, spec := range []string{"environment-id=abc", "region=eu", "name"} {
+		if _, err = parseMatrixLeg(spec); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+}
+
+func TestGetMatrixLegs(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"matrix": [
+			{"name": "staging", "environment_id": 12},
+			{"environment_id": 13, "browsers": ["chrome"], "crowd": "automation"}
+		]
+	}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	c := newFakeContext(map[string]interface{}{"config": path, "matrix": true}, cli.Args{})
+	legs, err := getMatrixLegs(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(legs) != 2 || legs[0].label() != "staging" || legs[1].label() != "environment 13, chrome, automation" {
+		t.Errorf("Unexpected legs %+v", legs)
+	}
+
+	// Legs from the command line replace the config
+	c = newFakeContext(map[string]interface{}{"config": path, "matrix-leg": []string{"crowd=default"}}, cli.Args{})
+	legs, err = getMatrixLegs(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(legs, []matrixLeg{{Crowd: "default"}}) {
+		t.Errorf("Unexpected legs %+v", legs)
+	}
+
+	// No matrix
+	c = newFakeContext(map[string]interface{}{"config": path}, cli.Args{})
+	if legs, err = getMatrixLegs(c); err != nil || legs != nil {
+		t.Errorf("Expected no legs, got %+v, %v", legs, err)
+	}
+
+	c = newFakeContext(map[string]interface{}{"matrix-leg": []string{"crowd=everyone"}}, cli.Args{})
+	if _, err = getMatrixLegs(c); err == nil {
+		t.Error("Expected an error for an invalid crowd")
+	}
+}
+
+func TestMatrixJunitFile(t *testing.T) {
+	legs := []matrixLeg{{Name: "Staging EU"}, {EnvironmentID: 13}, {Name: "dup"}, {Name: "dup"}}
+	want := []string{"out/results.staging_eu.xml", "out/results.environment_13.xml", "out/results.3.xml", "out/results.4.xml"}
+	for i := range legs {
+		if got := matrixJunitFile("out/results.xml", legs, i); got != want[i] {
+			t.Errorf("matrixJunitFile returned %v, want %v", got, want[i])
+		}
+	}
+}
+
+func TestStartMatrixRun(t *testing.T) {
+	defer func(d time.Duration) { runStatusPollInterval = d }(runStatusPollInterval)
+	runStatusPollInterval = time.Millisecond
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+
+	dir, err := ioutil.TempDir("", "rainforest-matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, failPreprod := range []bool{false, true} {
+		out := &bytes.Buffer{}
+		tablesOut = out
+		client := &fakeMatrixClient{results: map[int]string{12: "passed", 13: "passed"}}
+		if failPreprod {
+			client.results[13] = "failed"
+		}
+		r := newRunner()
+		r.client = client
+
+		c := newFakeContext(map[string]interface{}{
+			"tag":         []string{"smoke"},
+			"description": "Nightly",
+			"browser":     []string{"chrome"},
+			"junit-file":  filepath.Join(dir, "results.xml"),
+			"matrix-leg":  []string{"name=staging environment-id=12", "name=preprod environment-id=13 browser=firefox crowd=automation"},
+		}, cli.Args{})
+		err = r.startRun(c)
+		if failPreprod {
+			if err == nil || !strings.Contains(err.Error(), "1 of 2 matrix legs failed") {
+				t.Errorf("Expected the matrix to fail, got %v", err)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []rainforest.RunParams{
+			{Tags: []string{"smoke"}, Browsers: []string{"chrome"}, Description: "Nightly [staging]", EnvironmentID: 12},
+			{Tags: []string{"smoke"}, Browsers: []string{"firefox"}, Crowd: "automation", Description: "Nightly [preprod]", EnvironmentID: 13},
+		}
+		if !reflect.DeepEqual(client.created, want) {
+			t.Errorf("Unexpected runs %+v, want %+v", client.created, want)
+		}
+
+		for i, name := range []string{"results.staging.xml", "results.preprod.xml"} {
+			xml, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(xml), strconv.Itoa(101+i)) {
+				t.Errorf("Unexpected JUnit report in %v: %s", name, xml)
+			}
+		}
+
+		table := out.String()
+		if !strings.Contains(table, "staging") || !strings.Contains(table, "preprod") || strings.Contains(table, "failed") != failPreprod {
+			t.Errorf("Unexpected matrix table:\n%v", table)
+		}
+	}
+}
+
+func TestStartMatrixRunReports(t *testing.T) {
+	defer func(d time.Duration) { runStatusPollInterval = d }(runStatusPollInterval)
+	runStatusPollInterval = time.Millisecond
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	tablesOut = &bytes.Buffer{}
+
+	dir, err := ioutil.TempDir("", "rainforest-matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := newRunner()
+	r.client = &fakeMatrixClient{results: map[int]string{12: "passed", 13: "failed"}}
+	c := newFakeContext(map[string]interface{}{
+		"report-format": []string{"json=" + filepath.Join(dir, "report.json")},
+		"matrix-leg":    []string{"name=staging environment-id=12", "name=preprod environment-id=13"},
+	}, cli.Args{})
+	if err = r.startRun(c); err == nil {
+		t.Error("Expected the matrix to fail")
+	}
+	for _, name := range []string{"report.staging.json", "report.preprod.json"} {
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %v to be written: %v", name, err)
+		}
+	}
+}
+
+func TestStartMatrixRunStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainforest-matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "runs.json")
+
+	r := newRunner()
+	r.client = &fakeMatrixClient{maxRuns: 1}
+	c := newFakeContext(map[string]interface{}{
+		"state-file": path,
+		"matrix-leg": []string{"name=staging environment-id=12", "name=preprod environment-id=13"},
+	}, cli.Args{})
+	if err = r.startRun(c); err == nil || !strings.Contains(err.Error(), "preprod") {
+		t.Errorf("Expected the second leg not to start, got %v", err)
+	}
+
+	// The leg that did start can still be waited for
+	runs, err := readStartedRuns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != 101 || runs[0].Name != "staging" {
+		t.Errorf("Unexpected recorded runs %+v", runs)
+	}
+}
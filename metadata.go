@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/rainforestapp/rainforest-cli/gittrigger"
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/ukd1/go.detectci"
+)
+
+// Templates used by run --auto-metadata when the config file has none
+const (
+	defaultReleaseTemplate     = "{{.SHA}}"
+	defaultDescriptionTemplate = "{{.CommitTitle}}" +
+		"{{if .Branch}} on {{.Branch}}{{end}}" +
+		"{{if .PullRequest}} (PR #{{.PullRequest}}){{end}}" +
+		"{{if .JobURL}} - {{.JobURL}}{{end}}"
+)
+
+// runMetadata describes the CI job and commit a run is started from. Its
+// fields are available to the auto_metadata templates of the config file.
+type runMetadata struct {
+	CI          string
+	Branch      string
+	SHA         string
+	ShortSHA    string
+	Author      string
+	CommitTitle string
+	PullRequest string
+	JobURL      string
+}
+
+// getRepoInfo returns information about the checked out commit
+var getRepoInfo = gitTrigger.GetRepoInfo
+
+// whichCI returns the name of the CI system the CLI runs on, if any
+var whichCI = detectci.WhichCI
+
+// ciSHAEnvVars hold the commit SHA on CI systems, used when the repository
+// can't be read
+var ciSHAEnvVars = []string{
+	"GITHUB_SHA",
+	"CIRCLE_SHA1",
+	"CI_COMMIT_SHA",
+	"BUILD_SOURCEVERSION",
+	"TRAVIS_COMMIT",
+	"BUILDKITE_COMMIT",
+	"GIT_COMMIT",
+}
+
+// collectRunMetadata gathers the metadata from the git repository and the
+// environment variables of the detected CI system.
+func collectRunMetadata() runMetadata {
+	meta := runMetadata{}
+	if found, ciName := whichCI(); found {
+		meta.CI = ciName
+		meta.PullRequest, meta.JobURL = ciJobInfo(ciName)
+	}
+
+	repo, err := getRepoInfo()
+	if err == nil {
+		meta.Branch = repo.Branch
+		meta.SHA = repo.SHA
+		meta.Author = repo.Author
+		meta.CommitTitle = repo.Subject()
+	} else {
+		log.Printf("Couldn't read git metadata: %v", err)
+		for _, envVar := range ciSHAEnvVars {
+			if sha := os.Getenv(envVar); sha != "" {
+				meta.SHA = sha
+				break
+			}
+		}
+	}
+	meta.ShortSHA = gitTrigger.Commit{SHA: meta.SHA}.ShortSHA()
+
+	return meta
+}
+
+var pullRequestRefRegex = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+// ciJobInfo returns the pull request number and job URL of the CI system
+// named by detectci, when it exposes them.
+func ciJobInfo(ciName string) (pullRequest string, jobURL string) {
+	switch ciName {
+	case "github-actions":
+		if match := pullRequestRefRegex.FindStringSubmatch(os.Getenv("GITHUB_REF")); match != nil {
+			pullRequest = match[1]
+		}
+		if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+			server := os.Getenv("GITHUB_SERVER_URL")
+			if server == "" {
+				server = "https://github.com"
+			}
+			jobURL = server + "/" + os.Getenv("GITHUB_REPOSITORY") + "/actions/runs/" + runID
+		}
+	case "circle-ci":
+		pullRequest = os.Getenv("CIRCLE_PR_NUMBER")
+		if pr := os.Getenv("CIRCLE_PULL_REQUEST"); pullRequest == "" && pr != "" {
+			pullRequest = pr[strings.LastIndex(pr, "/")+1:]
+		}
+		jobURL = os.Getenv("CIRCLE_BUILD_URL")
+	case "gitlab":
+		pullRequest = os.Getenv("CI_MERGE_REQUEST_IID")
+		jobURL = os.Getenv("CI_JOB_URL")
+	case "azure-pipelines":
+		pullRequest = os.Getenv("SYSTEM_PULLREQUEST_PULLREQUESTNUMBER")
+		if buildID := os.Getenv("BUILD_BUILDID"); buildID != "" {
+			jobURL = strings.TrimSuffix(os.Getenv("SYSTEM_TEAMFOUNDATIONCOLLECTIONURI"), "/") + "/" +
+				os.Getenv("SYSTEM_TEAMPROJECT") + "/_build/results?buildId=" + buildID
+		}
+	case "travis-ci":
+		pullRequest = os.Getenv("TRAVIS_PULL_REQUEST")
+		jobURL = os.Getenv("TRAVIS_JOB_WEB_URL")
+	case "buildkite":
+		pullRequest = os.Getenv("BUILDKITE_PULL_REQUEST")
+		jobURL = os.Getenv("BUILDKITE_BUILD_URL")
+	case "jenkins":
+		pullRequest = os.Getenv("CHANGE_ID")
+		jobURL = os.Getenv("BUILD_URL")
+	}
+
+	// Travis and Buildkite set "false" outside of pull requests
+	if pullRequest == "false" {
+		pullRequest = ""
+	}
+	return pullRequest, jobURL
+}
+
+// renderMetadata executes a metadata template
+func renderMetadata(text string, meta runMetadata) (string, error) {
+	tmpl, err := template.New("metadata").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, meta)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// applyAutoMetadata fills the release and description of the run from the
+// CI and git metadata, unless they were given on the command line.
+func applyAutoMetadata(c cliContext, params *rainforest.RunParams) error {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	releaseTemplate := cfg.AutoMetadata.Release
+	if releaseTemplate == "" {
+		releaseTemplate = defaultReleaseTemplate
+	}
+	descriptionTemplate := cfg.AutoMetadata.Description
+	if descriptionTemplate == "" {
+		descriptionTemplate = defaultDescriptionTemplate
+	}
+
+	meta := collectRunMetadata()
+	if params.Release == "" {
+		params.Release, err = renderMetadata(releaseTemplate, meta)
+		if err != nil {
+			return err
+		}
+	}
+	if params.Description == "" {
+		params.Description, err = renderMetadata(descriptionTemplate, meta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
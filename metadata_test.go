@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/gittrigger"
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func setEnv(env map[string]string) func() {
+	old := map[string]*string{}
+	for key, value := range env {
+		if prev, ok := os.LookupEnv(key); ok {
+			old[key] = &prev
+		} else {
+			old[key] = nil
+		}
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, prev := range old {
+			if prev == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *prev)
+			}
+		}
+	}
+}
+
+func TestCIJobInfo(t *testing.T) {
+	testCases := []struct {
+		ci              string
+		env             map[string]string
+		wantPullRequest string
+		wantJobURL      string
+	}{
+		{
+			ci: "github-actions",
+			env: map[string]string{
+				"GITHUB_REF":        "refs/pull/42/merge",
+				"GITHUB_SERVER_URL": "https://github.com",
+				"GITHUB_REPOSITORY": "rainforestapp/rainforest-cli",
+				"GITHUB_RUN_ID":     "1234",
+			},
+			wantPullRequest: "42",
+			wantJobURL:      "https://github.com/rainforestapp/rainforest-cli/actions/runs/1234",
+		},
+		{
+			ci: "circle-ci",
+			env: map[string]string{
+				"CIRCLE_PR_NUMBER":    "",
+				"CIRCLE_PULL_REQUEST": "https://github.com/rainforestapp/rainforest-cli/pull/7",
+				"CIRCLE_BUILD_URL":    "https://circleci.com/gh/rainforestapp/rainforest-cli/99",
+			},
+			wantPullRequest: "7",
+			wantJobURL:      "https://circleci.com/gh/rainforestapp/rainforest-cli/99",
+		},
+		{
+			ci: "azure-pipelines",
+			env: map[string]string{
+				"SYSTEM_PULLREQUEST_PULLREQUESTNUMBER": "",
+				"SYSTEM_TEAMFOUNDATIONCOLLECTIONURI":   "https://dev.azure.com/rainforest/",
+				"SYSTEM_TEAMPROJECT":                   "cli",
+				"BUILD_BUILDID":                        "5",
+			},
+			wantJobURL: "https://dev.azure.com/rainforest/cli/_build/results?buildId=5",
+		},
+		{
+			ci:         "travis-ci",
+			env:        map[string]string{"TRAVIS_PULL_REQUEST": "false", "TRAVIS_JOB_WEB_URL": "https://travis-ci.com/job/1"},
+			wantJobURL: "https://travis-ci.com/job/1",
+		},
+		{
+			ci: "unknown",
+		},
+	}
+
+	for _, tc := range testCases {
+		restore := setEnv(tc.env)
+		pullRequest, jobURL := ciJobInfo(tc.ci)
+		restore()
+		if pullRequest != tc.wantPullRequest || jobURL != tc.wantJobURL {
+			t.Errorf("ciJobInfo(%v) returned %q, %q, want %q, %q", tc.ci, pullRequest, jobURL, tc.wantPullRequest, tc.wantJobURL)
+		}
+	}
+}
+
+func TestApplyAutoMetadata(t *testing.T) {
+	defer func(f func() (gitTrigger.RepoInfo, error)) { getRepoInfo = f }(getRepoInfo)
+	defer func(f func() (bool, string)) { whichCI = f }(whichCI)
+	getRepoInfo = func() (gitTrigger.RepoInfo, error) {
+		return gitTrigger.RepoInfo{
+			Commit: gitTrigger.Commit{SHA: "abcdef1234567890", Message: "Fix checkout\n\nLonger explanation"},
+			Author: "Rainforest QA",
+			Branch: "feature/checkout",
+		}, nil
+	}
+	whichCI = func() (bool, string) { return true, "gitlab" }
+	defer setEnv(map[string]string{
+		"CI_MERGE_REQUEST_IID": "12",
+		"CI_JOB_URL":           "https://gitlab.com/rainforest/cli/-/jobs/3",
+	})()
+
+	// Default templates
+	c := newFakeContext(map[string]interface{}{"config": ""}, cli.Args{})
+	params := rainforest.RunParams{}
+	err := applyAutoMetadata(c, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rainforest.RunParams{
+		Release:     "abcdef1234567890",
+		Description: "Fix checkout on feature/checkout (PR #12) - https://gitlab.com/rainforest/cli/-/jobs/3",
+	}
+	if params.Release != want.Release || params.Description != want.Description {
+		t.Errorf("applyAutoMetadata set %q, %q, want %q, %q", params.Release, params.Description, want.Release, want.Description)
+	}
+
+	// Templates from the config file, explicit values are kept
+	path := writeConfigFile(t, `{
+		"auto_metadata": {
+			"release": "{{.Branch}} @ {{.ShortSHA}}",
+			"description": "{{.CI}} by {{.Author}}"
+		}
+	}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	c = newFakeContext(map[string]interface{}{"config": path}, cli.Args{})
+	params = rainforest.RunParams{Description: "explicit"}
+	err = applyAutoMetadata(c, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Release != "feature/checkout @ abcdef1" || params.Description != "explicit" {
+		t.Errorf("applyAutoMetadata set %q, %q", params.Release, params.Description)
+	}
+
+	// Without a repository the SHA comes from the CI environment
+	getRepoInfo = func() (gitTrigger.RepoInfo, error) { return gitTrigger.RepoInfo{}, errors.New("no repo") }
+	defer setEnv(map[string]string{"GITHUB_SHA": "", "CIRCLE_SHA1": "", "CI_COMMIT_SHA": "1234567890abcdef"})()
+	params = rainforest.RunParams{}
+	err = applyAutoMetadata(c, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Release != "@ 1234567" {
+		t.Errorf("applyAutoMetadata set release %q", params.Release)
+	}
+}
+
+func TestLoadConfigInvalidTemplate(t *testing.T) {
+	for _, contents := range []string{
+		`{"auto_metadata": {"release": "{{.Branch"}}`,
+		`{"auto_metadata": {"description": "{{.Unknown}}"}}`,
+	} {
+		path := writeConfigFile(t, contents)
+		defer os.RemoveAll(filepath.Dir(path))
+		_, err := loadConfig(newFakeContext(map[string]interface{}{"config": path}, cli.Args{}))
+		if err == nil {
+			t.Errorf("Expected an error for %v", contents)
+		}
+	}
+}
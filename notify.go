@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// notifyTarget is a --notify destination, e.g. slack=https://hooks.slack.com/...
+type notifyTarget struct {
+	kind string
+	url  string
+}
+
+// notifyKinds are the supported kinds of --notify destinations
+var notifyKinds = map[string]bool{"slack": true, "teams": true, "webhook": true}
+
+// defaultNotifyTemplate is the message sent unless --notify-template is given
+const defaultNotifyTemplate = `Rainforest run {{.RunID}} {{if .Result}}{{.Result}}{{else}}{{.State}}{{end}}: ` +
+	`{{.Passed}} passed, {{.Failed}} failed, {{.NoResult}} no result` +
+	`{{if .TimedOut}} (timed out){{end}}` +
+	`{{range .FailedTests}}
+- {{.}}{{end}}{{if .URL}}
+{{.URL}}{{end}}`
+
+// runNotification is the summary of a finished run. Custom templates use its
+// fields, and generic webhooks receive it as JSON.
+type runNotification struct {
+	RunID       int      `json:"run_id"`
+	State       string   `json:"state"`
+	Result      string   `json:"result"`
+	Total       int      `json:"total"`
+	Passed      int      `json:"passed"`
+	Failed      int      `json:"failed"`
+	NoResult    int      `json:"no_result"`
+	FailedTests []string `json:"failed_tests"`
+	URL         string   `json:"url"`
+	TimedOut    bool     `json:"timed_out"`
+	Message     string   `json:"message"`
+}
+
+// notifyClient is used to post notifications. Slow destinations shouldn't hold
+// up the build.
+var notifyClient = &http.Client{Timeout: 30 * time.Second}
+
+// getNotifyTargets reads the --notify options
+func getNotifyTargets(c cliContext) ([]notifyTarget, error) {
+	var targets []notifyTarget
+	for _, value := range c.StringSlice("notify") {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || !notifyKinds[parts[0]] {
+			return nil, fmt.Errorf("Invalid notification %v, use slack=URL, teams=URL or webhook=URL", value)
+		}
+		u, err := url.Parse(parts[1])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("Invalid %v notification URL %v", parts[0], parts[1])
+		}
+		targets = append(targets, notifyTarget{kind: parts[0], url: parts[1]})
+	}
+	return targets, nil
+}
+
+// getNotifyTemplate reads the --notify-template option
+func getNotifyTemplate(c cliContext) (*template.Template, error) {
+	text := c.String("notify-template")
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+	tmpl, err := template.New("notification").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --notify-template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// newRunNotification summarizes the report of a finished run
+func newRunNotification(report *runReport, timedOut bool) *runNotification {
+	status := report.status
+	n := &runNotification{
+		RunID:       status.ID,
+		State:       status.State,
+		Result:      status.Result,
+		Total:       status.CurrentProgress.Total,
+		Passed:      status.CurrentProgress.Passed,
+		Failed:      status.CurrentProgress.Failed,
+		NoResult:    status.CurrentProgress.NoResult,
+		FailedTests: []string{},
+		URL:         status.FrontendURL,
+		TimedOut:    timedOut,
+	}
+	for _, test := range report.tests() {
+		if test.Result == "failed" {
+			n.FailedTests = append(n.FailedTests, test.Name)
+		}
+	}
+	return n
+}
+
+// notificationPayload returns the JSON body to post to the target
+func notificationPayload(target notifyTarget, n *runNotification) ([]byte, error) {
+	switch target.kind {
+	case "slack", "teams":
+		// Both take a plain text message in their incoming webhooks
+		return json.Marshal(map[string]string{"text": n.Message})
+	default:
+		return json.Marshal(n)
+	}
+}
+
+// sendNotifications posts the summary of the run to all the targets. Errors
+// are logged only, a failed notification doesn't fail the run.
+func sendNotifications(targets []notifyTarget, tmpl *template.Template, n *runNotification) {
+	var message bytes.Buffer
+	err := tmpl.Execute(&message, n)
+	if err != nil {
+		log.Printf("Unable to write the notification: %v", err)
+		return
+	}
+	n.Message = message.String()
+
+	for _, target := range targets {
+		err = sendNotification(target, n)
+		if err != nil {
+			log.Printf("Unable to send the %v notification: %v", target.kind, err)
+			continue
+		}
+		log.Printf("Sent the %v notification", target.kind)
+	}
+}
+
+func sendNotification(target notifyTarget, n *runNotification) error {
+	payload, err := notificationPayload(target, n)
+	if err != nil {
+		return err
+	}
+	res, err := notifyClient.Post(target.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%v %v", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
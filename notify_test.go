@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// notifyServer is a local stand-in for the notification endpoints that
+// records the bodies it receives by path
+type notifyServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies map[string][]byte
+}
+
+func newNotifyServer(status int) *notifyServer {
+	s := &notifyServer{bodies: map[string][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		s.bodies[r.URL.Path] = body
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func TestGetNotifyTargets(t *testing.T) {
+	c := newFakeContext(map[string]interface{}{
+		"notify": []string{"slack=https://hooks.slack.com/services/T0/B0/x", "webhook=http://localhost:8080/hook"},
+	}, cli.Args{})
+	targets, err := getNotifyTargets(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []notifyTarget{
+		{kind: "slack", url: "https://hooks.slack.com/services/T0/B0/x"},
+		{kind: "webhook", url: "http://localhost:8080/hook"},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("getNotifyTargets returned %+v, want %+v", targets, want)
+	}
+
+	for _, value := range []string{"email=me@example.com", "slack", "teams=hooks.example.com"} {
+		c = newFakeContext(map[string]interface{}{"notify": []string{value}}, cli.Args{})
+		if _, err = getNotifyTargets(c); err == nil {
+			t.Errorf("Expected an error for %v", value)
+		}
+	}
+
+	c = newFakeContext(map[string]interface{}{"notify-template": "{{.Result"}, cli.Args{})
+	if _, err = getNotifyTemplate(c); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
+
+func TestSendNotifications(t *testing.T) {
+	server := newNotifyServer(http.StatusOK)
+	defer server.Close()
+
+	status := &rainforest.RunStatus{ID: 12, State: "complete", Result: "failed", FrontendURL: "https://app.rainforestqa.com/runs/12"}
+	status.CurrentProgress.Total = 3
+	status.CurrentProgress.Passed = 1
+	status.CurrentProgress.Failed = 2
+	junit, err := parseJunitReport(junitReportXML(12, []string{"Login"}, []string{"Checkout", "Search"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := newRunNotification(&runReport{status: status, junit: junit}, false)
+	if want := []string{"Checkout", "Search"}; !reflect.DeepEqual(n.FailedTests, want) {
+		t.Errorf("Expected failed tests %v, got %v", want, n.FailedTests)
+	}
+
+	c := newFakeContext(map[string]interface{}{}, cli.Args{})
+	tmpl, err := getNotifyTemplate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := []notifyTarget{
+		{kind: "slack", url: server.URL + "/slack"},
+		{kind: "teams", url: server.URL + "/teams"},
+		{kind: "webhook", url: server.URL + "/webhook"},
+	}
+	sendNotifications(targets, tmpl, n)
+
+	wantMessage := "Rainforest run 12 failed: 1 passed, 2 failed, 0 no result\n- Checkout\n- Search\nhttps://app.rainforestqa.com/runs/12"
+	for _, path := range []string{"/slack", "/teams"} {
+		var payload map[string]string
+		err = json.Unmarshal(server.bodies[path], &payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload["text"] != wantMessage {
+			t.Errorf("%v: got message %q, want %q", path, payload["text"], wantMessage)
+		}
+	}
+	var payload runNotification
+	err = json.Unmarshal(server.bodies["/webhook"], &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.RunID != 12 || payload.Result != "failed" || payload.Failed != 2 || payload.Message != wantMessage {
+		t.Errorf("Unexpected webhook payload: %+v", payload)
+	}
+
+	c = newFakeContext(map[string]interface{}{"notify-template": "{{.RunID}} {{len .FailedTests}}"}, cli.Args{})
+	tmpl, err = getNotifyTemplate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendNotifications(targets[:1], tmpl, n)
+	if got := string(server.bodies["/slack"]); got != `{"text":"12 2"}` {
+		t.Errorf("Unexpected custom message %v", got)
+	}
+}
+
+func TestMonitorRunStatusNotify(t *testing.T) {
+	for _, serverStatus := range []int{http.StatusOK, http.StatusInternalServerError} {
+		server := newNotifyServer(serverStatus)
+		r := newRunner()
+		r.client = &fakeRerunClient{
+			results: map[int]string{100: "passed"},
+			reports: map[int]string{100: junitReportXML(100, []string{"Login"}, nil)},
+		}
+		c := newFakeContext(map[string]interface{}{
+			"notify": []string{"webhook=" + server.URL + "/webhook"},
+		}, cli.Args{})
+
+		// Notifications that can't be sent don't fail the run
+		err := r.monitorRunStatus(c, 100)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", serverStatus, err)
+		}
+		if body := string(server.bodies["/webhook"]); !strings.Contains(body, `"result":"passed"`) {
+			t.Errorf("%v: unexpected notification %v", serverStatus, body)
+		}
+		server.Close()
+	}
+
+	// Nor do unreachable destinations
+	server := newNotifyServer(http.StatusOK)
+	server.Close()
+	r := newRunner()
+	r.client = &fakeRerunClient{results: map[int]string{100: "passed"}, reports: map[int]string{100: "<testsuites/>"}}
+	c := newFakeContext(map[string]interface{}{"notify": []string{"slack=" + server.URL}}, cli.Args{})
+	if err := r.monitorRunStatus(c, 100); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+// runPolicy decides when a run fails and with which exit code
+type runPolicy struct {
+	failFast bool
+	// maxFailures is the number of failures tolerated, or the percentage of
+	// the tests of the run if maxFailuresPercent is set
+	maxFailures        float64
+	maxFailuresPercent bool
+	// Failures of the tests tagged knownIssueTag don't count. The IDs of the
+	// tests are set by loadKnownIssues.
+	knownIssueTag string
+	knownIssues   map[int]bool
+	// noResult is pass, fail or warn
+	noResult  string
+	exitCodes map[string]int
+}
+
+// exitCodeKinds are the outcomes that can be given an exit code
+var exitCodeKinds = []string{"failed", "no_result", "error"}
+
+// getRunPolicy reads the --fail-fast, --failure-threshold, --known-issue-tag,
+// --no-result and --exit-code options
+func getRunPolicy(c cliContext) (*runPolicy, error) {
+	p := &runPolicy{
+		failFast:      c.Bool("fail-fast"),
+		knownIssueTag: c.String("known-issue-tag"),
+		noResult:      c.String("no-result"),
+		exitCodes:     map[string]int{},
+	}
+	for _, kind := range exitCodeKinds {
+		p.exitCodes[kind] = 1
+	}
+
+	if value := c.String("failure-threshold"); value != "" {
+		number := strings.TrimSuffix(value, "%")
+		p.maxFailuresPercent = number != value
+		var err error
+		p.maxFailures, err = strconv.ParseFloat(number, 64)
+		if err != nil || p.maxFailures < 0 || (p.maxFailuresPercent && p.maxFailures > 100) {
+			return nil, fmt.Errorf("Invalid --failure-threshold %v, use a number of failures or a percentage such as 5%%", value)
+		}
+	}
+
+	switch p.noResult {
+	case "":
+		p.noResult = "fail"
+	case "pass", "fail", "warn":
+	default:
+		return nil, fmt.Errorf("Invalid --no-result %v, use pass, fail or warn", p.noResult)
+	}
+
+	for _, value := range c.StringSlice("exit-code") {
+		parts := strings.SplitN(value, "=", 2)
+		if _, ok := p.exitCodes[parts[0]]; !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid --exit-code %v, use KIND=CODE where KIND is one of %v", value, strings.Join(exitCodeKinds, ", "))
+		}
+		code, err := strconv.Atoi(parts[1])
+		if err != nil || code < 0 || code > 255 {
+			return nil, fmt.Errorf("Invalid exit code %v, use a number between 0 and 255", parts[1])
+		}
+		p.exitCodes[parts[0]] = code
+	}
+	return p, nil
+}
+
+// loadKnownIssues fetches the IDs of the tests tagged with the known issue tag
+func (p *runPolicy) loadKnownIssues(client runnerAPI) error {
+	if p.knownIssueTag == "" || p.knownIssues != nil {
+		return nil
+	}
+	tests, err := client.GetTests(&rainforest.RFTestFilters{Tags: []string{p.knownIssueTag}})
+	if err != nil {
+		return fmt.Errorf("Unable to get the tests tagged %v: %v", p.knownIssueTag, err)
+	}
+	p.knownIssues = map[int]bool{}
+	for _, test := range tests {
+		if anyMember([]string{p.knownIssueTag}, test.Tags) {
+			p.knownIssues[test.TestID] = true
+		}
+	}
+	return nil
+}
+
+// isDefault returns true if any failure fails the run
+func (p *runPolicy) isDefault() bool {
+	return p.maxFailures == 0 && !p.maxFailuresPercent && p.knownIssueTag == ""
+}
+
+// failures returns the number of failed tests of the run that aren't known
+// issues
+func (p *runPolicy) failures(client runnerAPI, status *rainforest.RunStatus) (int, error) {
+	failed := status.CurrentProgress.Failed
+	if len(p.knownIssues) == 0 || failed == 0 {
+		return failed, nil
+	}
+	tests, err := client.GetRunTests(status.ID)
+	if err != nil {
+		return 0, err
+	}
+	failed = 0
+	for _, test := range tests {
+		if test.Result == "failed" && !p.knownIssues[test.ID] {
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+// failing returns true if the failures of the run are over the threshold.
+// Percentages are of all the tests of the run, so a run that is failing
+// can't recover.
+func (p *runPolicy) failing(client runnerAPI, status *rainforest.RunStatus) (bool, error) {
+	if p.isDefault() {
+		return status.Result == "failed", nil
+	}
+	failed, err := p.failures(client, status)
+	if err != nil {
+		return false, err
+	}
+	if p.maxFailuresPercent && status.CurrentProgress.Total > 0 {
+		return float64(failed)*100/float64(status.CurrentProgress.Total) > p.maxFailures, nil
+	}
+	return float64(failed) > p.maxFailures, nil
+}
+
+// outcome returns passed, failed or no_result for a finished run
+func (p *runPolicy) outcome(client runnerAPI, status *rainforest.RunStatus) (string, error) {
+	failing, err := p.failing(client, status)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case failing:
+		return "failed", nil
+	case status.Result == "passed":
+		return "passed", nil
+	case status.Result == "no_result" || status.CurrentProgress.NoResult > 0:
+		switch p.noResult {
+		case "warn":
+			log.Printf("Warning: run %v has %v test(s) with no result", status.ID, status.CurrentProgress.NoResult)
+			return "passed", nil
+		case "pass":
+			return "passed", nil
+		}
+		return "no_result", nil
+	case status.Result == "failed":
+		log.Printf("Run %v has failures within the --failure-threshold or of known issues", status.ID)
+		return "passed", nil
+	}
+	return "failed", nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestGetRunPolicy(t *testing.T) {
+	p, err := getRunPolicy(newFakeContext(map[string]interface{}{}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.isDefault() || p.noResult != "fail" || !reflect.DeepEqual(p.exitCodes, map[string]int{"failed": 1, "no_result": 1, "error": 1}) {
+		t.Errorf("Unexpected default policy %+v", p)
+	}
+
+	p, err = getRunPolicy(newFakeContext(map[string]interface{}{
+		"failure-threshold": "2.5%",
+		"no-result":         "warn",
+		"exit-code":         []string{"no_result=3", "error=4"},
+	}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.maxFailures != 2.5 || !p.maxFailuresPercent || p.noResult != "warn" ||
+		!reflect.DeepEqual(p.exitCodes, map[string]int{"failed": 1, "no_result": 3, "error": 4}) {
+		t.Errorf("Unexpected policy %+v", p)
+	}
+
+	for _, flags := range []map[string]interface{}{
+		{"failure-threshold": "many"},
+		{"failure-threshold": "-1"},
+		{"failure-threshold": "150%"},
+		{"no-result": "ignore"},
+		{"exit-code": []string{"passed=0"}},
+		{"exit-code": []string{"failed"}},
+		{"exit-code": []string{"failed=256"}},
+	} {
+		if _, err = getRunPolicy(newFakeContext(flags, cli.Args{})); err == nil {
+			t.Errorf("Expected an error for %v", flags)
+		}
+	}
+}
+
+func newPolicyStatus(result string, total, passed, failed, noResult int) *rainforest.RunStatus {
+	status := &rainforest.RunStatus{ID: 1, State: "complete", Result: result}
+	status.CurrentProgress.Total = total
+	status.CurrentProgress.Passed = passed
+	status.CurrentProgress.Failed = failed
+	status.CurrentProgress.NoResult = noResult
+	return status
+}
+
+func TestRunPolicyOutcome(t *testing.T) {
+	client := &fakeRunnerClient{runTests: map[int][]rainforest.RunTest{1: {
+		{ID: 10, Result: "failed"},
+		{ID: 11, Result: "failed"},
+		{ID: 12, Result: "passed"},
+	}}}
+
+	testCases := []struct {
+		policy runPolicy
+		status *rainforest.RunStatus
+		want   string
+	}{
+		{runPolicy{}, newPolicyStatus("passed", 10, 10, 0, 0), "passed"},
+		{runPolicy{}, newPolicyStatus("failed", 10, 9, 1, 0), "failed"},
+		{runPolicy{noResult: "fail"}, newPolicyStatus("no_result", 10, 9, 0, 1), "no_result"},
+		{runPolicy{noResult: "warn"}, newPolicyStatus("no_result", 10, 9, 0, 1), "passed"},
+		{runPolicy{noResult: "pass"}, newPolicyStatus("no_result", 10, 9, 0, 1), "passed"},
+		{runPolicy{maxFailures: 2}, newPolicyStatus("failed", 10, 8, 2, 0), "passed"},
+		{runPolicy{maxFailures: 2}, newPolicyStatus("failed", 10, 7, 3, 0), "failed"},
+		{runPolicy{maxFailures: 2, noResult: "fail"}, newPolicyStatus("failed", 10, 7, 2, 1), "no_result"},
+		{runPolicy{maxFailures: 10, maxFailuresPercent: true}, newPolicyStatus("failed", 20, 18, 2, 0), "passed"},
+		{runPolicy{maxFailures: 10, maxFailuresPercent: true}, newPolicyStatus("failed", 20, 17, 3, 0), "failed"},
+		// Both failures of the run are known issues
+		{runPolicy{knownIssueTag: "known-issue", knownIssues: map[int]bool{10: true, 11: true}}, newPolicyStatus("failed", 3, 1, 2, 0), "passed"},
+		{runPolicy{knownIssueTag: "known-issue", knownIssues: map[int]bool{10: true}}, newPolicyStatus("failed", 3, 1, 2, 0), "failed"},
+	}
+
+	for _, tc := range testCases {
+		got, err := tc.policy.outcome(client, tc.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("outcome of %+v with %+v returned %v, want %v", tc.status.CurrentProgress, tc.policy, got, tc.want)
+		}
+	}
+}
+
+func TestRunPolicyLoadKnownIssues(t *testing.T) {
+	client := &fakeRunnerClient{}
+	client.tests = []rainforest.RFTest{
+		{TestID: 10, Tags: []string{"known-issue", "checkout"}},
+		{TestID: 11, Tags: []string{"checkout"}},
+	}
+	p := &runPolicy{knownIssueTag: "known-issue"}
+	err := p.loadKnownIssues(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]bool{10: true}; !reflect.DeepEqual(p.knownIssues, want) {
+		t.Errorf("Loaded known issues %v, want %v", p.knownIssues, want)
+	}
+}
+
+func TestGetRunStatusFailureThreshold(t *testing.T) {
+	inProgress := *newPolicyStatus("failed", 10, 2, 1, 0)
+	inProgress.State = "in_progress"
+	client := &fakeRunnerClient{runStatuses: []rainforest.RunStatus{inProgress}}
+
+	_, _, done, err := getRunStatus(&runPolicy{failFast: true, maxFailures: 1}, 1, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done {
+		t.Error("Expected the run to go on with failures under the threshold")
+	}
+
+	client.runStatuses[0].CurrentProgress.Failed = 2
+	_, _, done, err = getRunStatus(&runPolicy{failFast: true, maxFailures: 1}, 1, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done {
+		t.Error("Expected the run to be done with failures over the threshold")
+	}
+}
+
+func TestMonitorRunStatusExitCodes(t *testing.T) {
+	testCases := []struct {
+		result string
+		flags  map[string]interface{}
+		want   int
+	}{
+		{"passed", map[string]interface{}{"exit-code": []string{"failed=2"}}, 0},
+		{"failed", map[string]interface{}{}, 1},
+		{"failed", map[string]interface{}{"exit-code": []string{"failed=2"}}, 2},
+		{"no_result", map[string]interface{}{"exit-code": []string{"failed=2", "no_result=3"}}, 3},
+		{"no_result", map[string]interface{}{"no-result": "warn", "exit-code": []string{"no_result=3"}}, 0},
+		{"failed", map[string]interface{}{"failure-threshold": "1"}, 0},
+	}
+
+	for _, tc := range testCases {
+		r := newRunner()
+		r.client = &fakeRerunClient{results: map[int]string{100: tc.result}}
+		err := r.monitorRunStatus(newFakeContext(tc.flags, cli.Args{}), 100)
+		code := 0
+		if err != nil {
+			exitErr, ok := err.(cli.ExitCoder)
+			if !ok {
+				t.Fatalf("Expected an exit error, got %v", err)
+			}
+			code = exitErr.ExitCode()
+		}
+		if code != tc.want {
+			t.Errorf("%v run with %v exited with %v, want %v", tc.result, tc.flags, code, tc.want)
+		}
+	}
+}
+
+func TestMonitorRunsExitCodes(t *testing.T) {
+	defer func(d time.Duration) { runStatusPollInterval = d }(runStatusPollInterval)
+	runStatusPollInterval = time.Millisecond
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	tablesOut = &bytes.Buffer{}
+
+	testCases := []struct {
+		results map[int]string
+		flags   map[string]interface{}
+		want    int
+	}{
+		{map[int]string{1: "passed", 2: "passed"}, map[string]interface{}{"exit-code": []string{"failed=2"}}, 0},
+		{map[int]string{1: "passed", 2: "no_result"}, map[string]interface{}{"exit-code": []string{"failed=2", "no_result=3"}}, 3},
+		{map[int]string{1: "failed", 2: "no_result"}, map[string]interface{}{"exit-code": []string{"failed=2", "no_result=3"}}, 2},
+		{map[int]string{1: "passed", 2: "no_result"}, map[string]interface{}{"no-result": "warn", "exit-code": []string{"no_result=3"}}, 0},
+		{map[int]string{1: "failed", 2: "passed"}, map[string]interface{}{}, 1},
+	}
+
+	exitCode := func(err error) int {
+		if err == nil {
+			return 0
+		}
+		exitErr, ok := err.(cli.ExitCoder)
+		if !ok {
+			t.Fatalf("Expected an exit error, got %v", err)
+		}
+		return exitErr.ExitCode()
+	}
+
+	for _, tc := range testCases {
+		r := newRunner()
+		r.client = &fakeRerunClient{results: tc.results}
+		err := r.waitForRuns(newFakeContext(tc.flags, cli.Args{"1", "2"}))
+		if code := exitCode(err); code != tc.want {
+			t.Errorf("wait for %v with %v exited with %v, want %v", tc.results, tc.flags, code, tc.want)
+		}
+
+		// Matrix legs are started with the environment IDs 1 and 2
+		flags := map[string]interface{}{"matrix-leg": []string{"environment-id=1", "environment-id=2"}}
+		for name, value := range tc.flags {
+			flags[name] = value
+		}
+		r.client = &fakeMatrixClient{results: tc.results}
+		err = r.startRun(newFakeContext(flags, cli.Args{}))
+		if code := exitCode(err); code != tc.want {
+			t.Errorf("Matrix of %v with %v exited with %v, want %v", tc.results, tc.flags, code, tc.want)
+		}
+	}
+}
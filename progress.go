@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+// stdoutIsTerminal is stubbed in tests to force the live progress display
+var stdoutIsTerminal = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+const (
+	progressBarWidth = 30
+	// maxFailedTestsShown caps the list of failed tests in the display
+	maxFailedTestsShown = 10
+)
+
+// runProgress is a live display of the progress of a run that is redrawn in
+// place on each status update, in place of a log line per update.
+type runProgress struct {
+	out    io.Writer
+	client runnerAPI
+	start  time.Time
+	// lines is the number of lines drawn, to be erased on the next redraw
+	lines int
+	// failedTests is refreshed whenever the failed count changes
+	failedTests  []rainforest.RunTest
+	failedCount  int
+	failedLoaded bool
+}
+
+// newRunProgress returns a display of the run progress if stdout is a
+// terminal, or nil to keep logging the status updates.
+func newRunProgress(client runnerAPI) *runProgress {
+	if !stdoutIsTerminal() {
+		return nil
+	}
+	return &runProgress{out: progressOut, client: client, start: timeNow()}
+}
+
+// update redraws the display with the status of the run
+func (p *runProgress) update(status *rainforest.RunStatus) {
+	p.loadFailedTests(status)
+	p.clear()
+
+	lines := []string{p.statusLine(status), p.countersLine(status)}
+	if len(p.failedTests) > 0 {
+		lines = append(lines, "Failed tests:")
+		for i, test := range p.failedTests {
+			if i == maxFailedTestsShown {
+				lines = append(lines, fmt.Sprintf("  ... and %v more", len(p.failedTests)-maxFailedTestsShown))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("  - %v (#%v)", test.Title, test.ID))
+		}
+	}
+	for _, line := range lines {
+		fmt.Fprintln(p.out, line)
+	}
+	p.lines = len(lines)
+}
+
+// clear erases the display, e.g. before a log line is printed
+func (p *runProgress) clear() {
+	if p.lines > 0 {
+		// Move to the start of the first line drawn and erase to the end
+		fmt.Fprintf(p.out, "\x1b[%dF\x1b[J", p.lines)
+		p.lines = 0
+	}
+}
+
+// finish leaves the last display on screen
+func (p *runProgress) finish() {
+	p.lines = 0
+}
+
+func (p *runProgress) statusLine(status *rainforest.RunStatus) string {
+	progress := status.CurrentProgress
+	done := progress.Percent * progressBarWidth / 100
+	if done > progressBarWidth {
+		done = progressBarWidth
+	}
+	bar := strings.Repeat("#", done) + strings.Repeat("-", progressBarWidth-done)
+	elapsed := timeNow().Sub(p.start).Round(time.Second)
+	return fmt.Sprintf("Run %v %v [%v] %3d%% %v", status.ID, status.State, bar, progress.Percent, elapsed)
+}
+
+func (p *runProgress) countersLine(status *rainforest.RunStatus) string {
+	progress := status.CurrentProgress
+	inProgress := progress.Total - progress.Complete
+	if inProgress < 0 {
+		inProgress = 0
+	}
+	return fmt.Sprintf("%v passed, %v failed, %v no result, %v in progress (%v of %v complete)",
+		progress.Passed, progress.Failed, progress.NoResult, inProgress, progress.Complete, progress.Total)
+}
+
+// loadFailedTests fetches the failed tests when the failed count changed.
+// The previous list is kept if they can't be fetched.
+func (p *runProgress) loadFailedTests(status *rainforest.RunStatus) {
+	if status.CurrentProgress.Failed == 0 || (p.failedLoaded && status.CurrentProgress.Failed == p.failedCount) {
+		return
+	}
+	tests, err := p.client.GetRunTests(status.ID)
+	if err != nil {
+		return
+	}
+	var failed []rainforest.RunTest
+	for _, test := range tests {
+		if test.Result == "failed" {
+			failed = append(failed, test)
+		}
+	}
+	p.failedTests = failed
+	p.failedCount = status.CurrentProgress.Failed
+	p.failedLoaded = true
+}
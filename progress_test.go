@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestNewRunProgress(t *testing.T) {
+	defer func(f func() bool) { stdoutIsTerminal = f }(stdoutIsTerminal)
+
+	stdoutIsTerminal = func() bool { return false }
+	if p := newRunProgress(&fakeRunnerClient{}); p != nil {
+		t.Error("Expected no progress display when stdout isn't a terminal")
+	}
+	stdoutIsTerminal = func() bool { return true }
+	if p := newRunProgress(&fakeRunnerClient{}); p == nil {
+		t.Error("Expected a progress display when stdout is a terminal")
+	}
+}
+
+func TestRunProgressUpdate(t *testing.T) {
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	client := &fakeRunnerClient{runTests: map[int][]rainforest.RunTest{}}
+	out := &bytes.Buffer{}
+	p := &runProgress{out: out, client: client, start: now}
+
+	status := &rainforest.RunStatus{ID: 7, State: "in_progress"}
+	status.CurrentProgress.Percent = 50
+	status.CurrentProgress.Total = 10
+	status.CurrentProgress.Complete = 5
+	status.CurrentProgress.Passed = 4
+	status.CurrentProgress.NoResult = 1
+	now = now.Add(95 * time.Second)
+	p.update(status)
+
+	want := "Run 7 in_progress [###############---------------]  50% 1m35s\n" +
+		"4 passed, 0 failed, 1 no result, 5 in progress (5 of 10 complete)\n"
+	if out.String() != want {
+		t.Errorf("Unexpected display:\n%q\nwant:\n%q", out.String(), want)
+	}
+
+	// The failed tests are fetched once the run has failures
+	var failed []rainforest.RunTest
+	for i := 1; i <= maxFailedTestsShown+2; i++ {
+		failed = append(failed, rainforest.RunTest{ID: i, Title: "Checkout", Result: "failed"})
+	}
+	client.runTests[7] = append(failed, rainforest.RunTest{ID: 99, Title: "Login", Result: "passed"})
+	status.CurrentProgress.Failed = len(failed)
+	out.Reset()
+	p.update(status)
+
+	if !strings.HasPrefix(out.String(), "\x1b[2F\x1b[J") {
+		t.Errorf("Expected the previous display to be erased:\n%q", out.String())
+	}
+	for _, want := range []string{"Failed tests:\n  - Checkout (#1)\n", "  ... and 2 more\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%v", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Login") {
+		t.Errorf("Expected only failed tests in:\n%v", out.String())
+	}
+	if p.lines != 2+1+maxFailedTestsShown+1 {
+		t.Errorf("Expected %v lines drawn, got %v", 2+1+maxFailedTestsShown+1, p.lines)
+	}
+
+	// Finished displays stay on screen
+	p.finish()
+	out.Reset()
+	p.clear()
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing to be erased, got %q", out.String())
+	}
+}
+
+func TestMonitorRunStatusProgress(t *testing.T) {
+	defer func(f func() bool) { stdoutIsTerminal = f }(stdoutIsTerminal)
+	defer func(w io.Writer) { progressOut = w }(progressOut)
+	defer log.SetOutput(os.Stderr)
+
+	for _, terminal := range []bool{true, false} {
+		stdoutIsTerminal = func() bool { return terminal }
+		out := &bytes.Buffer{}
+		progressOut = out
+		logs := &bytes.Buffer{}
+		log.SetOutput(logs)
+
+		inProgress := rainforest.RunStatus{ID: 100, State: "in_progress"}
+		inProgress.CurrentProgress.Percent = 50
+		done := rainforest.RunStatus{ID: 100, State: "complete", Result: "passed"}
+		done.CurrentProgress.Percent = 100
+		done.StateDetails.IsFinalState = true
+		r := newRunner()
+		r.client = &fakePollClient{statuses: []rainforest.RunStatus{inProgress, done}}
+		c := newFakeContext(map[string]interface{}{"poll-interval": "1ms"}, cli.Args{})
+
+		err := r.monitorRunStatus(c, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if terminal {
+			if !strings.Contains(out.String(), "Run 100 complete [##############################] 100%") {
+				t.Errorf("Expected the final progress in:\n%q", out.String())
+			}
+			if strings.Contains(logs.String(), "is in_progress") {
+				t.Errorf("Expected no status log lines, got:\n%v", logs.String())
+			}
+		} else {
+			if out.Len() != 0 {
+				t.Errorf("Expected no progress display, got:\n%q", out.String())
+			}
+			if !strings.Contains(logs.String(), "Run 100 is in_progress and is 50% complete") {
+				t.Errorf("Expected status log lines, got:\n%v", logs.String())
+			}
+		}
+	}
+}
@@ -36,7 +36,16 @@ var (
 	// default output for printing resource tables
 	tablesOut io.Writer = os.Stdout
 
-	// Run status polling interval
+	// default output for printing command results such as diffs and search results
+	resultsOut io.Writer = os.Stdout
+
+	// default output for CI annotations
+	annotationsOut io.Writer = os.Stdout
+
+	// default output for the live progress of runs
+	progressOut io.Writer = os.Stdout
+
+	// Default run status polling interval of --poll-interval
 	runStatusPollInterval = time.Second * 5
 
 	// Batch size (number of rows) for tabular var upload
@@ -47,6 +56,8 @@ var (
 	rfmlDownloadConcurrency = 4
 	// Concurrent connections when uploading RFML files
 	rfmlUploadConcurrency = 4
+	// Quiet period after the last file change before watched RFML files are re-checked
+	rfmlWatchDebounce = time.Millisecond * 500
 )
 
 // cliContext is an interface providing context of running application
@@ -67,6 +78,93 @@ type cliContext interface {
 	Args() (args cli.Args)
 }
 
+// reportFormatFlag is shared by the commands writing run reports
+var reportFormatFlag = cli.StringSliceFlag{
+	Name: "report-format",
+	Usage: "write a report of the run in `FORMAT[=PATH]`, one of junit, tap, markdown, json or html. " +
+		"The report is printed to stdout if no path is given. Can be used multiple times.",
+}
+
+// notifyFlag and notifyTemplateFlag are shared by the commands monitoring runs
+var notifyFlag = cli.StringSliceFlag{
+	Name: "notify",
+	Usage: "post a summary of the run once it's done to `KIND=URL`, where KIND is slack, teams or webhook. " +
+		"Webhooks receive the summary as JSON. Can be used multiple times.",
+}
+
+var notifyTemplateFlag = cli.StringFlag{
+	Name: "notify-template",
+	Usage: "Go `TEMPLATE` of the notification message, using .RunID, .State, .Result, .Total, .Passed, " +
+		".Failed, .NoResult, .FailedTests, .URL and .TimedOut.",
+}
+
+// annotationsFlag is shared by the commands reporting errors to CI systems
+var annotationsFlag = cli.StringFlag{
+	Name: "annotations",
+	Usage: "report errors as CI annotations in `FORMAT`, one of github, gitlab or azure, " +
+		"or auto to use the format of the detected CI system.",
+	EnvVar: "RAINFOREST_ANNOTATIONS",
+}
+
+// failureThresholdFlag, knownIssueTagFlag, noResultFlag and exitCodeFlag set
+// the run policy of the commands monitoring runs
+var failureThresholdFlag = cli.StringFlag{
+	Name: "failure-threshold",
+	Usage: "only fail the run if more than `N` tests fail, or more than N% of the tests with a percentage. " +
+		"With --fail-fast, the run is abandoned once over the threshold.",
+}
+
+var knownIssueTagFlag = cli.StringFlag{
+	Name:  "known-issue-tag",
+	Usage: "failures of the tests tagged `TAG`, e.g. known-issue, don't fail the run.",
+}
+
+var noResultFlag = cli.StringFlag{
+	Name:  "no-result",
+	Value: "fail",
+	Usage: "treat tests with no result as `POLICY`, one of pass, fail or warn.",
+}
+
+var exitCodeFlag = cli.StringSliceFlag{
+	Name: "exit-code",
+	Usage: "exit with `KIND=CODE` instead of 1, where KIND is failed, no_result or error. " +
+		"Can be used multiple times.",
+}
+
+// maxRerunsFlag is shared by the commands that can rerun the failed tests
+var maxRerunsFlag = cli.UintFlag{
+	Name: "max-reruns",
+	Usage: "rerun the failed tests up to `N` times before reporting failure. Only --conflict is passed on to " +
+		"the reruns as the API takes no other options for them, so --description, --release and the " +
+		"environment, crowd and browser options only apply to the first run.",
+}
+
+// timeoutFlag, timeoutActionFlag, pollIntervalFlag and maxPollIntervalFlag
+// set how the commands monitoring runs wait for them
+var timeoutFlag = cli.StringFlag{
+	Name: "timeout",
+	Usage: "stop waiting for the runs after `DURATION`, e.g. 90m. The reports are written " +
+		"with the results so far and rainforest-cli exits with the error --exit-code.",
+}
+
+var timeoutActionFlag = cli.StringFlag{
+	Name:  "timeout-action",
+	Value: "exit",
+	Usage: "`ACTION` when the --timeout expires: exit leaves the runs going, cancel aborts them.",
+}
+
+var pollIntervalFlag = cli.StringFlag{
+	Name:  "poll-interval",
+	Value: runStatusPollInterval.String(),
+	Usage: "check the status of the runs every `DURATION`.",
+}
+
+var maxPollIntervalFlag = cli.StringFlag{
+	Name:  "max-poll-interval",
+	Value: "1m",
+	Usage: "back off up to `DURATION` between status checks while a run makes no progress, e.g. in a long queue.",
+}
+
 // Create custom writer which will use timestamps
 type logWriter struct{}
 
@@ -136,6 +234,11 @@ func main() {
 			Name:  "debug",
 			Usage: "Output http request header information for debug purposes",
 		},
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "`PATH` of the JSON config file. Defaults to " + defaultConfigPath + " if it exists.",
+			EnvVar: "RAINFOREST_CONFIG",
+		},
 	}
 	app.OnUsageError = func(c *cli.Context, err error, isSubcommand bool) error {
 		return cli.NewExitError("Unknown argument", 1)
@@ -169,6 +272,10 @@ func main() {
 					Name:  "force-execute",
 					Usage: "Execute test specified by `FILE` even if execute: false is specified. Can be used multiple times for specifying multiple files.",
 				},
+				cli.StringFlag{
+					Name:  "changed-since",
+					Usage: "only execute local tests affected by changes since the git `REF`: changed tests, tests with changed embedded files and tests embedding them. Use with -f.",
+				},
 				cli.StringFlag{
 					Name:  "site, site-id",
 					Usage: "filter tests by a specific site. You can see a list of your `SITE-ID`s with the sites command.",
@@ -199,6 +306,16 @@ func main() {
 					Usage: "run your tests using specified `CROWD`. Available choices are: default, automation, automation_and_crowd " +
 						"or on_premise_crowd. Contact your CSM for more details.",
 				},
+				cli.BoolFlag{
+					Name: "matrix",
+					Usage: "start one run per leg of the matrix in the config file, wait for all of them and " +
+						"fail if any of them fails.",
+				},
+				cli.StringSliceFlag{
+					Name: "matrix-leg",
+					Usage: "add a matrix leg with the options in `LEG`, e.g. \"name=staging environment-id=12 " +
+						"browser=chrome,firefox crowd=automation\". Can be used multiple times, implies --matrix.",
+				},
 				cli.StringFlag{
 					Name: "conflict",
 					Usage: "use the abort option to abort any runs in the same environment or " +
@@ -209,6 +326,11 @@ func main() {
 					Usage: "run in the background. This option makes cli return after successfully starting a run, " +
 						"without waiting for the run results.",
 				},
+				cli.StringFlag{
+					Name: "state-file",
+					Usage: "record the ID, URL and parameters of the started runs in the JSON `FILE`, " +
+						"for the wait command to pick up later. Runs are added to an existing file.",
+				},
 				cli.BoolFlag{
 					Name: "fail-fast, ff",
 					Usage: "fail the build as soon as the first failed result comes in. " +
@@ -217,17 +339,39 @@ func main() {
 				cli.StringFlag{
 					Name: "custom-url",
 					Usage: "specify the URL for the run to use when testing against an ephemeral environment. " +
-						"This will create a new temporary environment for the run.",
+						"This will reuse the temporary environment for the URL, or create a new one for the run.",
+				},
+				cli.StringFlag{
+					Name:  "environment-name",
+					Usage: "`NAME` of the temporary environment created for --custom-url. Defaults to one with the git branch or the run description.",
+				},
+				cli.BoolFlag{
+					Name:  "new-environment",
+					Usage: "always create a new temporary environment for --custom-url instead of reusing one with the same URL, and --environment-name if given.",
+				},
+				cli.BoolFlag{
+					Name:  "delete-environment",
+					Usage: "delete the temporary environment created for --custom-url once the run is done.",
 				},
 				cli.BoolFlag{
 					Name: "git-trigger",
 					Usage: "only trigger a run when the last commit (for a git repo in the current working directory) " +
-						"contains @rainforest and a list of one or more tags. rainforest-cli exits with 0 otherwise.",
+						"contains @rainforest and a list of one or more tags, or Rainforest-* trailers. " +
+						"Branch rules from the config file apply as well. rainforest-cli exits with 0 otherwise.",
+				},
+				cli.StringFlag{
+					Name:  "git-trigger-range",
+					Usage: "scan all the commits in the git `RANGE` (e.g. origin/master..HEAD) instead of the last one for --git-trigger.",
 				},
 				cli.StringFlag{
 					Name:  "description",
 					Usage: "add arbitrary `DESCRIPTION` to the run.",
 				},
+				cli.BoolFlag{
+					Name: "auto-metadata",
+					Usage: "fill in the run release with the commit SHA and the description with the branch, " +
+						"pull request, CI job URL and commit title, unless they are given explicitly.",
+				},
 				cli.StringFlag{
 					Name: "release",
 					Usage: "adds a `RELEASE` ID that is associated with this run. You can use any string, but commonly used " +
@@ -237,6 +381,29 @@ func main() {
 					Name:  "junit-file",
 					Usage: "Create a JUnit XML report `FILE` with the specified name. Must be run in foreground mode.",
 				},
+				reportFormatFlag,
+				cli.BoolFlag{
+					Name: "junit-merge",
+					Usage: "merge the JUnit reports of reruns into the --junit-file. Tests that passed after a rerun are " +
+						"reported as passed with their earlier failures as flakyFailure elements.",
+				},
+				timeoutFlag,
+				timeoutActionFlag,
+				pollIntervalFlag,
+				maxPollIntervalFlag,
+				failureThresholdFlag,
+				knownIssueTagFlag,
+				noResultFlag,
+				exitCodeFlag,
+				notifyFlag,
+				notifyTemplateFlag,
+				annotationsFlag,
+				cli.StringFlag{
+					Name:   "test-folder",
+					Value:  "./spec/rainforest/",
+					Usage:  "`PATH` where to look for the RFML files of failed tests for --annotations, unless running with -f.",
+					EnvVar: "RAINFOREST_TEST_FOLDER",
+				},
 				cli.StringFlag{
 					Name:  "import-variable-name",
 					Usage: "`NAME` of the tabular variable to be created or updated.",
@@ -257,10 +424,7 @@ func main() {
 					Name:  "wait, reattach",
 					Usage: "monitor existing run with `RUN_ID` instead of starting a new one.",
 				},
-				cli.UintFlag{
-					Name:  "max-reruns",
-					Usage: "Rerun `max-reruns` times before reporting failure.",
-				},
+				maxRerunsFlag,
 			},
 		},
 		{
@@ -283,6 +447,11 @@ func main() {
 					Usage: "run in the background. This option makes cli return after successfully starting a run, " +
 						"without waiting for the run results.",
 				},
+				cli.StringFlag{
+					Name: "state-file",
+					Usage: "record the ID, URL and parameters of the started runs in the JSON `FILE`, " +
+						"for the wait command to pick up later. Runs are added to an existing file.",
+				},
 				cli.BoolFlag{
 					Name: "fail-fast, ff",
 					Usage: "fail the build as soon as the first failed result comes in. " +
@@ -292,13 +461,36 @@ func main() {
 					Name:  "junit-file",
 					Usage: "Create a JUnit XML report `FILE` with the specified name. Must be run in foreground mode.",
 				},
-				cli.UintFlag{
-					Name:  "max-reruns",
-					Usage: "Rerun `max-reruns` times before reporting failure.",
+				reportFormatFlag,
+				cli.BoolFlag{
+					Name: "junit-merge",
+					Usage: "merge the JUnit reports of reruns into the --junit-file. Tests that passed after a rerun are " +
+						"reported as passed with their earlier failures as flakyFailure elements.",
+				},
+				timeoutFlag,
+				timeoutActionFlag,
+				pollIntervalFlag,
+				maxPollIntervalFlag,
+				failureThresholdFlag,
+				knownIssueTagFlag,
+				noResultFlag,
+				exitCodeFlag,
+				notifyFlag,
+				notifyTemplateFlag,
+				annotationsFlag,
+				cli.StringFlag{
+					Name:   "test-folder",
+					Value:  "./spec/rainforest/",
+					Usage:  "`PATH` where to look for the RFML files of failed tests for --annotations, unless running with -f.",
+					EnvVar: "RAINFOREST_TEST_FOLDER",
 				},
+				maxRerunsFlag,
+				// Deprecated: reruns happen in process now, the flag is
+				// only accepted so existing scripts don't break.
 				cli.UintFlag{
-					Name:  "rerun-attempt",
-					Usage: "Which rerun attempt this is.",
+					Name:   "rerun-attempt",
+					Usage:  "Deprecated, has no effect.",
+					Hidden: true,
 				},
 			},
 		},
@@ -334,6 +526,11 @@ func main() {
 					Usage:  "`PATH` where to look for a tests to validate.",
 					EnvVar: "RAINFOREST_TEST_FOLDER",
 				},
+				cli.BoolFlag{
+					Name:  "watch",
+					Usage: "keep watching the test folder and validate tests whenever they change.",
+				},
+				annotationsFlag,
 			},
 			Action: func(c *cli.Context) error {
 				return validateRFML(c, api)
@@ -357,11 +554,280 @@ func main() {
 					Name:  "synchronous-upload",
 					Usage: "uploads your test in a synchronous manner i.e. not using concurrency.",
 				},
+				cli.BoolFlag{
+					Name:  "watch",
+					Usage: "keep watching the test folder and upload tests whenever they change.",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				return uploadRFML(c, api)
 			},
 		},
+		{
+			Name:         "edit",
+			Usage:        "Bulk edit the metadata of your RFML tests",
+			OnUsageError: onCommandUsageErrorHandler("edit"),
+			ArgsUsage:    "[files or folders]",
+			Description: "Rewrites the metadata of the selected RFML tests in place. " +
+				"Tests can be selected by tag, path, feature or title, if no selector is given all tests are edited. " +
+				"If no files or folders are given it edits the tests in the test folder.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "test-folder",
+					Value:  "./spec/rainforest/",
+					Usage:  "`PATH` where to look for tests to edit.",
+					EnvVar: "RAINFOREST_TEST_FOLDER",
+				},
+				cli.StringSliceFlag{
+					Name:  "tag",
+					Usage: "only edit tests tagged with `TAG`. Can be used multiple times to select tests with any of the tags.",
+				},
+				cli.StringSliceFlag{
+					Name:  "path",
+					Usage: "only edit tests whose path or file name matches the `GLOB`. Can be used multiple times.",
+				},
+				cli.IntFlag{
+					Name:  "feature-id",
+					Usage: "only edit tests belonging to the feature with `FEATURE-ID`.",
+				},
+				cli.StringFlag{
+					Name:  "title",
+					Usage: "only edit tests whose title matches the `REGEX`.",
+				},
+				cli.StringSliceFlag{
+					Name:  "add-tag",
+					Usage: "add `TAG` to the selected tests. Can be used multiple times.",
+				},
+				cli.StringSliceFlag{
+					Name:  "remove-tag",
+					Usage: "remove `TAG` from the selected tests. Can be used multiple times.",
+				},
+				cli.StringFlag{
+					Name:  "set-priority",
+					Usage: "set the `PRIORITY` of the selected tests. Available choices are: P1, P2, P3 or none.",
+				},
+				cli.StringFlag{
+					Name:  "set-state",
+					Usage: "set the `STATE` of the selected tests. Available choices are: enabled, disabled or draft.",
+				},
+				cli.StringSliceFlag{
+					Name:  "set-browsers",
+					Usage: "set the `BROWSERS` of the selected tests. Can be used multiple times or as a comma separated list.",
+				},
+				cli.StringFlag{
+					Name:  "set-feature-id",
+					Usage: "move the selected tests to the feature with `FEATURE-ID`. Use none to remove the feature.",
+				},
+				cli.StringFlag{
+					Name:  "set-execute",
+					Usage: "set whether the selected tests are executed by run -f (`true or false`).",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print a diff of the changes without modifying any files.",
+				},
+				cli.BoolFlag{
+					Name:  "push",
+					Usage: "upload the changed tests to Rainforest after editing them.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return editRFML(c, api)
+			},
+		},
+		{
+			Name:         "find",
+			Usage:        "Search your local RFML tests",
+			OnUsageError: onCommandUsageErrorHandler("find"),
+			ArgsUsage:    "[files or folders]",
+			Description: "Searches the local RFML tests and prints the matching ones. " +
+				"All the given filters have to match. If no files or folders are given it searches the test folder.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "test-folder",
+					Value:  "./spec/rainforest/",
+					Usage:  "`PATH` where to look for tests.",
+					EnvVar: "RAINFOREST_TEST_FOLDER",
+				},
+				cli.StringFlag{
+					Name:  "text",
+					Usage: "find tests with `TEXT` in any of their actions or questions (case insensitive).",
+				},
+				cli.StringSliceFlag{
+					Name:  "tag",
+					Usage: "find tests tagged with `TAG`. Can be used multiple times to find tests with any of the tags.",
+				},
+				cli.BoolFlag{
+					Name:  "untagged",
+					Usage: "find tests without any tags.",
+				},
+				cli.StringFlag{
+					Name:  "priority",
+					Usage: "find tests with `PRIORITY`. Available choices are: P1, P2, P3 or none.",
+				},
+				cli.StringFlag{
+					Name:  "state",
+					Usage: "find tests in `STATE`. Available choices are: enabled, disabled or draft.",
+				},
+				cli.StringSliceFlag{
+					Name:  "browser",
+					Usage: "find tests set to run against `BROWSER`. Can be used multiple times.",
+				},
+				cli.IntFlag{
+					Name:  "site-id",
+					Usage: "find tests for the site with `SITE-ID`.",
+				},
+				cli.IntFlag{
+					Name:  "feature-id",
+					Usage: "find tests belonging to the feature with `FEATURE-ID`.",
+				},
+				cli.StringFlag{
+					Name:  "title",
+					Usage: "find tests whose title matches the `REGEX`.",
+				},
+				cli.StringSliceFlag{
+					Name:  "path",
+					Usage: "find tests whose path or file name matches the `GLOB`. Can be used multiple times.",
+				},
+				cli.StringFlag{
+					Name:  "embeds",
+					Usage: "find tests that embed the test with `RFML-ID`, directly or through other embedded tests.",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "paths",
+					Usage: "output `FORMAT`. Available choices are: paths, ids or json.",
+				},
+			},
+			Action: findRFML,
+		},
+		{
+			Name:         "flatten",
+			Usage:        "Replace embedded tests with their steps in RFML files",
+			OnUsageError: onCommandUsageErrorHandler("flatten"),
+			ArgsUsage:    "[files]",
+			Description: "Replaces the embedded tests of the given RFML files with their steps, recursively. " +
+				"Embedded tests are looked up in the test folder.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "test-folder",
+					Value:  "./spec/rainforest/",
+					Usage:  "`PATH` where to look for embedded tests.",
+					EnvVar: "RAINFOREST_TEST_FOLDER",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the changes without modifying any files.",
+				},
+			},
+			Action: flattenRFML,
+		},
+		{
+			Name:         "extract",
+			Usage:        "Extract steps of an RFML test into a new embedded test",
+			OnUsageError: onCommandUsageErrorHandler("extract"),
+			ArgsUsage:    "[file]",
+			Description: "Moves a range of steps of the given RFML file into a new test and embeds it instead. " +
+				"The same sequence of steps is replaced in every test of the test folder.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "test-folder",
+					Value:  "./spec/rainforest/",
+					Usage:  "`PATH` where to look for tests containing the same steps.",
+					EnvVar: "RAINFOREST_TEST_FOLDER",
+				},
+				cli.StringFlag{
+					Name:  "steps",
+					Usage: "`RANGE` of steps to extract, e.g. 2-4. Step numbers start at 1 and include embedded tests.",
+				},
+				cli.StringFlag{
+					Name:  "rfml-id",
+					Usage: "`RFML-ID` of the new test.",
+				},
+				cli.StringFlag{
+					Name:  "title",
+					Usage: "`TITLE` of the new test. Defaults to its RFML ID.",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "`PATH` of the new RFML file. Defaults to RFML-ID.rfml next to the given file.",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the changes without modifying any files.",
+				},
+			},
+			Action: extractRFML,
+		},
+		{
+			Name:         "dedupe",
+			Usage:        "Find repeated step sequences in your RFML tests",
+			OnUsageError: onCommandUsageErrorHandler("dedupe"),
+			ArgsUsage:    "[files or folders]",
+			Description: "Finds sequences of steps repeated across your local RFML tests and suggests " +
+				"extracting them into embedded tests. Use --extract to extract them right away.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "test-folder",
+					Value:  "./spec/rainforest/",
+					Usage:  "`PATH` where to look for tests.",
+					EnvVar: "RAINFOREST_TEST_FOLDER",
+				},
+				cli.IntFlag{
+					Name:  "min-length",
+					Value: 3,
+					Usage: "only report sequences of at least `LENGTH` steps.",
+				},
+				cli.IntFlag{
+					Name:  "min-occurrences",
+					Value: 2,
+					Usage: "only report sequences repeated at least `COUNT` times.",
+				},
+				cli.BoolFlag{
+					Name:  "extract",
+					Usage: "extract each repeated sequence into a new test with execute: false and embed it instead.",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the changes --extract would make without modifying any files.",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "table",
+					Usage: "output `FORMAT`. Available choices are: table or json.",
+				},
+			},
+			Action: dedupeRFML,
+		},
+		{
+			Name:         "stats",
+			Usage:        "Summarize your test suite",
+			OnUsageError: onCommandUsageErrorHandler("stats"),
+			ArgsUsage:    "[files or folders]",
+			Description: "Prints statistics about your local RFML tests, or your Rainforest tests with --remote: " +
+				"test counts by tag, priority, state, feature and browser, step counts with embedded tests expanded, " +
+				"the most embedded tests, orphaned tests and the estimated run size for each tag.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "test-folder",
+					Value:  "./spec/rainforest/",
+					Usage:  "`PATH` where to look for tests.",
+					EnvVar: "RAINFOREST_TEST_FOLDER",
+				},
+				cli.BoolFlag{
+					Name:  "remote",
+					Usage: "summarize the tests on Rainforest instead of the local ones.",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "table",
+					Usage: "output `FORMAT`. Available choices are: table, json or markdown.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return printSuiteStats(c, api)
+			},
+		},
 		{
 			Name:         "rm",
 			Usage:        "Remove an RFML test locally and remotely",
@@ -482,11 +948,173 @@ func main() {
 					Name:  "junit-file",
 					Usage: "`PATH` of file to which write a JUnit report for the specified run.",
 				},
+				reportFormatFlag,
 			},
 			Action: func(c *cli.Context) error {
+				if len(c.StringSlice("report-format")) > 0 {
+					return writeRunReports(c, api)
+				}
 				return writeJunit(c, api, 0)
 			},
 		},
+		{
+			Name:         "wait",
+			Usage:        "Wait for runs started in the background",
+			OnUsageError: onCommandUsageErrorHandler("wait"),
+			ArgsUsage:    "[run IDs]",
+			Description: "Monitors the runs given as arguments or recorded with run --bg --state-file concurrently, " +
+				"prints their combined status and fails if any of them fails.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "state-file",
+					Usage: "wait for the runs recorded in the JSON `FILE` by run --state-file.",
+				},
+				cli.StringFlag{
+					Name: "junit-file",
+					Usage: "Create a JUnit XML report `FILE` for each run, named after the run, " +
+						"e.g. results.run_123.xml for results.xml.",
+				},
+				cli.BoolFlag{
+					Name:  "fail-fast, ff",
+					Usage: "stop waiting for a run as soon as its first failed result comes in.",
+				},
+				timeoutFlag,
+				timeoutActionFlag,
+				pollIntervalFlag,
+				maxPollIntervalFlag,
+				failureThresholdFlag,
+				knownIssueTagFlag,
+				noResultFlag,
+				exitCodeFlag,
+			},
+			Action: func(c *cli.Context) error {
+				return waitForRuns(c)
+			},
+		},
+		{
+			Name:         "runs",
+			Usage:        "List your recent runs",
+			OnUsageError: onCommandUsageErrorHandler("runs"),
+			Description: "Lists your recent runs, most recent first, to find the run ID to rerun or report on. " +
+				"Dates can be given as YYYY-MM-DD, RFC 3339 or a duration before now such as 12h or 7d.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "state",
+					Usage: "only list runs in `STATE`, e.g. in_progress, complete or aborted.",
+				},
+				cli.StringFlag{
+					Name:  "result",
+					Usage: "only list runs with `RESULT`, e.g. passed, failed or no_result.",
+				},
+				cli.IntFlag{
+					Name:  "environment-id",
+					Usage: "only list runs against the `ENVIRONMENT`.",
+				},
+				cli.IntFlag{
+					Name:  "run-group, run-group-id",
+					Usage: "only list runs of the run group. You can see a list of your `RUN-GROUP-ID`s with the run-groups command.",
+				},
+				cli.StringFlag{
+					Name:  "release",
+					Usage: "only list runs of the `RELEASE`.",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only list runs created after `DATE`.",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "only list runs created before `DATE`.",
+				},
+				cli.BoolFlag{
+					Name:  "created-by-cli",
+					Usage: "only list runs started with rainforest-cli.",
+				},
+				cli.IntFlag{
+					Name:  "limit",
+					Value: 20,
+					Usage: "list at most `LIMIT` runs, 0 lists all of them.",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "table",
+					Usage: "output `FORMAT`. Available choices are: table or json.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return listRuns(c, api)
+			},
+		},
+		{
+			Name:         "flaky",
+			Usage:        "Find flaky tests in your recent runs",
+			OnUsageError: onCommandUsageErrorHandler("flaky"),
+			Description: "Ranks the tests that flip between passing and failing in your recent complete runs, " +
+				"by their flip rate and the number of failures fixed by rerunning the failed tests. " +
+				"Use --tag-flaky to tag the worst offenders. " +
+				"Runs don't record whether they rerun another run, so a run with exactly the failed tests " +
+				"of the run before it is taken for a rerun and only counts towards the rerun passes. " +
+				"A run filtered down to just those tests, e.g. with --tag, is taken for a rerun as well.",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "last",
+					Value: 50,
+					Usage: "analyze the last `N` complete runs.",
+				},
+				cli.IntFlag{
+					Name:  "environment-id",
+					Usage: "only analyze runs against the `ENVIRONMENT`.",
+				},
+				cli.IntFlag{
+					Name:  "run-group, run-group-id",
+					Usage: "only analyze runs of the run group. You can see a list of your `RUN-GROUP-ID`s with the run-groups command.",
+				},
+				cli.BoolFlag{
+					Name:  "created-by-cli",
+					Usage: "only analyze runs started with rainforest-cli.",
+				},
+				cli.IntFlag{
+					Name:  "tag-flaky",
+					Usage: "add the --flaky-tag to the `N` flakiest tests.",
+				},
+				cli.StringFlag{
+					Name:  "flaky-tag",
+					Value: "flaky",
+					Usage: "`TAG` added by --tag-flaky.",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "table",
+					Usage: "output `FORMAT`. Available choices are: table or json.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return findFlakyTests(c, api)
+			},
+		},
+		{
+			Name:         "compare",
+			Usage:        "Compare the results of two runs",
+			OnUsageError: onCommandUsageErrorHandler("compare"),
+			ArgsUsage:    "[run A ID] [run B ID]",
+			Description: "Lines up the results of the tests of run B against run A by test ID, " +
+				"showing new failures, fixed tests, tests added or removed and duration changes.",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "duration-threshold",
+					Value: 25,
+					Usage: "report duration changes of at least `PERCENT` percent.",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "table",
+					Usage: "output `FORMAT`. Available choices are: table, markdown or json.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return compareRuns(c, api)
+			},
+		},
 		{
 			Name:         "sites",
 			Usage:        "Lists available sites",
@@ -497,11 +1125,102 @@ func main() {
 		},
 		{
 			Name:         "environments",
-			Usage:        "Lists available environments",
+			Usage:        "Lists and manages environments",
 			OnUsageError: onCommandUsageErrorHandler("environments"),
 			Action: func(c *cli.Context) error {
 				return printEnvironments(api)
 			},
+			Subcommands: []cli.Command{
+				{
+					Name:         "show",
+					Usage:        "Show an environment and its URL for each site",
+					OnUsageError: onCommandUsageErrorHandler("show"),
+					ArgsUsage:    "[environment ID]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "format",
+							Value: "table",
+							Usage: "print the environment as `FORMAT`, one of table or json.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return showEnvironment(c, api)
+					},
+				},
+				{
+					Name:         "create",
+					Usage:        "Create an environment and print its ID",
+					OnUsageError: onCommandUsageErrorHandler("create"),
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name",
+							Usage: "`NAME` of the environment.",
+						},
+						cli.StringFlag{
+							Name:  "url",
+							Usage: "default `URL` of the environment.",
+						},
+						cli.StringSliceFlag{
+							Name:  "site-url",
+							Usage: "set the URL of the environment for a site with `SITE_ID=URL`. Can be used multiple times.",
+						},
+						cli.BoolFlag{
+							Name:  "temporary",
+							Usage: "create a temporary environment, deleted by Rainforest once unused.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return createEnvironment(c, api)
+					},
+				},
+				{
+					Name:         "update",
+					Usage:        "Rename an environment or change its site URLs",
+					OnUsageError: onCommandUsageErrorHandler("update"),
+					ArgsUsage:    "[environment ID]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name",
+							Usage: "new `NAME` of the environment.",
+						},
+						cli.StringSliceFlag{
+							Name:  "site-url",
+							Usage: "set the URL of the environment for a site with `SITE_ID=URL`. Can be used multiple times.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return updateEnvironment(c, api)
+					},
+				},
+				{
+					Name:         "delete",
+					Usage:        "Delete environments",
+					OnUsageError: onCommandUsageErrorHandler("delete"),
+					ArgsUsage:    "[environment IDs]",
+					Action: func(c *cli.Context) error {
+						return deleteEnvironments(c, api)
+					},
+				},
+				{
+					Name:         "cleanup",
+					Usage:        "Delete stale temporary environments",
+					OnUsageError: onCommandUsageErrorHandler("cleanup"),
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "older-than",
+							Value: "24h",
+							Usage: "delete the temporary environments not used by a run or created for `DURATION`.",
+						},
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "list the environments that would be deleted without deleting them.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return cleanupEnvironments(c, api)
+					},
+				},
+			},
 		},
 		{
 			Name:         "folders",
@@ -574,7 +1293,13 @@ func shuffleFlags(originalArgs []string) []string {
 			} else {
 				log.Fatalln("No token specified with --token flag")
 			}
-
+		} else if option == "--config" {
+			if i+1 < len(originalArgs) && originalArgs[i+1][:1] != "-" {
+				globalOptions = append(globalOptions, originalArgs[i:i+2]...)
+				i++
+			} else {
+				log.Fatalln("No path specified with --config flag")
+			}
 		} else if option == "-f" || option == "--files" {
 			rest = append(rest, option)
 			i++
@@ -11,7 +11,7 @@ import (
 )
 
 func TestMain(t *testing.T) {
-	commands := []string{"run", "rerun", "new", "validate", "upload", "rm", "download", "csv-upload", "mobile-upload", "report", "sites", "environments", "folders", "filters", "browsers", "features", "run-groups", "update"}
+	commands := []string{"run", "rerun", "new", "validate", "upload", "edit", "find", "flatten", "extract", "dedupe", "stats", "rm", "download", "csv-upload", "mobile-upload", "report", "wait", "runs", "flaky", "compare", "sites", "environments", "folders", "filters", "browsers", "features", "run-groups", "update"}
 
 	for _, command := range commands {
 		if os.Getenv("TEST_EXIT") == "1" {
@@ -73,6 +73,10 @@ func TestShuffleFlags(t *testing.T) {
 			testArgs: []string{"./rainforest", "run", "-f", "foo.rfml", "--disable-telemetry"},
 			want:     []string{"./rainforest", "--disable-telemetry", "run", "-f", "foo.rfml"},
 		},
+		{
+			testArgs: []string{"./rainforest", "run", "--git-trigger", "--config", "ci.json", "--tag", "foo"},
+			want:     []string{"./rainforest", "--config", "ci.json", "run", "--git-trigger", "--tag", "foo"},
+		},
 	}
 
 	for _, tCase := range testCases {
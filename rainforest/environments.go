@@ -1,5 +1,14 @@
 package rainforest
 
+import (
+	"strconv"
+	"time"
+)
+
+// DefaultTemporaryEnvironmentName is the name of temporary environments
+// created without a name
+const DefaultTemporaryEnvironmentName = "temporary-env-for-custom-url-via-CLI"
+
 // EnvironmentParams are the parameters used to create a new Environment
 type EnvironmentParams struct {
 	Name        string `json:"name"`
@@ -9,16 +18,21 @@ type EnvironmentParams struct {
 
 // Environment represents an environment in Rainforest
 type Environment struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	IsTemporary bool   `json:"is_temporary"`
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url,omitempty"`
+	IsTemporary bool      `json:"is_temporary"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // CreateTemporaryEnvironment creates a new temporary environment and returns the
-// Environment.
-func (c *Client) CreateTemporaryEnvironment(urlString string) (*Environment, error) {
+// Environment. The default name is used if name is empty.
+func (c *Client) CreateTemporaryEnvironment(name, urlString string) (*Environment, error) {
+	if name == "" {
+		name = DefaultTemporaryEnvironmentName
+	}
 	body := EnvironmentParams{
-		Name:        "temporary-env-for-custom-url-via-CLI",
+		Name:        name,
 		URL:         urlString,
 		IsTemporary: true,
 	}
@@ -35,3 +49,91 @@ func (c *Client) CreateTemporaryEnvironment(urlString string) (*Environment, err
 
 	return &env, nil
 }
+
+// DeleteEnvironment deletes the environment.
+func (c *Client) DeleteEnvironment(environmentID int) error {
+	req, err := c.NewRequest("DELETE", "environments/"+strconv.Itoa(environmentID), nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.Do(req, nil)
+	return err
+}
+
+// GetEnvironment fetches an environment.
+func (c *Client) GetEnvironment(environmentID int) (*Environment, error) {
+	req, err := c.NewRequest("GET", "environments/"+strconv.Itoa(environmentID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var env Environment
+	_, err = c.Do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return &env, nil
+}
+
+// CreateEnvironment creates a new environment and returns the Environment.
+func (c *Client) CreateEnvironment(params EnvironmentParams) (*Environment, error) {
+	req, err := c.NewRequest("POST", "environments", &params)
+	if err != nil {
+		return nil, err
+	}
+
+	var env Environment
+	_, err = c.Do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return &env, nil
+}
+
+// EnvironmentUpdate is the body of environments PUT update
+type EnvironmentUpdate struct {
+	Name string `json:"name"`
+}
+
+// UpdateEnvironment renames the environment.
+func (c *Client) UpdateEnvironment(environmentID int, name string) (*Environment, error) {
+	req, err := c.NewRequest("PUT", "environments/"+strconv.Itoa(environmentID), EnvironmentUpdate{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	var env Environment
+	_, err = c.Do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return &env, nil
+}
+
+// GetSiteEnvironments fetches the URLs of the environment for each site.
+func (c *Client) GetSiteEnvironments(environmentID int) ([]SiteEnvironment, error) {
+	siteEnvironments, err := c.getSiteEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []SiteEnvironment{}
+	for _, siteEnvironment := range siteEnvironments {
+		if siteEnvironment.EnvironmentID == environmentID {
+			result = append(result, siteEnvironment)
+		}
+	}
+	return result, nil
+}
+
+// SetSiteURL sets the URL of the environment for the site.
+func (c *Client) SetSiteURL(siteID int, environmentID int, newURL string) error {
+	siteEnvironment, err := c.getSiteEnvironment(siteID, environmentID)
+	if err != nil {
+		return err
+	}
+	return c.setSiteEnvironmentURL(siteEnvironment.ID, newURL)
+}
@@ -26,14 +26,17 @@ func TestCreateTemporaryEnvironment(t *testing.T) {
 				t.Errorf("Error unmarshalling request body: %v", err.Error())
 			}
 
-			resJSON := fmt.Sprintf(`{"id":%v,"name":"%v","temporary":true}`, expectedID, p.Name)
+			if p.Name != "feature-branch" || p.URL != "https://www.rainforestqa.com/" || !p.IsTemporary {
+				t.Errorf("Unexpected environment params %+v", p)
+			}
+			resJSON := fmt.Sprintf(`{"id":%v,"name":"%v","is_temporary":true}`, expectedID, p.Name)
 			w.Write([]byte(resJSON))
 		} else {
 			t.Errorf("Unexpected request method: %v", r.Method)
 		}
 	})
 
-	env, err := client.CreateTemporaryEnvironment("https://www.rainforestqa.com/")
+	env, err := client.CreateTemporaryEnvironment("feature-branch", "https://www.rainforestqa.com/")
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -46,3 +49,141 @@ func TestCreateTemporaryEnvironment(t *testing.T) {
 		t.Error("Name not properly assigned to environment struct. Got empty string.")
 	}
 }
+
+func TestCreateTemporaryEnvironmentDefaultName(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/environments", func(w http.ResponseWriter, r *http.Request) {
+		p := EnvironmentParams{}
+		json.NewDecoder(r.Body).Decode(&p)
+		if p.Name != DefaultTemporaryEnvironmentName {
+			t.Errorf("Expected the default name, got %v", p.Name)
+		}
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	_, err := client.CreateTemporaryEnvironment("", "https://www.rainforestqa.com/")
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestDeleteEnvironment(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	deleted := false
+	mux.HandleFunc("/environments/7331", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("Unexpected request method: %v", r.Method)
+		}
+		deleted = true
+	})
+
+	err := client.DeleteEnvironment(7331)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if !deleted {
+		t.Error("Expected the environment to be deleted")
+	}
+}
+
+func TestGetEnvironment(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/environments/12", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("Unexpected request method: %v", r.Method)
+		}
+		w.Write([]byte(`{"id":12,"name":"staging","is_temporary":false,"created_at":"2020-06-10T12:00:00Z"}`))
+	})
+
+	env, err := client.GetEnvironment(12)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if env.ID != 12 || env.Name != "staging" || env.CreatedAt.Year() != 2020 {
+		t.Errorf("Unexpected environment %+v", env)
+	}
+}
+
+func TestCreateAndUpdateEnvironment(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/environments", func(w http.ResponseWriter, r *http.Request) {
+		p := EnvironmentParams{}
+		json.NewDecoder(r.Body).Decode(&p)
+		if r.Method != "POST" || p.Name != "preview-42" || p.URL != "https://pr-42.example.com" || p.IsTemporary {
+			t.Errorf("Unexpected %v request with %+v", r.Method, p)
+		}
+		w.Write([]byte(`{"id":42,"name":"preview-42"}`))
+	})
+	mux.HandleFunc("/environments/42", func(w http.ResponseWriter, r *http.Request) {
+		p := EnvironmentUpdate{}
+		json.NewDecoder(r.Body).Decode(&p)
+		if r.Method != "PUT" || p.Name != "preview-42-renamed" {
+			t.Errorf("Unexpected %v request with %+v", r.Method, p)
+		}
+		fmt.Fprintf(w, `{"id":42,"name":%q}`, p.Name)
+	})
+
+	env, err := client.CreateEnvironment(EnvironmentParams{Name: "preview-42", URL: "https://pr-42.example.com"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if env.ID != 42 {
+		t.Errorf("Unexpected environment %+v", env)
+	}
+
+	env, err = client.UpdateEnvironment(42, "preview-42-renamed")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if env.Name != "preview-42-renamed" {
+		t.Errorf("Unexpected environment %+v", env)
+	}
+}
+
+func TestSiteEnvironments(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/site_environments", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"site_environments":[
+			{"id":1,"site_id":10,"environment_id":42,"url":"https://pr-42.example.com"},
+			{"id":2,"site_id":11,"environment_id":42,"url":"https://api.pr-42.example.com"},
+			{"id":3,"site_id":10,"environment_id":7,"url":"https://staging.example.com"}
+		]}`))
+	})
+	var updated SiteEnvironmentUpdate
+	mux.HandleFunc("/site_environments/2", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("Unexpected request method: %v", r.Method)
+		}
+		json.NewDecoder(r.Body).Decode(&updated)
+	})
+
+	siteEnvironments, err := client.GetSiteEnvironments(42)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(siteEnvironments) != 2 || siteEnvironments[1].SiteID != 11 {
+		t.Errorf("Unexpected site environments %+v", siteEnvironments)
+	}
+
+	err = client.SetSiteURL(11, 42, "https://api.pr-43.example.com")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if updated.URL != "https://api.pr-43.example.com" {
+		t.Errorf("Unexpected update %+v", updated)
+	}
+
+	if err = client.SetSiteURL(12, 42, "https://example.com"); err == nil {
+		t.Error("Expected an error for a site without the environment")
+	}
+}
@@ -170,23 +170,31 @@ type SiteEnvironment struct {
 	URL           string `json:"url"`
 }
 
-func (c *Client) getSiteEnvironment(siteID int, environmentID int) (SiteEnvironment, error) {
-	var siteEnvironment SiteEnvironment
-
+func (c *Client) getSiteEnvironments() ([]SiteEnvironment, error) {
 	// Prepare request
 	req, err := c.NewRequest("GET", "site_environments", nil)
 	if err != nil {
-		return siteEnvironment, err
+		return nil, err
 	}
 
 	// Send request and process response
 	var resp SiteEnvironmentsData
 	_, err = c.Do(req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.SiteEnvironments, nil
+}
+
+func (c *Client) getSiteEnvironment(siteID int, environmentID int) (SiteEnvironment, error) {
+	var siteEnvironment SiteEnvironment
+
+	siteEnvironments, err := c.getSiteEnvironments()
 	if err != nil {
 		return siteEnvironment, err
 	}
 
-	for _, siteEnvironment := range resp.SiteEnvironments {
+	for _, siteEnvironment := range siteEnvironments {
 		if siteEnvironment.SiteID == siteID && siteEnvironment.EnvironmentID == environmentID {
 			return siteEnvironment, nil
 		}
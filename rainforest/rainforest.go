@@ -131,17 +131,13 @@ func (c *Client) NewRequest(method, urlStr string, body interface{}) (*http.Requ
 			userAgent = append(userAgent, "ci/"+ci_name)
 		}
 
-		var remote string
-		git, err := gitTrigger.NewGitTrigger()
-		if err == nil {
-			remote, err = git.GetRemote()
+		repo, err := gitTrigger.GetRepoInfo()
+		if err == nil && repo.RemoteURL != "" {
+			u, err := giturls.Parse(repo.RemoteURL)
 			if err == nil {
-				u, err := giturls.Parse(remote)
-				if err == nil {
-					// Strip the user details, if any
-					u.User = nil
-					userAgent = append(userAgent, "repo/"+u.String())
-				}
+				// Strip the user details, if any
+				u.User = nil
+				userAgent = append(userAgent, "repo/"+u.String())
 			}
 		}
 	}
@@ -22,15 +22,28 @@ type Folder struct {
 // resources are added to the collection. The caller should handle collecting
 // the collection.
 func (c *Client) getPaginatedResource(endpoint string, coll interface{}, collect func(interface{})) error {
-	req, err := c.NewRequest("GET", endpoint+"?page_size=100", nil)
+	return c.getPaginatedResourceUntil(endpoint, coll, func(coll interface{}) bool {
+		collect(coll)
+		return true
+	})
+}
+
+// getPaginatedResourceUntil works like getPaginatedResource, but stops
+// fetching pages once collect returns false. The endpoint may have a query.
+func (c *Client) getPaginatedResourceUntil(endpoint string, coll interface{}, collect func(interface{}) bool) error {
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+	req, err := c.NewRequest("GET", endpoint+separator+"page_size=100", nil)
 	if err != nil {
 		return err
 	}
 
 	var res *http.Response
 	res, err = c.Do(req, &coll)
-	collect(coll)
-	if err != nil {
+	more := collect(coll)
+	if err != nil || !more {
 		return err
 	}
 
@@ -46,14 +59,14 @@ func (c *Client) getPaginatedResource(endpoint string, coll interface{}, collect
 
 	for i := 1; i < totalPages; i++ {
 		page := strconv.Itoa(i + 1)
-		req, err = c.NewRequest("GET", endpoint+"?page_size=100&page="+page, nil)
+		req, err = c.NewRequest("GET", endpoint+separator+"page_size=100&page="+page, nil)
 		if err != nil {
 			return err
 		}
 
 		res, err = c.Do(req, &coll)
-		collect(coll)
-		if err != nil {
+		more = collect(coll)
+		if err != nil || !more {
 			return err
 		}
 	}
@@ -9,7 +9,6 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -40,6 +39,12 @@ func (e *parseError) Error() string {
 	return fmt.Sprintf("RFML parsing error for test field \"%v\": %v", e.location, e.reason)
 }
 
+// Line returns the line number of the error, or 0 if the error is about a test field.
+func (e *parseError) Line() int {
+	line, _ := strconv.Atoi(e.location)
+	return line
+}
+
 // NewRFMLReader returns RFML parser based on passed io.Reader - typically a RFML file.
 func NewRFMLReader(r io.Reader) *RFMLReader {
 	return &RFMLReader{
@@ -145,6 +150,8 @@ func (r *RFMLReader) ReadAll() (*RFTest, error) {
 					switch value {
 					case "P1", "P2", "P3", "":
 						parsedRFTest.Priority = value
+						// If the value is empty, delete the priority
+						parsedRFTest.RemovePriority = value == ""
 					default:
 						return parsedRFTest, &parseError{lineNumStr, "Priority value must be one of '', P1, P2, P3"}
 					}
@@ -379,22 +386,8 @@ func (c *Client) ParseEmbeddedFiles(test *RFTest) error {
 	replaceEmbeddedFilePaths := func(text string, embeddedFiles []embeddedFile) (string, error) {
 		out := text
 		for _, embed := range embeddedFiles {
-			filePath := embed.path
-			if strings.HasPrefix(filePath, "~/") {
-				var usr *user.User
-				usr, err = user.Current()
-				if err != nil {
-					return "", err
-				}
-				filePath = filepath.Join(usr.HomeDir, filePath[2:])
-			} else if test.RFMLPath == "" {
-				return "", fmt.Errorf("Cannot parse relative file path %v for RFML test %v. RFMLPath field cannot be blank.", filePath, test.RFMLID)
-			} else {
-				rfmlDirectory := filepath.Dir(test.RFMLPath)
-				filePath = filepath.Join(rfmlDirectory, filePath)
-			}
-
-			filePath, err = filepath.Abs(filePath)
+			var filePath string
+			filePath, err = test.embeddedFilePath(embed.path)
 			if err != nil {
 				return "", err
 			}
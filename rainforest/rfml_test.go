@@ -178,10 +178,32 @@ func TestReadAll(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	if rfTest.Priority != "" {
+	if rfTest.Priority != "" || rfTest.RemovePriority {
 		t.Errorf("Incorrect test priority. Got %v, Want empty string", rfTest.Priority)
 	}
 
+	// Test priority is removed
+	testText = fmt.Sprintf(`#! %v
+# title: %v
+# start_uri: %v
+# priority:
+`,
+		validTestValues.RFMLID,
+		validTestValues.Title,
+		validTestValues.StartURI,
+	)
+
+	r = strings.NewReader(testText)
+	reader = NewRFMLReader(r)
+	rfTest, err = reader.ReadAll()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if rfTest.Priority != "" || !rfTest.RemovePriority {
+		t.Errorf("Expected the priority to be removed, got %+v", rfTest)
+	}
+
 	// Comment with a colon
 	expectedComment := "this_should: be a comment"
 	testText = fmt.Sprintf(`#! %v
@@ -337,6 +359,17 @@ func TestReadAll(t *testing.T) {
 	}
 }
 
+func TestParseErrorLine(t *testing.T) {
+	lineErr := &parseError{"3", "Site ID must be a valid integer"}
+	if line := lineErr.Line(); line != 3 {
+		t.Errorf("Expected line 3, got %v", line)
+	}
+	fieldErr := &parseError{"title", "Missing title"}
+	if line := fieldErr.Line(); line != 0 {
+		t.Errorf("Expected no line for a field error, got %v", line)
+	}
+}
+
 func TestWriteRFMLTest(t *testing.T) {
 	var buffer bytes.Buffer
 	writer := NewRFMLWriter(&buffer)
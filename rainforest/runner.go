@@ -3,7 +3,9 @@ package rainforest
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
+	"time"
 )
 
 // RunParams is a struct holding all potential parameters needed to start a new RF run.
@@ -158,3 +160,121 @@ func (c *Client) CheckRunStatus(runID int) (*RunStatus, error) {
 
 	return &runStatus, nil
 }
+
+// Run is a run returned by the API call for a list of runs
+type Run struct {
+	RunStatus
+	Description string    `json:"description,omitempty"`
+	Release     string    `json:"release,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Environment struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"environment"`
+	RunGroupID int    `json:"run_group_id,omitempty"`
+	Source     string `json:"source,omitempty"`
+}
+
+// RunFilters narrow down the runs listed by GetRuns, zero values don't filter.
+type RunFilters struct {
+	State         string
+	Result        string
+	EnvironmentID int
+	RunGroupID    int
+	Release       string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// CreatedByCLI only lists the runs started with rainforest-cli
+	CreatedByCLI bool
+}
+
+// query returns the filters as URL query parameters
+func (f RunFilters) query() url.Values {
+	query := url.Values{}
+	if f.State != "" {
+		query.Set("state", f.State)
+	}
+	if f.Result != "" {
+		query.Set("result", f.Result)
+	}
+	if f.EnvironmentID > 0 {
+		query.Set("environment_id", strconv.Itoa(f.EnvironmentID))
+	}
+	if f.RunGroupID > 0 {
+		query.Set("run_group_id", strconv.Itoa(f.RunGroupID))
+	}
+	if f.Release != "" {
+		query.Set("release", f.Release)
+	}
+	if !f.CreatedAfter.IsZero() {
+		query.Set("created_after", f.CreatedAfter.UTC().Format(time.RFC3339))
+	}
+	if !f.CreatedBefore.IsZero() {
+		query.Set("created_before", f.CreatedBefore.UTC().Format(time.RFC3339))
+	}
+	if f.CreatedByCLI {
+		query.Set("source", "rainforest-cli")
+	}
+	return query
+}
+
+// GetRuns returns the runs matching the filters, most recent first. At most
+// limit runs are returned, or all of them if limit is 0.
+func (c *Client) GetRuns(filters RunFilters, limit int) ([]Run, error) {
+	runs := []Run{}
+
+	collect := func(coll interface{}) bool {
+		for _, run := range *coll.(*[]Run) {
+			if limit > 0 && len(runs) >= limit {
+				return false
+			}
+			runs = append(runs, run)
+		}
+		return limit == 0 || len(runs) < limit
+	}
+
+	endpoint := "runs"
+	if query := filters.query().Encode(); query != "" {
+		endpoint += "?" + query
+	}
+	err := c.getPaginatedResourceUntil(endpoint, &[]Run{}, collect)
+	return runs, err
+}
+
+// RunTest is the result of a test in a run
+type RunTest struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	State  string `json:"state"`
+	Result string `json:"result"`
+	// Duration is how long the test took, in seconds
+	Duration float64 `json:"duration"`
+}
+
+// GetRunTests returns the results of the tests of a run.
+func (c *Client) GetRunTests(runID int) ([]RunTest, error) {
+	tests := []RunTest{}
+
+	collect := func(coll interface{}) {
+		tests = append(tests, *coll.(*[]RunTest)...)
+	}
+
+	err := c.getPaginatedResource(fmt.Sprintf("runs/%v/tests", runID), &[]RunTest{}, collect)
+	return tests, err
+}
+
+// CancelRun aborts a run in progress and returns its status.
+func (c *Client) CancelRun(runID int) (*RunStatus, error) {
+	var runStatus RunStatus
+
+	req, err := c.NewRequest("DELETE", "runs/"+strconv.Itoa(runID), nil)
+	if err != nil {
+		return &runStatus, err
+	}
+	_, err = c.Do(req, &runStatus)
+	if err != nil {
+		return &runStatus, err
+	}
+
+	return &runStatus, nil
+}
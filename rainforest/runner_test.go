@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateRun(t *testing.T) {
@@ -271,3 +274,111 @@ func TestCheckRunStatus(t *testing.T) {
 		t.Errorf("Response out = %v, want %v", out, want)
 	}
 }
+
+func TestGetRuns(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	const pages = 3
+	var requested []string
+
+	mux.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		requested = append(requested, query.Get("page"))
+		want := url.Values{
+			"state":          {"complete"},
+			"result":         {"failed"},
+			"environment_id": {"12"},
+			"created_after":  {"2021-06-01T00:00:00Z"},
+			"source":         {"rainforest-cli"},
+			"page_size":      {"100"},
+		}
+		if query.Get("page") != "" {
+			want.Set("page", query.Get("page"))
+		}
+		if !reflect.DeepEqual(query, want) {
+			t.Errorf("Unexpected query %v, want %v", query, want)
+		}
+
+		w.Header().Add("X-Total-Pages", strconv.Itoa(pages))
+		fmt.Fprint(w, `[
+			{"id": 1, "state": "complete", "result": "failed", "release": "abc", "created_at": "2021-06-02T10:00:00Z",
+			 "environment": {"id": 12, "name": "Staging"}},
+			{"id": 2, "state": "complete", "result": "failed"}
+		]`)
+	})
+
+	filters := RunFilters{
+		State:         "complete",
+		Result:        "failed",
+		EnvironmentID: 12,
+		CreatedAfter:  time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		CreatedByCLI:  true,
+	}
+	runs, err := client.GetRuns(filters, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 3 || runs[0].ID != 1 || runs[2].ID != 1 {
+		t.Errorf("Unexpected runs %+v", runs)
+	}
+	if runs[0].Environment.Name != "Staging" || runs[0].Release != "abc" || runs[0].CreatedAt.Day() != 2 {
+		t.Errorf("Unexpected run %+v", runs[0])
+	}
+	// The last page isn't needed
+	if !reflect.DeepEqual(requested, []string{"", "2"}) {
+		t.Errorf("Requested pages %q, want the first two", requested)
+	}
+
+	requested = nil
+	runs, err = client.GetRuns(filters, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 6 || len(requested) != pages {
+		t.Errorf("Expected all the runs, got %v from pages %q", len(runs), requested)
+	}
+}
+
+func TestGetRunTests(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/runs/12/tests", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("Request method = %v, want GET", r.Method)
+		}
+		w.Header().Add("X-Total-Pages", "2")
+		fmt.Fprint(w, `[{"id": 1, "title": "Login", "state": "complete", "result": "passed", "duration": 42.5}]`)
+	})
+
+	tests, err := client.GetRunTests(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := RunTest{ID: 1, Title: "Login", State: "complete", Result: "passed", Duration: 42.5}
+	if want := []RunTest{test, test}; !reflect.DeepEqual(tests, want) {
+		t.Errorf("GetRunTests returned %+v, want %+v", tests, want)
+	}
+}
+
+func TestCancelRun(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/runs/123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("Request method = %v, want DELETE", r.Method)
+		}
+		fmt.Fprint(w, `{"id": 123, "state": "aborted"}`)
+	})
+
+	out, err := client.CancelRun(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&RunStatus{ID: 123, State: "aborted"}); !reflect.DeepEqual(out, want) {
+		t.Errorf("Response out = %v, want %v", out, want)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os/user"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -111,6 +113,25 @@ type RFTest struct {
 	// executed or just uploaded (e.g. for embedded tests). It defaults to
 	// true when reading from RFML.
 	Execute bool `json:"-"`
+
+	// RemovePriority is a non-API field set by an empty priority in the RFML
+	// file, so the priority is removed when uploading instead of being kept.
+	RemovePriority bool `json:"-"`
+}
+
+// MarshalJSON sends a null priority when the priority is being removed, an
+// empty one is left out and wouldn't change the test.
+func (t *RFTest) MarshalJSON() ([]byte, error) {
+	// plainRFTest has the fields of RFTest but not this method
+	type plainRFTest RFTest
+	if !t.RemovePriority {
+		return json.Marshal((*plainRFTest)(t))
+	}
+	// The outer priority field takes precedence over the embedded one
+	return json.Marshal(struct {
+		*plainRFTest
+		Priority *string `json:"priority"`
+	}{plainRFTest: (*plainRFTest)(t)})
 }
 
 // testElement is one of the helpers to construct the proper JSON test sturcture
@@ -287,6 +308,47 @@ func (s *RFTestStep) embeddedFilesInResponse() []embeddedFile {
 	return findEmbeddedFiles(s.Response)
 }
 
+// embeddedFilePath returns the absolute path of a file embedded in one of the
+// test steps. Relative paths are relative to the RFML file.
+func (t *RFTest) embeddedFilePath(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		usr, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(usr.HomeDir, path[2:])
+	} else if t.RFMLPath == "" {
+		return "", fmt.Errorf("Cannot parse relative file path %v for RFML test %v. RFMLPath field cannot be blank.", path, t.RFMLID)
+	} else {
+		rfmlDirectory := filepath.Dir(t.RFMLPath)
+		path = filepath.Join(rfmlDirectory, path)
+	}
+
+	return filepath.Abs(path)
+}
+
+// EmbeddedFilePaths returns the absolute paths of the local files embedded in
+// the test steps with the file.screenshot and file.download step variables.
+func (t *RFTest) EmbeddedFilePaths() ([]string, error) {
+	var paths []string
+	for _, step := range t.Steps {
+		s, ok := step.(RFTestStep)
+		if !ok {
+			continue
+		}
+
+		embeds := append(s.embeddedFilesInAction(), s.embeddedFilesInResponse()...)
+		for _, embed := range embeds {
+			path, err := t.embeddedFilePath(embed.path)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
 // uploadable contains the information of an embedded step variables
 type embeddedFile struct {
 	// text is the entire step variable text. eg: "{{ file.screenshot(path/to/file) }}"
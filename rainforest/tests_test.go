@@ -383,6 +383,39 @@ func TestHasUploadableFiles(t *testing.T) {
 	}
 }
 
+func TestEmbeddedFilePaths(t *testing.T) {
+	test := RFTest{
+		RFMLID:   "files",
+		RFMLPath: "/tests/a/files.rfml",
+		Steps: []interface{}{
+			RFTestStep{
+				Action:   "{{ file.download(../data/users.csv) }}",
+				Response: "{{ file.screenshot(logo.png) }}?",
+			},
+			RFEmbeddedTest{RFMLID: "other"},
+			RFTestStep{
+				Action:   "{{ file.screenshot(3332, hkBde5) }}",
+				Response: "nothing?",
+			},
+		},
+	}
+
+	got, err := test.EmbeddedFilePaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/tests/data/users.csv", "/tests/a/logo.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EmbeddedFilePaths returned %v, want %v", got, want)
+	}
+
+	// Relative paths need the RFML path
+	test.RFMLPath = ""
+	if _, err = test.EmbeddedFilePaths(); err == nil {
+		t.Error("Expected an error without an RFML path")
+	}
+}
+
 func TestUpdateTest(t *testing.T) {
 	// Test just the required attributes
 	rfTest := RFTest{
@@ -486,8 +519,10 @@ func TestUpdateTest(t *testing.T) {
 		t.Error(err.Error())
 	}
 
-	// Deleted feature ID, empty browsers and tags list
+	// Deleted feature ID and priority, empty browsers and tags list
 	rfTest.FeatureID = deleteFeature
+	rfTest.Priority = ""
+	rfTest.RemovePriority = true
 	rfTest.Browsers = []string{}
 	rfTest.Tags = []string{}
 	rfTest.mapBrowsers()
@@ -515,6 +550,8 @@ func TestUpdateTest(t *testing.T) {
 			t.Errorf("Unexpected tags received. Expected: [], Got: %v", bodyStr)
 		} else if !strings.Contains(bodyStr, "\"feature_id\":null") {
 			t.Errorf("Unexpected folder ID received. Expected: null, Got: %v", bodyStr)
+		} else if !strings.Contains(bodyStr, "\"priority\":null") || strings.Count(bodyStr, "\"priority\"") != 1 {
+			t.Errorf("Unexpected priority received. Expected: null, Got: %v", bodyStr)
 		}
 	})
 
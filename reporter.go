@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// runReport is what reporters are built from: the status of the run and its
+// JUnit results, merged across reruns.
+type runReport struct {
+	status *rainforest.RunStatus
+	// junit is nil if the JUnit results are not available
+	junit *junitReport
+}
+
+// testResult is the result of a single test in a run report
+type testResult struct {
+	Name    string `json:"name"`
+	Result  string `json:"result"`
+	Time    string `json:"time,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Flaky is true if the test passed after failing in a rerun
+	Flaky          bool `json:"flaky"`
+	FailedAttempts int  `json:"failed_attempts,omitempty"`
+}
+
+// tests returns the results of the tests in the report
+func (r *runReport) tests() []testResult {
+	if r.junit == nil {
+		return []testResult{}
+	}
+
+	testCases := r.junit.testCases()
+	results := make([]testResult, len(testCases))
+	for i, tc := range testCases {
+		result := testResult{Name: tc.Name, Result: "passed", Time: tc.Time}
+		failures := append(append([]junitFailure{}, tc.FlakyFailures...), tc.FlakyErrors...)
+		switch {
+		case tc.Failure != nil:
+			result.Result = "failed"
+			failures = append(append([]junitFailure{*tc.Failure}, tc.RerunFailures...), tc.RerunErrors...)
+		case tc.Error != nil:
+			result.Result = "failed"
+			failures = append(append([]junitFailure{*tc.Error}, tc.RerunFailures...), tc.RerunErrors...)
+		case tc.Skipped != nil:
+			result.Result = "skipped"
+			result.Message = tc.Skipped.Message
+		}
+		if len(failures) > 0 {
+			result.Message = failureMessage(failures[0])
+			result.Flaky = result.Result == "passed"
+			result.FailedAttempts = len(failures)
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// failureMessage returns the message of a failure, or its text if it has none
+func failureMessage(f junitFailure) string {
+	if f.Message != "" {
+		return f.Message
+	}
+	return strings.TrimSpace(f.Text)
+}
+
+// reporter writes a run report in a given format
+type reporter interface {
+	write(w io.Writer, report *runReport) error
+}
+
+// reporters are the available report formats
+var reporters = map[string]reporter{
+	"junit":    junitReporter{},
+	"tap":      tapReporter{},
+	"markdown": markdownReporter{},
+	"json":     jsonReporter{},
+	"html":     htmlReporter{},
+}
+
+// reportFormats returns the names of the available report formats
+func reportFormats() []string {
+	formats := make([]string, 0, len(reporters))
+	for format := range reporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// reportOutput is a report format and the file it's written to, or
+// resultsOut if path is empty
+type reportOutput struct {
+	format string
+	path   string
+}
+
+// getReportOutputs parses the --report-format FORMAT[=PATH] options
+func getReportOutputs(c cliContext) ([]reportOutput, error) {
+	var outputs []reportOutput
+	for _, value := range c.StringSlice("report-format") {
+		parts := strings.SplitN(value, "=", 2)
+		output := reportOutput{format: parts[0]}
+		if len(parts) == 2 {
+			output.path = parts[1]
+		}
+		if _, ok := reporters[output.format]; !ok {
+			return nil, fmt.Errorf("Invalid report format %v, use one of %v", output.format, strings.Join(reportFormats(), ", "))
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// writeReports writes the report to all the outputs
+func writeReports(outputs []reportOutput, report *runReport) error {
+	for _, output := range outputs {
+		err := writeReport(output, report)
+		if err != nil {
+			return fmt.Errorf("Unable to write the %v report: %v", output.format, err)
+		}
+	}
+	return nil
+}
+
+func writeReport(output reportOutput, report *runReport) error {
+	if output.path == "" {
+		return reporters[output.format].write(resultsOut, report)
+	}
+
+	file, err := os.Create(output.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return reporters[output.format].write(file, report)
+}
+
+// reportAPI fetches what's needed to report on a finished run
+type reportAPI interface {
+	CheckRunStatus(int) (*rainforest.RunStatus, error)
+	junitAPI
+}
+
+// writeRunReports writes the reports of the run given as argument to the
+// report command
+func writeRunReports(c cliContext, api reportAPI) error {
+	outputs, err := getReportOutputs(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	runID, err := strconv.Atoi(c.Args().First())
+	if err != nil {
+		return cli.NewExitError("No valid run ID argument found.", 1)
+	}
+
+	status, err := api.CheckRunStatus(runID)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	junit, err := fetchRunResults(api, runID, c.String("junit-file"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	err = writeReports(outputs, &runReport{status: status, junit: junit})
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+// junitReporter writes the JUnit results
+type junitReporter struct{}
+
+func (junitReporter) write(w io.Writer, report *runReport) error {
+	if report.junit == nil {
+		return fmt.Errorf("The JUnit results of run %v are not available", report.status.ID)
+	}
+	out, err := xml.MarshalIndent(report.junit, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%v%s\n", xml.Header, out)
+	return err
+}
+
+// tapReporter writes a Test Anything Protocol report
+type tapReporter struct{}
+
+func (tapReporter) write(w io.Writer, report *runReport) error {
+	tests := report.tests()
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%v\n", len(tests))
+	for i, test := range tests {
+		name := strings.Replace(test.Name, "#", "\\#", -1)
+		switch {
+		case test.Result == "failed":
+			fmt.Fprintf(w, "not ok %v - %v\n", i+1, name)
+			fmt.Fprintln(w, "  ---")
+			fmt.Fprintf(w, "  message: %q\n", test.Message)
+			fmt.Fprintf(w, "  attempts: %v\n", test.FailedAttempts)
+			fmt.Fprintln(w, "  ...")
+		case test.Result == "skipped":
+			fmt.Fprintf(w, "ok %v - %v # SKIP %v\n", i+1, name, test.Message)
+		case test.Flaky:
+			fmt.Fprintf(w, "ok %v - %v\n", i+1, name)
+			fmt.Fprintf(w, "# %v passed after %v failed attempt(s)\n", name, test.FailedAttempts)
+		default:
+			fmt.Fprintf(w, "ok %v - %v\n", i+1, name)
+		}
+	}
+	_, err := fmt.Fprintf(w, "# Run %v %v\n", report.status.ID, report.status.Result)
+	return err
+}
+
+// markdownReporter writes a summary for GitHub step summaries and pull
+// request comments
+type markdownReporter struct{}
+
+func (markdownReporter) write(w io.Writer, report *runReport) error {
+	status := report.status
+	fmt.Fprintf(w, "## Rainforest run %v %v\n\n", status.ID, status.Result)
+	fmt.Fprintln(w, "| State | Result | Passed | Failed | Total |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+	fmt.Fprintf(w, "| %v | %v | %v | %v | %v |\n", status.State, status.Result,
+		status.CurrentProgress.Passed, status.CurrentProgress.Failed, status.CurrentProgress.Total)
+	if status.FrontendURL != "" {
+		fmt.Fprintf(w, "\n[View the results](%v)\n", status.FrontendURL)
+	}
+
+	var failed, flaky []testResult
+	for _, test := range report.tests() {
+		if test.Result == "failed" {
+			failed = append(failed, test)
+		} else if test.Flaky {
+			flaky = append(flaky, test)
+		}
+	}
+	escape := strings.NewReplacer("|", "\\|", "\n", " ")
+	if len(failed) > 0 {
+		fmt.Fprint(w, "\n### Failed tests\n\n")
+		fmt.Fprintln(w, "| Test | Message |")
+		fmt.Fprintln(w, "| --- | --- |")
+		for _, test := range failed {
+			fmt.Fprintf(w, "| %v | %v |\n", escape.Replace(test.Name), escape.Replace(test.Message))
+		}
+	}
+	if len(flaky) > 0 {
+		fmt.Fprint(w, "\n### Passed after a rerun\n\n")
+		fmt.Fprintln(w, "| Test | Failed attempts |")
+		fmt.Fprintln(w, "| --- | --- |")
+		for _, test := range flaky {
+			fmt.Fprintf(w, "| %v | %v |\n", escape.Replace(test.Name), test.FailedAttempts)
+		}
+	}
+	return nil
+}
+
+// jsonRunReport is the JSON representation of a run report
+type jsonRunReport struct {
+	RunID  int          `json:"run_id"`
+	State  string       `json:"state"`
+	Result string       `json:"result"`
+	URL    string       `json:"url,omitempty"`
+	Passed int          `json:"passed"`
+	Failed int          `json:"failed"`
+	Total  int          `json:"total"`
+	Tests  []testResult `json:"tests"`
+}
+
+// jsonReporter writes the report as JSON
+type jsonReporter struct{}
+
+func (jsonReporter) write(w io.Writer, report *runReport) error {
+	status := report.status
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonRunReport{
+		RunID:  status.ID,
+		State:  status.State,
+		Result: status.Result,
+		URL:    status.FrontendURL,
+		Passed: status.CurrentProgress.Passed,
+		Failed: status.CurrentProgress.Failed,
+		Total:  status.CurrentProgress.Total,
+		Tests:  report.tests(),
+	})
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Rainforest run {{.Status.ID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.4em 0.8em; text-align: left; }
+.passed { color: #1a7f37; }
+.failed { color: #cf222e; }
+.skipped, .flaky { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>Rainforest run {{.Status.ID}} <span class="{{.Status.Result}}">{{.Status.Result}}</span></h1>
+<p>{{.Status.CurrentProgress.Passed}} passed, {{.Status.CurrentProgress.Failed}} failed, {{.Status.CurrentProgress.Total}} total.
+{{- if .Status.FrontendURL}} <a href="{{.Status.FrontendURL}}">View the results</a>{{end}}</p>
+<table>
+<tr><th>Test</th><th>Result</th><th>Time</th><th>Message</th></tr>
+{{- range .Tests}}
+<tr><td>{{.Name}}</td><td class="{{if .Flaky}}flaky{{else}}{{.Result}}{{end}}">{{.Result}}{{if .Flaky}} after {{.FailedAttempts}} failed attempt(s){{end}}</td><td>{{.Time}}</td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// htmlReporter writes a self-contained HTML report
+type htmlReporter struct{}
+
+func (htmlReporter) write(w io.Writer, report *runReport) error {
+	return htmlReportTemplate.Execute(w, struct {
+		Status *rainforest.RunStatus
+		Tests  []testResult
+	}{report.status, report.tests()})
+}
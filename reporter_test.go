@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func newTestRunReport(t *testing.T) *runReport {
+	var reports []*junitReport
+	for _, xml := range []string{
+		junitReportXML(100, []string{"Login"}, []string{"Checkout", "Search | filters"}),
+		junitReportXML(101, []string{"Search | filters"}, []string{"Checkout"}),
+	} {
+		report, err := parseJunitReport(xml)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports = append(reports, report)
+	}
+
+	status := &rainforest.RunStatus{ID: 101, State: "complete", Result: "failed", FrontendURL: "https://app.rainforestqa.com/runs/101"}
+	status.CurrentProgress.Passed = 2
+	status.CurrentProgress.Failed = 1
+	status.CurrentProgress.Total = 3
+	return &runReport{status: status, junit: mergeJunitReports(reports)}
+}
+
+func TestRunReportTests(t *testing.T) {
+	want := []testResult{
+		{Name: "Login", Result: "passed", Time: "1.5"},
+		{Name: "Checkout", Result: "failed", Message: "Step 2 failed", FailedAttempts: 2},
+		{Name: "Search | filters", Result: "passed", Time: "1.5", Message: "Step 2 failed", Flaky: true, FailedAttempts: 1},
+	}
+	if got := newTestRunReport(t).tests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("tests() returned %+v, want %+v", got, want)
+	}
+
+	empty := &runReport{status: &rainforest.RunStatus{}}
+	if got := empty.tests(); len(got) != 0 {
+		t.Errorf("Expected no tests without JUnit results, got %+v", got)
+	}
+}
+
+func TestReporters(t *testing.T) {
+	report := newTestRunReport(t)
+	testCases := []struct {
+		format string
+		want   []string
+	}{
+		{"junit", []string{`<testsuites tests="3" failures="1" errors="0">`, `<flakyFailure type="failed" message="Step 2 failed">`, `<rerunFailure`}},
+		{"tap", []string{"TAP version 13\n1..3\n", "ok 1 - Login\n", "not ok 2 - Checkout\n  ---\n  message: \"Step 2 failed\"\n  attempts: 2\n", "# Search | filters passed after 1 failed attempt(s)"}},
+		{"markdown", []string{"## Rainforest run 101 failed", "| complete | failed | 2 | 1 | 3 |", "[View the results](https://app.rainforestqa.com/runs/101)", "| Checkout | Step 2 failed |", "| Search \\| filters | 1 |"}},
+		{"html", []string{"<title>Rainforest run 101</title>", `<td class="failed">failed</td>`, `<td class="flaky">passed after 1 failed attempt(s)</td>`}},
+	}
+	for _, tc := range testCases {
+		out := &bytes.Buffer{}
+		err := reporters[tc.format].write(out, report)
+		if err != nil {
+			t.Errorf("%v: %v", tc.format, err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%v: expected %q in:\n%v", tc.format, want, out.String())
+			}
+		}
+	}
+
+	out := &bytes.Buffer{}
+	err := jsonReporter{}.write(out, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got jsonRunReport
+	err = json.Unmarshal(out.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RunID != 101 || got.Result != "failed" || got.Total != 3 || len(got.Tests) != 3 || !got.Tests[2].Flaky {
+		t.Errorf("Unexpected JSON report %+v", got)
+	}
+
+	// JUnit needs the JUnit results
+	err = junitReporter{}.write(out, &runReport{status: report.status})
+	if err == nil {
+		t.Error("Expected an error without JUnit results")
+	}
+}
+
+func TestGetReportOutputs(t *testing.T) {
+	c := newFakeContext(map[string]interface{}{"report-format": []string{"markdown=summary.md", "tap"}}, cli.Args{})
+	outputs, err := getReportOutputs(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []reportOutput{{format: "markdown", path: "summary.md"}, {format: "tap"}}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("getReportOutputs returned %+v, want %+v", outputs, want)
+	}
+
+	c = newFakeContext(map[string]interface{}{"report-format": []string{"xunit"}}, cli.Args{})
+	if _, err = getReportOutputs(c); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestWriteRunReports(t *testing.T) {
+	defer func(w io.Writer) { resultsOut = w }(resultsOut)
+	out := &bytes.Buffer{}
+	resultsOut = out
+
+	dir, err := ioutil.TempDir("", "rainforest-reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &fakeRerunClient{
+		results: map[int]string{100: "failed"},
+		reports: map[int]string{100: junitReportXML(100, []string{"Login"}, []string{"Checkout"})},
+	}
+	c := newFakeContext(map[string]interface{}{
+		"junit-file":    filepath.Join(dir, "junit.xml"),
+		"report-format": []string{"html=" + filepath.Join(dir, "report.html"), "tap"},
+	}, cli.Args{"100"})
+	err = writeRunReports(c, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"junit.xml", "report.html"} {
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %v to be written: %v", name, err)
+		}
+	}
+	if !strings.Contains(out.String(), "not ok 2 - Checkout") {
+		t.Errorf("Unexpected TAP output:\n%v", out.String())
+	}
+
+	c = newFakeContext(map[string]interface{}{"report-format": []string{"tap"}}, cli.Args{})
+	if err = writeRunReports(c, client); err == nil {
+		t.Error("Expected an error without a run ID")
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+// junitFailure is the failure or error of a JUnit test case
+type junitFailure struct {
+	Type    string `xml:"type,attr,omitempty"`
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSkipped marks a skipped JUnit test case
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// junitTestCase is a test case of a JUnit report. The flaky and rerun
+// elements follow the Surefire schema for tests that were rerun.
+type junitTestCase struct {
+	Name          string         `xml:"name,attr"`
+	ClassName     string         `xml:"classname,attr,omitempty"`
+	Time          string         `xml:"time,attr,omitempty"`
+	Failure       *junitFailure  `xml:"failure"`
+	Error         *junitFailure  `xml:"error"`
+	Skipped       *junitSkipped  `xml:"skipped"`
+	FlakyFailures []junitFailure `xml:"flakyFailure"`
+	FlakyErrors   []junitFailure `xml:"flakyError"`
+	RerunFailures []junitFailure `xml:"rerunFailure"`
+	RerunErrors   []junitFailure `xml:"rerunError"`
+}
+
+// junitTestSuite is a test suite of a JUnit report
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr,omitempty"`
+	Time      string          `xml:"time,attr,omitempty"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// junitReport is a JUnit report. Reports with a single testsuite root are
+// read into a report with one suite.
+type junitReport struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	Name       string           `xml:"name,attr,omitempty"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Time       string           `xml:"time,attr,omitempty"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+// passed returns true if the test case has no failure or error
+func (tc junitTestCase) passed() bool {
+	return tc.Failure == nil && tc.Error == nil
+}
+
+// key identifies the test case across the reports of reruns
+func (tc junitTestCase) key() string {
+	return tc.ClassName + "\x00" + tc.Name
+}
+
+// testCases returns the test cases of all the suites
+func (r *junitReport) testCases() []junitTestCase {
+	var testCases []junitTestCase
+	for _, suite := range r.TestSuites {
+		testCases = append(testCases, suite.TestCases...)
+	}
+	return testCases
+}
+
+// updateCounts recomputes the test, failure and error counts
+func (r *junitReport) updateCounts() {
+	r.Tests, r.Failures, r.Errors = 0, 0, 0
+	for i := range r.TestSuites {
+		suite := &r.TestSuites[i]
+		suite.Tests, suite.Failures, suite.Errors, suite.Skipped = len(suite.TestCases), 0, 0, 0
+		for _, tc := range suite.TestCases {
+			switch {
+			case tc.Failure != nil:
+				suite.Failures++
+			case tc.Error != nil:
+				suite.Errors++
+			case tc.Skipped != nil:
+				suite.Skipped++
+			}
+		}
+		r.Tests += suite.Tests
+		r.Failures += suite.Failures
+		r.Errors += suite.Errors
+	}
+}
+
+// parseJunitReport parses a JUnit report with a testsuites or testsuite root
+func parseJunitReport(report string) (*junitReport, error) {
+	decoder := xml.NewDecoder(strings.NewReader(report))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("JUnit report has no testsuites or testsuite element")
+		} else if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "testsuites":
+			result := &junitReport{}
+			err = decoder.DecodeElement(result, &start)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
+		case "testsuite":
+			var suite junitTestSuite
+			err = decoder.DecodeElement(&suite, &start)
+			if err != nil {
+				return nil, err
+			}
+			result := &junitReport{Name: suite.Name, Time: suite.Time, TestSuites: []junitTestSuite{suite}}
+			result.updateCounts()
+			return result, nil
+		default:
+			return nil, fmt.Errorf("Unexpected JUnit root element %v", start.Name.Local)
+		}
+	}
+}
+
+// mergeJunitReports merges the reports of a run and its reruns, oldest
+// first. Tests that eventually passed keep their earlier failures as
+// flakyFailure and flakyError elements, tests that never passed keep their
+// first failure and record the following ones as rerunFailure and rerunError
+// elements.
+func mergeJunitReports(reports []*junitReport) *junitReport {
+	merged := &junitReport{Name: reports[0].Name, Time: reports[0].Time}
+	attempts := map[string][]junitTestCase{}
+	positions := map[string][2]int{}
+	for _, report := range reports {
+		for _, suite := range report.TestSuites {
+			for _, tc := range suite.TestCases {
+				key := tc.key()
+				if _, ok := positions[key]; !ok {
+					suiteIndex := mergedSuiteIndex(merged, suite)
+					merged.TestSuites[suiteIndex].TestCases = append(merged.TestSuites[suiteIndex].TestCases, tc)
+					positions[key] = [2]int{suiteIndex, len(merged.TestSuites[suiteIndex].TestCases) - 1}
+				}
+				attempts[key] = append(attempts[key], tc)
+			}
+		}
+	}
+
+	for key, pos := range positions {
+		merged.TestSuites[pos[0]].TestCases[pos[1]] = mergeTestCaseAttempts(attempts[key])
+	}
+	merged.updateCounts()
+	return merged
+}
+
+// mergedSuiteIndex returns the index of the merged suite named like suite,
+// adding it if needed.
+func mergedSuiteIndex(merged *junitReport, suite junitTestSuite) int {
+	for i, s := range merged.TestSuites {
+		if s.Name == suite.Name {
+			return i
+		}
+	}
+	merged.TestSuites = append(merged.TestSuites, junitTestSuite{Name: suite.Name, Time: suite.Time})
+	return len(merged.TestSuites) - 1
+}
+
+// mergeTestCaseAttempts merges the results of a test case across attempts
+func mergeTestCaseAttempts(attempts []junitTestCase) junitTestCase {
+	last := attempts[len(attempts)-1]
+	if last.passed() {
+		result := last
+		for _, tc := range attempts[:len(attempts)-1] {
+			if tc.Failure != nil {
+				result.FlakyFailures = append(result.FlakyFailures, *tc.Failure)
+			}
+			if tc.Error != nil {
+				result.FlakyErrors = append(result.FlakyErrors, *tc.Error)
+			}
+		}
+		return result
+	}
+
+	var result *junitTestCase
+	for _, tc := range attempts {
+		if tc.passed() {
+			continue
+		}
+		if result == nil {
+			tc := tc
+			result = &tc
+			continue
+		}
+		if tc.Failure != nil {
+			result.RerunFailures = append(result.RerunFailures, *tc.Failure)
+		}
+		if tc.Error != nil {
+			result.RerunErrors = append(result.RerunErrors, *tc.Error)
+		}
+	}
+	return *result
+}
+
+// writeJunitReport writes the report to junitFile
+func writeJunitReport(report *junitReport, junitFile string) error {
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(junitFile, append([]byte(xml.Header), append(out, '\n')...), 0666)
+}
+
+// mergeAttemptReports merges the JUnit reports of the attempts
+func mergeAttemptReports(attempts []runAttempt) (*junitReport, error) {
+	var reports []*junitReport
+	for _, attempt := range attempts {
+		if attempt.report == nil {
+			return nil, fmt.Errorf("Unable to merge the JUnit reports, the report of run %v is missing", attempt.runID)
+		}
+		reports = append(reports, attempt.report)
+	}
+	return mergeJunitReports(reports), nil
+}
+
+// runAttempt is a run or one of its reruns
+type runAttempt struct {
+	runID  int
+	status *rainforest.RunStatus
+	// report is nil if the JUnit report is not available
+	report *junitReport
+}
+
+// fetchRunResults fetches the JUnit report of the run and writes it to
+// junitFile if one is given.
+func fetchRunResults(api junitAPI, runID int, junitFile string) (*junitReport, error) {
+	report, err := api.GetRunJunit(runID)
+	if err != nil {
+		return nil, err
+	}
+	if junitFile != "" {
+		err = ioutil.WriteFile(junitFile, []byte(*report), 0666)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parseJunitReport(*report)
+}
+
+// rerunOutcome is the result of a test that failed at least once
+type rerunOutcome struct {
+	name     string
+	passed   bool
+	attempts int
+}
+
+// rerunOutcomes returns the tests that failed in any of the attempts, in the
+// order they first failed, with their latest result.
+func rerunOutcomes(attempts []runAttempt) []*rerunOutcome {
+	var outcomes []*rerunOutcome
+	byKey := map[string]*rerunOutcome{}
+	attemptsByKey := map[string]int{}
+	for _, attempt := range attempts {
+		if attempt.report == nil {
+			continue
+		}
+		for _, tc := range attempt.report.testCases() {
+			key := tc.key()
+			attemptsByKey[key]++
+			outcome, ok := byKey[key]
+			if !ok && !tc.passed() {
+				outcome = &rerunOutcome{name: tc.Name}
+				byKey[key] = outcome
+				outcomes = append(outcomes, outcome)
+			}
+			if outcome != nil {
+				outcome.passed = tc.passed()
+				outcome.attempts = attemptsByKey[key]
+			}
+		}
+	}
+	return outcomes
+}
+
+// printRerunSummary prints which of the failed tests passed after a rerun
+func printRerunSummary(attempts []runAttempt) {
+	outcomes := rerunOutcomes(attempts)
+
+	var rows [][]string
+	passedAfterRerun := 0
+	for _, outcome := range outcomes {
+		result := "failed"
+		if outcome.passed {
+			result = "passed after rerun"
+			passedAfterRerun++
+		}
+		rows = append(rows, []string{outcome.name, result, strconv.Itoa(outcome.attempts)})
+	}
+
+	log.Printf("%v of %v failed test(s) passed only after a rerun, %v attempt(s) in total",
+		passedAfterRerun, len(outcomes), len(attempts))
+	if len(rows) > 0 {
+		printResourceTable([]string{"Test", "Result", "Attempts"}, rows)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+const rerunJunitTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="Run %v" tests="2">%v
+  </testsuite>
+</testsuites>`
+
+func junitReportXML(runID int, passed []string, failed []string) string {
+	var cases string
+	for _, name := range passed {
+		cases += fmt.Sprintf("\n    <testcase name=%q classname=\"rainforest\" time=\"1.5\"/>", name)
+	}
+	for _, name := range failed {
+		cases += fmt.Sprintf("\n    <testcase name=%q classname=\"rainforest\"><failure type=\"failed\" message=\"Step 2 failed\">details</failure></testcase>", name)
+	}
+	return fmt.Sprintf(rerunJunitTemplate, runID, cases)
+}
+
+// fakeRerunClient serves the results of a run and its reruns
+type fakeRerunClient struct {
+	fakeRunnerClient
+	results map[int]string
+	reports map[int]string
+	reruns  []rainforest.RunParams
+}
+
+func (f *fakeRerunClient) CreateRun(p rainforest.RunParams) (*rainforest.RunStatus, error) {
+	f.reruns = append(f.reruns, p)
+	return &rainforest.RunStatus{ID: p.RunID + 1}, nil
+}
+
+func (f *fakeRerunClient) CheckRunStatus(runID int) (*rainforest.RunStatus, error) {
+	status := &rainforest.RunStatus{ID: runID, State: "complete", Result: f.results[runID]}
+	status.StateDetails.IsFinalState = true
+	return status, nil
+}
+
+func (f *fakeRerunClient) GetRunJunit(runID int) (*string, error) {
+	report := f.reports[runID]
+	return &report, nil
+}
+
+func TestParseJunitReport(t *testing.T) {
+	report, err := parseJunitReport(junitReportXML(1, []string{"Login"}, []string{"Checkout"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []junitTestCase{
+		{Name: "Login", ClassName: "rainforest", Time: "1.5"},
+		{Name: "Checkout", ClassName: "rainforest", Failure: &junitFailure{Type: "failed", Message: "Step 2 failed", Text: "details"}},
+	}
+	if !reflect.DeepEqual(report.testCases(), want) {
+		t.Errorf("parseJunitReport returned %+v, want %+v", report.testCases(), want)
+	}
+	if !want[0].passed() || want[1].passed() {
+		t.Error("Unexpected passed() results")
+	}
+
+	// A single testsuite root works too
+	report, err = parseJunitReport(`<testsuite name="Run 1"><testcase name="Login"><error/></testcase></testsuite>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.TestSuites) != 1 || report.Tests != 1 || report.Errors != 1 || report.testCases()[0].passed() {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	for _, invalid := range []string{"<testsuite><testcase>", "<html></html>", ""} {
+		if _, err = parseJunitReport(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestMergeJunitReports(t *testing.T) {
+	var reports []*junitReport
+	for i, xml := range []string{
+		junitReportXML(100, []string{"Login"}, []string{"Checkout", "Search"}),
+		junitReportXML(101, []string{"Search"}, []string{"Checkout"}),
+		junitReportXML(102, nil, []string{"Checkout"}),
+	} {
+		report, err := parseJunitReport(xml)
+		if err != nil {
+			t.Fatalf("Report %v: %v", i, err)
+		}
+		reports = append(reports, report)
+	}
+
+	merged := mergeJunitReports(reports)
+	failure := junitFailure{Type: "failed", Message: "Step 2 failed", Text: "details"}
+	want := &junitReport{
+		Tests:    3,
+		Failures: 1,
+		TestSuites: []junitTestSuite{{
+			Name:     "Run 100",
+			Tests:    3,
+			Failures: 1,
+			TestCases: []junitTestCase{
+				{Name: "Login", ClassName: "rainforest", Time: "1.5"},
+				{Name: "Checkout", ClassName: "rainforest", Failure: &failure, RerunFailures: []junitFailure{failure, failure}},
+				{Name: "Search", ClassName: "rainforest", Time: "1.5", FlakyFailures: []junitFailure{failure}},
+			},
+		}},
+	}
+	merged.XMLName = want.XMLName
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("mergeJunitReports returned %+v, want %+v", merged, want)
+	}
+}
+
+func TestMonitorRunStatusReruns(t *testing.T) {
+	defer func(d time.Duration) { runStatusPollInterval = d }(runStatusPollInterval)
+	runStatusPollInterval = time.Millisecond
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+
+	dir, err := ioutil.TempDir("", "rainforest-rerun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	junitFile := filepath.Join(dir, "results.xml")
+
+	testCases := []struct {
+		name       string
+		results    map[int]string
+		maxReruns  uint
+		wantError  bool
+		wantReruns []rainforest.RunParams
+		wantFiles  []string
+		wantTable  []string
+	}{
+		{
+			name:      "passes after reruns",
+			results:   map[int]string{100: "failed", 101: "failed", 102: "passed"},
+			maxReruns: 3,
+			wantReruns: []rainforest.RunParams{
+				{RunID: 100, Conflict: "abort"},
+				{RunID: 101, Conflict: "abort"},
+			},
+			wantFiles: []string{"results.xml", "results.xml.1", "results.xml.2"},
+			wantTable: []string{"Checkout | passed after rerun |        3", "Search   | passed after rerun |        2"},
+		},
+		{
+			name:       "fails after the last rerun",
+			results:    map[int]string{100: "failed", 101: "failed", 102: "passed"},
+			maxReruns:  1,
+			wantError:  true,
+			wantReruns: []rainforest.RunParams{{RunID: 100, Conflict: "abort"}},
+			wantFiles:  []string{"results.xml", "results.xml.1"},
+			wantTable:  []string{"Checkout | failed             |        2", "Search   | passed after rerun |        2"},
+		},
+		{
+			name:      "no reruns needed",
+			results:   map[int]string{100: "passed"},
+			maxReruns: 2,
+			wantFiles: []string{"results.xml"},
+		},
+	}
+
+	for _, tc := range testCases {
+		os.RemoveAll(dir)
+		os.Mkdir(dir, 0777)
+		out := &bytes.Buffer{}
+		tablesOut = out
+
+		client := &fakeRerunClient{
+			results: tc.results,
+			reports: map[int]string{
+				100: junitReportXML(100, []string{"Login"}, []string{"Checkout", "Search"}),
+				101: junitReportXML(101, []string{"Search"}, []string{"Checkout"}),
+				102: junitReportXML(102, []string{"Checkout"}, nil),
+			},
+		}
+		r := newRunner()
+		r.client = client
+		c := newFakeContext(map[string]interface{}{
+			"junit-file": junitFile,
+			"max-reruns": tc.maxReruns,
+			"conflict":   "abort",
+		}, cli.Args{})
+
+		err := r.monitorRunStatus(c, 100)
+		if (err != nil) != tc.wantError {
+			t.Errorf("%v: unexpected error %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(client.reruns, tc.wantReruns) {
+			t.Errorf("%v: started reruns %+v, want %+v", tc.name, client.reruns, tc.wantReruns)
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*"))
+		for i, file := range files {
+			files[i] = filepath.Base(file)
+		}
+		if !reflect.DeepEqual(files, tc.wantFiles) {
+			t.Errorf("%v: wrote JUnit files %v, want %v", tc.name, files, tc.wantFiles)
+		}
+
+		for _, row := range tc.wantTable {
+			if !strings.Contains(out.String(), row) {
+				t.Errorf("%v: expected %q in the summary:\n%v", tc.name, row, out.String())
+			}
+		}
+		if len(tc.wantTable) == 0 && out.Len() > 0 {
+			t.Errorf("%v: unexpected summary:\n%v", tc.name, out.String())
+		}
+	}
+}
+
+func TestMonitorRunStatusMergedJunit(t *testing.T) {
+	defer func(d time.Duration) { runStatusPollInterval = d }(runStatusPollInterval)
+	runStatusPollInterval = time.Millisecond
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	tablesOut = &bytes.Buffer{}
+
+	dir, err := ioutil.TempDir("", "rainforest-rerun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	junitFile := filepath.Join(dir, "results.xml")
+
+	client := &fakeRerunClient{
+		results: map[int]string{100: "failed", 101: "passed"},
+		reports: map[int]string{
+			100: junitReportXML(100, []string{"Login"}, []string{"Checkout"}),
+			101: junitReportXML(101, []string{"Checkout"}, nil),
+		},
+	}
+	r := newRunner()
+	r.client = client
+	c := newFakeContext(map[string]interface{}{
+		"junit-file":  junitFile,
+		"junit-merge": true,
+		"max-reruns":  uint(2),
+	}, cli.Args{})
+
+	err = r.monitorRunStatus(c, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 {
+		t.Fatalf("Expected only the merged report, got %v", files)
+	}
+	merged, err := ioutil.ReadFile(junitFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := parseJunitReport(string(merged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Tests != 2 || report.Failures != 0 {
+		t.Errorf("Unexpected merged counts %+v", report)
+	}
+	if !strings.Contains(string(merged), `<flakyFailure type="failed" message="Step 2 failed">details</flakyFailure>`) {
+		t.Errorf("Expected a flakyFailure in the merged report:\n%s", merged)
+	}
+}
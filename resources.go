@@ -34,6 +34,11 @@ type resourceAPI interface {
 	GetEnvironments() ([]rainforest.Environment, error)
 	GetFeatures() ([]rainforest.Feature, error)
 	GetRunGroups() ([]rainforest.RunGroup, error)
+	junitAPI
+}
+
+// junitAPI fetches the JUnit reports of runs
+type junitAPI interface {
 	GetRunJunit(int) (*string, error)
 }
 
@@ -178,24 +183,27 @@ func writeJunit(c cliContext, api resourceAPI, runID int) error {
 		return cli.NewExitError("JUnit output file not specified", 1)
 	}
 
-	rerunAttempt := c.Uint("rerun-attempt")
-	if rerunAttempt > 0 {
-		junitFile = augmentJunitFileName(junitFile, rerunAttempt)
+	err = writeJunitFile(api, runID, junitFile)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
 	}
 
+	return nil
+}
+
+// writeJunitFile fetches the junit.xml of the run and writes it to junitFile
+func writeJunitFile(api junitAPI, runID int, junitFile string) error {
 	xml, err := api.GetRunJunit(runID)
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return err
 	}
 
 	file, err := os.Create(junitFile)
-	defer file.Close()
-
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
-	} else {
-		file.WriteString(*xml)
+		return err
 	}
+	defer file.Close()
 
-	return nil
+	_, err = file.WriteString(*xml)
+	return err
 }
@@ -26,21 +26,43 @@ func (e fileParseError) Error() string {
 	return fmt.Sprintf("%v: %v", e.filePath, e.parseError.Error())
 }
 
+// line returns the line of the parse error, or 0 if it isn't known
+func (e fileParseError) line() int {
+	if err, ok := e.parseError.(interface{ Line() int }); ok {
+		return err.Line()
+	}
+	return 0
+}
+
 // validateRFML is a wrapper around two other validation functions
 // first one for the single file and the other for whole directory
 func validateRFML(c cliContext, api rfmlAPI) error {
+	if c.Bool("watch") {
+		return watchRFML(c, api, false)
+	}
+	annotator, err := getAnnotator(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
 	if path := c.Args().First(); path != "" {
-		err := validateSingleRFMLFile(path)
+		err = validateSingleRFMLFile(path)
 		if err != nil {
+			annotateErrors(annotator, []error{err})
 			return cli.NewExitError(err.Error(), 1)
 		}
 		return nil
 	}
 	tests, err := readRFMLFiles([]string{c.String("test-folder")})
+	if err != nil {
+		annotateErrors(annotator, []error{err})
+		return cli.NewExitError(err.Error(), 1)
+	}
+	validationErrors, err := findValidationErrors(tests, false, api)
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
-	err = validateRFMLFiles(tests, false, api)
+	annotateErrors(annotator, validationErrors)
+	err = reportValidationErrors(validationErrors)
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
@@ -155,7 +177,16 @@ var errValidation = errors.New("Validation failed")
 // validateRFMLFiles validates RFML file syntax, embedded rfml ids, checks for
 // circular dependiences and all other cool things in the specified directory
 func validateRFMLFiles(parsedTests []*rainforest.RFTest, localOnly bool, api rfmlAPI) error {
-	// parse all of them files
+	validationErrors, err := findValidationErrors(parsedTests, localOnly, api)
+	if err != nil {
+		return err
+	}
+	return reportValidationErrors(validationErrors)
+}
+
+// findValidationErrors returns the problems found in the parsed tests. The
+// error is set if the tests couldn't be checked against the API.
+func findValidationErrors(parsedTests []*rainforest.RFTest, localOnly bool, api rfmlAPI) ([]error, error) {
 	var validationErrors []error
 	var err error
 	dependencyGraph := goraph.NewGraph()
@@ -177,7 +208,7 @@ func validateRFMLFiles(parsedTests []*rainforest.RFTest, localOnly bool, api rfm
 	if !localOnly && api.ClientToken() != "" {
 		externalTests, err := api.GetTestIDs()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		for _, externalTest := range externalTests {
 			if _, ok := rfmlIDToTest[externalTest.RFMLID]; !ok {
@@ -217,7 +248,12 @@ func validateRFMLFiles(parsedTests []*rainforest.RFTest, localOnly bool, api rfm
 			validationErrors = append(validationErrors, err)
 		}
 	}
+	return validationErrors, nil
+}
 
+// reportValidationErrors logs the validation errors, returning errValidation
+// if there are any
+func reportValidationErrors(validationErrors []error) error {
 	if len(validationErrors) > 0 {
 		for _, err := range validationErrors {
 			log.Print(err.Error())
@@ -347,6 +383,9 @@ func uploadRFML(c cliContext, api rfmlAPI) error {
 	if c.Bool("synchronous-upload") {
 		rfmlUploadConcurrency = 1
 	}
+	if c.Bool("watch") {
+		return watchRFML(c, api, true)
+	}
 	if path := c.Args().First(); path != "" {
 		err := uploadSingleRFMLFile(path)
 		if err != nil {
@@ -9,7 +9,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
 	"github.com/rainforestapp/rainforest-cli/gittrigger"
@@ -19,13 +19,23 @@ import (
 
 type runnerAPI interface {
 	CreateRun(params rainforest.RunParams) (*rainforest.RunStatus, error)
-	CreateTemporaryEnvironment(string) (*rainforest.Environment, error)
+	CreateTemporaryEnvironment(string, string) (*rainforest.Environment, error)
 	CheckRunStatus(int) (*rainforest.RunStatus, error)
+	CancelRun(int) (*rainforest.RunStatus, error)
+	GetRunTests(int) ([]rainforest.RunTest, error)
+	environmentsAPI
+	junitAPI
 	rfmlAPI
 }
 
 type runner struct {
 	client runnerAPI
+	// createdEnvironment is the temporary environment created for --custom-url
+	createdEnvironment *rainforest.Environment
+	// activeRuns are the started runs not known to be done, the temporary
+	// environment isn't deleted while any of them may still use it
+	activeRuns   map[int]bool
+	activeRunsMu sync.Mutex
 }
 
 func startRun(c cliContext) error {
@@ -50,7 +60,7 @@ func (r *runner) startRun(c cliContext) error {
 		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
-		return monitorRunStatus(c, runID)
+		return r.monitorRunStatus(c, runID)
 	}
 
 	// verify --max-reruns is not used with either --fail-fast or --background
@@ -64,38 +74,66 @@ func (r *runner) startRun(c cliContext) error {
 			1,
 		)
 	}
+	if c.Bool("delete-environment") && background {
+		return cli.NewExitError("You can't use --delete-environment with --background, the run needs its environment.", 1)
+	}
+
+	legs, err := getMatrixLegs(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getReportOutputs(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getAnnotator(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getPollSettings(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getNotifyTargets(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getNotifyTemplate(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getRunPolicy(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if len(legs) > 0 && maxReruns > 0 {
+		return cli.NewExitError("You can't use --max-reruns with a run matrix.", 1)
+	}
 
 	var localTests []*rainforest.RFTest
-	var err error
 	if c.Bool("f") {
 		localTests, err = r.prepareLocalRun(c)
 		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
+		if c.String("changed-since") != "" && len(localTests) == 0 {
+			log.Print("No tests are affected by the changes, not starting a run.")
+			return nil
+		}
+	} else if c.String("changed-since") != "" {
+		return cli.NewExitError("--changed-since can only be used with run -f", 1)
 	}
 
 	params, err := r.makeRunParams(c, localTests)
+	if c.Bool("delete-environment") {
+		defer r.deleteTemporaryEnvironment()
+	}
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
 
 	if c.Bool("git-trigger") {
-		git, err := gitTrigger.NewGitTrigger()
+		trigger, err := applyGitTrigger(c, &params)
 		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
-		if !git.CheckTrigger() {
-			log.Printf("Git trigger enabled, but %v was not found in latest commit. Exiting...", git.Trigger)
+		if !trigger {
 			return nil
 		}
-		if tags := git.GetTags(); len(tags) > 0 {
-			if len(params.Tags) == 0 {
-				log.Print("Found tag list in the commit message, overwriting argument.")
-			} else {
-				log.Print("Found tag list in the commit message.")
-			}
-			params.Tags = tags
-		}
 	}
 
 	err = preRunCSVUpload(c, api)
@@ -103,18 +141,30 @@ func (r *runner) startRun(c cliContext) error {
 		return cli.NewExitError(err.Error(), 1)
 	}
 
+	if len(legs) > 0 {
+		return r.runMatrix(c, params, legs)
+	}
+
 	runStatus, err := r.client.CreateRun(params)
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
+	r.runStarted(runStatus.ID)
 	r.showRunCreated(runStatus)
 
+	if path := c.String("state-file"); path != "" {
+		err = recordStartedRuns(path, []startedRun{newStartedRun(runStatus, params, "")})
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
 	// if background flag is enabled we'll skip monitoring run status
 	if c.Bool("bg") {
 		return nil
 	}
 
-	return monitorRunStatus(c, runStatus.ID)
+	return r.monitorRunStatus(c, runStatus.ID)
 }
 
 // rerunRun reruns failed tests from a previous Rainforest run & depending on passed flags monitors its execution
@@ -123,18 +173,43 @@ func (r *runner) rerunRun(c cliContext) error {
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
+	if _, err = getReportOutputs(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getAnnotator(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getPollSettings(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getNotifyTargets(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getNotifyTemplate(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if _, err = getRunPolicy(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
 	runStatus, err := r.client.CreateRun(params)
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
 	r.showRunCreated(runStatus)
 
+	if path := c.String("state-file"); path != "" {
+		err = recordStartedRuns(path, []startedRun{newStartedRun(runStatus, params, "")})
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
 	// if background flag is enabled we'll skip monitoring run status
 	if c.Bool("bg") {
 		return nil
 	}
 
-	return monitorRunStatus(c, runStatus.ID)
+	return r.monitorRunStatus(c, runStatus.ID)
 }
 
 func (r *runner) showRunCreated(runStatus *rainforest.RunStatus) {
@@ -183,16 +258,107 @@ func (r *runner) prepareLocalRun(c cliContext) ([]*rainforest.RFTest, error) {
 		}
 		forceSkip[abs] = true
 	}
-	return filterExecuteTests(tests, tags, forceExecute, forceSkip), nil
+	executeTests := filterExecuteTests(tests, tags, forceExecute, forceSkip)
+
+	if ref := c.String("changed-since"); ref != "" {
+		changedFiles, err := getChangedFiles(ref)
+		if err != nil {
+			return nil, err
+		}
+		affected, err := filterChangedTests(tests, changedFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		var result []*rainforest.RFTest
+		for _, test := range executeTests {
+			if affected[test] {
+				result = append(result, test)
+			}
+		}
+		log.Printf("%v of %v tests are affected by changes since %v", len(result), len(executeTests), ref)
+		executeTests = result
+	}
+
+	return executeTests, nil
+}
+
+// getChangedFiles returns the absolute paths of files changed since the git ref
+var getChangedFiles = func(ref string) ([]string, error) {
+	git, err := gitTrigger.NewGitTrigger()
+	if err != nil {
+		return nil, err
+	}
+	return git.GetChangedFiles(ref)
+}
+
+// filterChangedTests returns the tests affected by the changed files: tests
+// whose RFML file or one of the files embedded in their steps changed, plus
+// every test embedding an affected test, directly or not.
+func filterChangedTests(tests []*rainforest.RFTest, changedFiles []string) (map[*rainforest.RFTest]bool, error) {
+	changed := map[string]bool{}
+	for _, file := range changedFiles {
+		changed[comparablePath(file)] = true
+	}
+
+	// Reverse of the embed graph walked by filterUploadTests
+	embeddedBy := map[string][]*rainforest.RFTest{}
+	for _, test := range tests {
+		for _, id := range embeddedRFMLIDs(test) {
+			embeddedBy[id] = append(embeddedBy[id], test)
+		}
+	}
+
+	affected := map[*rainforest.RFTest]bool{}
+	var q []*rainforest.RFTest
+	for _, test := range tests {
+		isChanged := changed[comparablePath(test.RFMLPath)]
+		if !isChanged {
+			files, err := test.EmbeddedFilePaths()
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				isChanged = isChanged || changed[comparablePath(file)]
+			}
+		}
+		if isChanged {
+			affected[test] = true
+			q = append(q, test)
+		}
+	}
+	for len(q) > 0 {
+		t := q[len(q)-1]
+		q = q[:len(q)-1]
+
+		for _, embedder := range embeddedBy[t.RFMLID] {
+			if !affected[embedder] {
+				affected[embedder] = true
+				q = append(q, embedder)
+			}
+		}
+	}
+
+	return affected, nil
+}
+
+// comparablePath returns the absolute path with symlinks resolved so that
+// paths from git and from the test folder can be compared.
+func comparablePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
 }
 
 // filterUploadTests pre-filters tests for upload. The rule is: upload anything
 // with the tag *plus* anything that is depended on by a tagged test.
 func filterUploadTests(tests []*rainforest.RFTest, tags []string) ([]*rainforest.RFTest, error) {
-	testsByID := map[string]*rainforest.RFTest{}
-	for _, test := range tests {
-		testsByID[test.RFMLID] = test
-	}
+	testsByID := rfmlTestsByID(tests)
 
 	// DFS for filtered tests + embeds
 	includedTests := make(map[*rainforest.RFTest]bool)
@@ -251,49 +417,248 @@ func filterExecuteTests(tests []*rainforest.RFTest, tags []string, forceExecute,
 	return result
 }
 
-func monitorRunStatus(c cliContext, runID int) error {
-	failedAttempts := 1
+// monitorRunStatus waits for the run to finish and writes its JUnit report.
+// Failed tests are rerun in place up to --max-reruns times, and a summary of
+// the tests that needed a rerun is printed at the end. Whether the run failed
+// and the exit code are up to the run policy.
+func (r *runner) monitorRunStatus(c cliContext, runID int) error {
+	junitFile := c.String("junit-file")
+	maxReruns := c.Uint("max-reruns")
+	var attempt uint
+	mergeJunit := junitFile != "" && c.Bool("junit-merge")
+	conflict, err := getConflict(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	reportOutputs, err := getReportOutputs(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	annotator, err := getAnnotator(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	poll, err := getPollSettings(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	notifyTargets, err := getNotifyTargets(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	notifyTemplate, err := getNotifyTemplate(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	policy, err := getRunPolicy(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	errorCode := policy.exitCodes["error"]
+	err = policy.loadKnownIssues(r.client)
+	if err != nil {
+		return cli.NewExitError(err.Error(), errorCode)
+	}
+	// The reports are also needed for the failed tests of notifications
+	needReport := len(reportOutputs) > 0 || annotator != nil || len(notifyTargets) > 0
 
+	var attempts []runAttempt
+	timedOut := false
+	outcome := "failed"
 	for {
-		status, msg, done, err := getRunStatus(c.Bool("fail-fast"), runID, api)
-		log.Print(msg)
+		poll.progress = newRunProgress(r.client)
+		status, err := pollRunStatus(r.client, runID, policy, "", poll)
+		if err == errRunTimeout {
+			// Whatever results there are still get reported
+			timedOut = true
+			r.handleRunTimeout(c, runID, poll)
+			if status == nil {
+				status = &rainforest.RunStatus{ID: runID}
+			}
+		} else if err != nil {
+			return cli.NewExitError(err.Error(), errorCode)
+		}
+		if status.StateDetails.IsFinalState {
+			r.runDone(runID)
+		}
+		if status.FrontendURL != "" {
+			log.Printf("The detailed results are available at %v\n", status.FrontendURL)
+		}
 
-		if done {
-			if c.String("junit-file") != "" {
-				writeJunit(c, api, runID)
+		run := runAttempt{runID: runID, status: status}
+		if junitFile != "" || maxReruns > 0 || needReport {
+			// Merged reports are written once all the attempts are done
+			attemptFile := augmentJunitFileName(junitFile, attempt)
+			if mergeJunit {
+				attemptFile = ""
 			}
+			run.report, err = fetchRunResults(r.client, runID, attemptFile)
+			if err != nil {
+				log.Printf("Unable to get the JUnit report of run %v: %v", runID, err)
+			}
+		}
+		attempts = append(attempts, run)
 
-			if status.Result != "passed" {
-				rerunAttempt := c.Uint("rerun-attempt")
-				remainingReruns := c.Uint("max-reruns") - rerunAttempt
-				if remainingReruns > 0 {
-					cmd, _ := buildRerunArgs(c, runID)
-					path, err := os.Executable()
-					if err != nil {
-						return cli.NewExitError(err.Error(), 1)
-					}
-
-					log.Printf("Rerunning %v, attempt %v", runID, rerunAttempt+1)
-					exec_err := syscall.Exec(path, cmd, os.Environ())
-					if exec_err != nil {
-						return cli.NewExitError(exec_err.Error(), 1)
-					}
-				} else {
-					return cli.NewExitError("", 1)
-				}
+		if !timedOut {
+			outcome, err = policy.outcome(r.client, status)
+			if err != nil {
+				return cli.NewExitError(err.Error(), errorCode)
 			}
+		}
+		if timedOut || outcome == "passed" || attempt >= maxReruns {
+			break
+		}
 
-			if status.FrontendURL != "" {
-				log.Printf("The detailed results are available at %v\n", status.FrontendURL)
+		attempt++
+		log.Printf("Rerunning the failed tests of run %v, attempt %v of %v", runID, attempt, maxReruns)
+		rerunStatus, err := r.client.CreateRun(rainforest.RunParams{RunID: runID, Conflict: conflict})
+		if err != nil {
+			return cli.NewExitError(err.Error(), errorCode)
+		}
+		r.runStarted(rerunStatus.ID)
+		r.showRunCreated(rerunStatus)
+		runID = rerunStatus.ID
+	}
+
+	if len(attempts) > 1 {
+		printRerunSummary(attempts)
+	}
+	passed := !timedOut && outcome == "passed"
+	if mergeJunit || needReport {
+		merged, err := mergeAttemptReports(attempts)
+		if err != nil {
+			log.Print(err)
+		}
+		if mergeJunit && merged != nil {
+			err = writeJunitReport(merged, junitFile)
+			if err != nil {
+				return cli.NewExitError(err.Error(), errorCode)
 			}
+		}
+		report := &runReport{status: attempts[len(attempts)-1].status, junit: merged}
+		if len(notifyTargets) > 0 {
+			sendNotifications(notifyTargets, notifyTemplate, newRunNotification(report, timedOut))
+		}
+		err = writeReports(reportOutputs, report)
+		if err != nil {
+			return cli.NewExitError(err.Error(), errorCode)
+		}
+		if annotator != nil && !passed {
+			annotateFailedTests(annotator, r.client, report, rfmlSources(c))
+		}
+	}
+	if timedOut {
+		return cli.NewExitError(fmt.Sprintf("Run %v timed out after %v", runID, poll.timeout), errorCode)
+	}
+	switch outcome {
+	case "failed":
+		return cli.NewExitError("", policy.exitCodes["failed"])
+	case "no_result":
+		return cli.NewExitError(fmt.Sprintf("Run %v has tests with no result", runID), policy.exitCodes["no_result"])
+	}
+	return nil
+}
 
-			return nil
+// rfmlSources returns the files and folders with the RFML tests of the run
+func rfmlSources(c cliContext) []string {
+	if c.Bool("f") {
+		return c.Args()
+	}
+	return []string{c.String("test-folder")}
+}
+
+// errRunTimeout is returned when the run isn't done by the --timeout deadline
+var errRunTimeout = errors.New("Timed out waiting for the run to finish")
+
+// pollSettings control how often the status of a run is checked, and for how
+// long
+type pollSettings struct {
+	interval time.Duration
+	// maxInterval caps the backoff while the run makes no progress
+	maxInterval time.Duration
+	// timeout and deadline are zero if there's no timeout
+	timeout  time.Duration
+	deadline time.Time
+	// progress shows the status updates in place of log lines, if set
+	progress *runProgress
+}
+
+// getPollSettings reads the --poll-interval, --max-poll-interval and --timeout
+// options. The deadline starts now.
+func getPollSettings(c cliContext) (pollSettings, error) {
+	poll := pollSettings{interval: runStatusPollInterval}
+	var err error
+	if value := c.String("poll-interval"); value != "" {
+		poll.interval, err = time.ParseDuration(value)
+		if err != nil || poll.interval <= 0 {
+			return poll, fmt.Errorf("Invalid --poll-interval %v, use a duration such as 10s", value)
+		}
+	}
+	poll.maxInterval = poll.interval
+	if value := c.String("max-poll-interval"); value != "" {
+		maxInterval, err := time.ParseDuration(value)
+		if err != nil || maxInterval <= 0 {
+			return poll, fmt.Errorf("Invalid --max-poll-interval %v, use a duration such as 1m", value)
+		}
+		if maxInterval > poll.interval {
+			poll.maxInterval = maxInterval
+		}
+	}
+	if value := c.String("timeout"); value != "" {
+		poll.timeout, err = time.ParseDuration(value)
+		if err != nil || poll.timeout < 0 {
+			return poll, fmt.Errorf("Invalid --timeout %v, use a duration such as 90m", value)
+		}
+		if poll.timeout > 0 {
+			poll.deadline = time.Now().Add(poll.timeout)
+		}
+	}
+	switch c.String("timeout-action") {
+	case "", "exit", "cancel":
+	default:
+		return poll, fmt.Errorf("Invalid --timeout-action %v, use exit or cancel", c.String("timeout-action"))
+	}
+	return poll, nil
+}
+
+// runProgressed returns true if the run moved on between the two statuses
+func runProgressed(previous, current *rainforest.RunStatus) bool {
+	return previous.State != current.State ||
+		previous.CurrentProgress.Complete != current.CurrentProgress.Complete ||
+		previous.CurrentProgress.Percent != current.CurrentProgress.Percent
+}
+
+// pollRunStatus logs the status of the run, prefixed with logPrefix, or
+// shows it in poll.progress until it's done. It gives up after too many consecutive API errors. The polling
+// interval doubles up to poll.maxInterval while the run makes no progress,
+// e.g. while it's queued. If the deadline passes first, the last known
+// status is returned with errRunTimeout.
+func pollRunStatus(client runnerAPI, runID int, policy *runPolicy, logPrefix string, poll pollSettings) (*rainforest.RunStatus, error) {
+	failedAttempts := 1
+	interval := poll.interval
+	var lastStatus *rainforest.RunStatus
+
+	for {
+		status, msg, done, err := getRunStatus(policy, runID, client)
+		if poll.progress != nil && err == nil {
+			poll.progress.update(status)
+			if done {
+				poll.progress.finish()
+			}
+		} else {
+			if poll.progress != nil {
+				poll.progress.clear()
+			}
+			log.Print(logPrefix + msg)
+		}
+
+		if done {
+			return status, nil
 		}
 
 		// If we've had too many errors, give up
 		if failedAttempts >= 5 {
-			msg := fmt.Sprintf("Can not get run status after %d attempts, giving up", failedAttempts)
-			return cli.NewExitError(msg, 1)
+			return nil, fmt.Errorf("Can not get run status after %d attempts, giving up", failedAttempts)
 		}
 
 		// If we hit an error, record it
@@ -302,38 +667,54 @@ func monitorRunStatus(c cliContext, runID int) error {
 		} else {
 			// Reset attempts
 			failedAttempts = 1
+
+			// Back off while nothing happens
+			if lastStatus != nil && !runProgressed(lastStatus, status) {
+				interval *= 2
+				if interval > poll.maxInterval {
+					interval = poll.maxInterval
+				}
+			} else {
+				interval = poll.interval
+			}
+			lastStatus = status
 		}
 
-		time.Sleep(runStatusPollInterval)
+		sleep := interval
+		if !poll.deadline.IsZero() {
+			remaining := time.Until(poll.deadline)
+			if remaining <= 0 {
+				return lastStatus, errRunTimeout
+			}
+			if remaining < sleep {
+				sleep = remaining
+			}
+		}
+		timeSleep(sleep)
 	}
 }
 
-func buildRerunArgs(c cliContext, runID int) ([]string, error) {
-	maxReruns := c.Uint("max-reruns")
-	rerunAttempt := c.Uint("rerun-attempt")
-
-	cmd := []string{
-		"rainforest-cli",
-		"rerun", strconv.Itoa(runID),
-		"--max-reruns", fmt.Sprint(maxReruns),
-		"--rerun-attempt", fmt.Sprint(rerunAttempt + 1),
-		"--skip-update", // skip auto-updates for reruns
-	}
+// timeSleep is stubbed in tests to check the polling intervals
+var timeSleep = time.Sleep
 
-	if token := c.GlobalString("token"); len(token) > 0 {
-		cmd = append(cmd, "--token", token)
+// handleRunTimeout applies the --timeout-action to a run that timed out
+func (r *runner) handleRunTimeout(c cliContext, runID int, poll pollSettings) {
+	log.Printf("Run %v is not done after %v", runID, poll.timeout)
+	if c.String("timeout-action") != "cancel" {
+		return
 	}
-	if conflict := c.String("conflict"); len(conflict) > 0 {
-		cmd = append(cmd, "--conflict", conflict)
-	}
-	if junitFile := c.String("junit-file"); len(junitFile) > 0 {
-		cmd = append(cmd, "--junit-file", junitFile)
+	_, err := r.client.CancelRun(runID)
+	if err != nil {
+		log.Printf("Unable to cancel run %v: %v", runID, err)
+		return
 	}
-
-	return cmd, nil
+	r.runDone(runID)
+	log.Printf("Cancelled run %v", runID)
 }
 
-func getRunStatus(failFast bool, runID int, client runnerAPI) (*rainforest.RunStatus, string, bool, error) {
+// getRunStatus checks the status of the run. With --fail-fast, the run is
+// done once its failures are over the threshold of the policy.
+func getRunStatus(policy *runPolicy, runID int, client runnerAPI) (*rainforest.RunStatus, string, bool, error) {
 	newStatus, err := client.CheckRunStatus(runID)
 	if err != nil {
 		msg := fmt.Sprintf("API error: %v\n", err)
@@ -350,8 +731,14 @@ func getRunStatus(failFast bool, runID int, client runnerAPI) (*rainforest.RunSt
 		msg = fmt.Sprintf("Run %v is %v and is %v%% complete (%v tests in progress, %v failed, %v passed)\n", runID, newStatus.State, newStatus.CurrentProgress.Percent, (newStatus.CurrentProgress.Total - newStatus.CurrentProgress.Complete), newStatus.CurrentProgress.Failed, newStatus.CurrentProgress.Passed)
 	}
 
-	if newStatus.Result == "failed" && failFast {
-		return newStatus, msg, true, nil
+	if policy.failFast {
+		failing, err := policy.failing(client, newStatus)
+		if err != nil {
+			return newStatus, fmt.Sprintf("API error: %v\n", err), false, err
+		}
+		if failing {
+			return newStatus, msg, true, nil
+		}
 	}
 	return newStatus, msg, false, nil
 }
@@ -379,7 +766,7 @@ func (r *runner) makeRunParams(c cliContext, localTests []*rainforest.RFTest) (r
 	}
 
 	var crowd string
-	if crowd = c.String("crowd"); crowd != "" && crowd != "default" && crowd != "on_premise_crowd" && crowd != "automation" && crowd != "automation_and_crowd" {
+	if crowd = c.String("crowd"); !isValidCrowd(crowd) {
 		return rainforest.RunParams{}, errors.New("Invalid crowd option specified")
 	}
 
@@ -396,6 +783,15 @@ func (r *runner) makeRunParams(c cliContext, localTests []*rainforest.RFTest) (r
 
 	description := c.String("description")
 	release := c.String("release")
+	// The metadata is needed first to name the temporary environment
+	if c.Bool("auto-metadata") {
+		metadata := rainforest.RunParams{Description: description, Release: release}
+		err = applyAutoMetadata(c, &metadata)
+		if err != nil {
+			return rainforest.RunParams{}, err
+		}
+		description, release = metadata.Description, metadata.Release
+	}
 
 	var environmentID int
 	if s := c.String("custom-url"); s != "" {
@@ -410,12 +806,10 @@ func (r *runner) makeRunParams(c cliContext, localTests []*rainforest.RFTest) (r
 		}
 
 		var environment *rainforest.Environment
-		environment, err = r.client.CreateTemporaryEnvironment(customURL.String())
+		environment, err = r.temporaryEnvironment(c, customURL.String(), description)
 		if err != nil {
 			return rainforest.RunParams{}, err
 		}
-
-		log.Printf("Created temporary environment with name %v", environment.Name)
 		environmentID = environment.ID
 	} else if s := c.String("environment-id"); s != "" {
 		environmentID, err = strconv.Atoi(c.String("environment-id"))
@@ -516,6 +910,15 @@ func getTags(c cliContext) []string {
 	return expandStringSlice(tags)
 }
 
+// isValidCrowd returns true if crowd is empty or a known crowd option
+func isValidCrowd(crowd string) bool {
+	switch crowd {
+	case "", "default", "on_premise_crowd", "automation", "automation_and_crowd":
+		return true
+	}
+	return false
+}
+
 // getConflict gets conflict from a CLI context. It returns an error if value isn't allowed
 func getConflict(c cliContext) (string, error) {
 	var conflict string
@@ -2,12 +2,15 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/rainforestapp/rainforest-cli/rainforest"
 	"github.com/urfave/cli"
@@ -74,10 +77,20 @@ func TestExpandStringSlice(t *testing.T) {
 type fakeRunnerClient struct {
 	runStatuses []rainforest.RunStatus
 	environment rainforest.Environment
+	// environments are the existing environments
+	environments []rainforest.Environment
+	// environmentName captures the name of the created temporary environment
+	environmentName string
+	// deletedEnvironments captures the IDs of deleted environments
+	deletedEnvironments []int
 	// runParams captures whatever params were sent
 	runParams rainforest.RunParams
 	// createdTests captures which tests were created
 	createdTests []*rainforest.RFTest
+	// cancelled captures the IDs of cancelled runs
+	cancelled []int
+	// runTests are the test results served by run ID
+	runTests map[int][]rainforest.RunTest
 	// got some potential race conditions!
 	mu sync.Mutex
 	// "inherit" from RFML API
@@ -94,6 +107,17 @@ func (r *fakeRunnerClient) CheckRunStatus(runID int) (*rainforest.RunStatus, err
 	return nil, fmt.Errorf("Unable to find run status for run ID %v", runID)
 }
 
+func (r *fakeRunnerClient) CancelRun(runID int) (*rainforest.RunStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancelled = append(r.cancelled, runID)
+	return &rainforest.RunStatus{ID: runID, State: "aborted"}, nil
+}
+
+func (r *fakeRunnerClient) GetRunTests(runID int) ([]rainforest.RunTest, error) {
+	return r.runTests[runID], nil
+}
+
 func (r *fakeRunnerClient) GetTestIDs() ([]rainforest.TestIDPair, error) {
 	pairs := make([]rainforest.TestIDPair, len(r.createdTests))
 	for idx, test := range r.createdTests {
@@ -116,10 +140,25 @@ func (r *fakeRunnerClient) UpdateTest(t *rainforest.RFTest) error {
 	return nil
 }
 
-func (r *fakeRunnerClient) CreateTemporaryEnvironment(s string) (*rainforest.Environment, error) {
+func (r *fakeRunnerClient) GetRunJunit(runID int) (*string, error) {
+	xml := fmt.Sprintf("<testsuite id=\"%v\"/>", runID)
+	return &xml, nil
+}
+
+func (r *fakeRunnerClient) CreateTemporaryEnvironment(name, s string) (*rainforest.Environment, error) {
+	r.environmentName = name
 	return &r.environment, nil
 }
 
+func (r *fakeRunnerClient) GetEnvironments() ([]rainforest.Environment, error) {
+	return r.environments, nil
+}
+
+func (r *fakeRunnerClient) DeleteEnvironment(environmentID int) error {
+	r.deletedEnvironments = append(r.deletedEnvironments, environmentID)
+	return nil
+}
+
 func (r *fakeRunnerClient) CreateRun(p rainforest.RunParams) (*rainforest.RunStatus, error) {
 	r.runParams = p
 	return &rainforest.RunStatus{}, nil
@@ -140,7 +179,7 @@ func TestGetRunStatus(t *testing.T) {
 		},
 	}
 
-	_, _, done, err := getRunStatus(false, runID, client)
+	_, _, done, err := getRunStatus(&runPolicy{}, runID, client)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -160,7 +199,7 @@ func TestGetRunStatus(t *testing.T) {
 		},
 	}
 
-	_, _, done, err = getRunStatus(true, runID, client)
+	_, _, done, err = getRunStatus(&runPolicy{failFast: true}, runID, client)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -435,54 +474,233 @@ func TestStartLocalRun(t *testing.T) {
 	}
 }
 
-func TestBuildRerunArgs(t *testing.T) {
+func TestFilterChangedTests(t *testing.T) {
+	rfmlDir := setupTestRFMLDir()
+	defer os.RemoveAll(rfmlDir)
+
+	writeRFMLFile(t, filepath.Join(rfmlDir, "a/a2.rfml"), &rainforest.RFTest{
+		RFMLID:  "a2",
+		Title:   "a2",
+		Execute: true,
+		Steps: []interface{}{
+			rainforest.RFTestStep{Action: "Upload {{ file.download(data/users.csv) }}", Response: "Uploaded?"},
+		},
+	})
+	tests, err := readRFMLFiles([]string{rfmlDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	testCases := []struct {
-		Mappings map[string]interface{}
-		Args     cli.Args
-		RunID    int
-		WantArgs []string
+		changed []string
+		want    []string
 	}{
 		{
-			Mappings: map[string]interface{}{
-				"junit-file":  "result.xml",
-				"max-reruns":  uint(2),
-				"skip-update": true,
-			},
-			Args:  cli.Args{},
-			RunID: 123,
-			WantArgs: []string{
-				"rainforest-cli",
-				"rerun",
-				"123",
-				"--max-reruns", "2",
-				"--rerun-attempt", "1",
-				"--skip-update",
-				"--junit-file", "result.xml",
-			},
+			changed: []string{},
+			want:    nil,
 		},
 		{
-			Mappings: map[string]interface{}{
-				"max-reruns": uint(1),
-				"token":      "deadbeef",
-			},
-			Args:  cli.Args{},
-			RunID: 123,
-			WantArgs: []string{
-				"rainforest-cli",
-				"rerun",
-				"123",
-				"--max-reruns", "1",
-				"--rerun-attempt", "1",
-				"--skip-update",
-				"--token", "deadbeef",
-			},
+			// Changes propagate to the tests embedding b5, directly or not
+			changed: []string{filepath.Join(rfmlDir, "b/b/b5.rfml"), filepath.Join(rfmlDir, "README.md")},
+			want:    []string{"a1", "b4", "b5"},
+		},
+		{
+			changed: []string{filepath.Join(rfmlDir, "a/data/users.csv"), filepath.Join(rfmlDir, "standalone.rfml")},
+			want:    []string{"a2", "standalone"},
 		},
 	}
-	for _, testCase := range testCases {
-		c := newFakeContext(testCase.Mappings, testCase.Args)
-		gotArgs, _ := buildRerunArgs(c, testCase.RunID)
-		if !reflect.DeepEqual(gotArgs, testCase.WantArgs) {
-			t.Errorf("\nWanted %v\n   got %v", testCase.WantArgs, gotArgs)
+
+	for _, tc := range testCases {
+		affected, err := filterChangedTests(tests, tc.changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for test := range affected {
+			got = append(got, test.RFMLID)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("filterChangedTests(%v) returned %v, want %v", tc.changed, got, tc.want)
+		}
+	}
+}
+
+func TestStartLocalRunChangedSince(t *testing.T) {
+	rfmlDir := setupTestRFMLDir()
+	defer os.RemoveAll(rfmlDir)
+
+	var changedFiles []string
+	defer func(f func(string) ([]string, error)) { getChangedFiles = f }(getChangedFiles)
+	getChangedFiles = func(ref string) ([]string, error) {
+		if ref != "origin/master" {
+			t.Errorf("Unexpected ref %v", ref)
+		}
+		return changedFiles, nil
+	}
+
+	mappings := map[string]interface{}{
+		"f":             true,
+		"bg":            true,
+		"tag":           []string{"foo", "bar"},
+		"changed-since": "origin/master",
+	}
+	args := cli.Args{rfmlDir}
+
+	// b5 is embedded in a1 through b4
+	changedFiles = []string{filepath.Join(rfmlDir, "b/b/b5.rfml")}
+	client := &fakeRunnerClient{}
+	r := newRunner()
+	r.client = client
+	err := r.startRun(newFakeContext(mappings, args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.runParams.RFMLIDs; !reflect.DeepEqual(got, []string{"a1"}) {
+		t.Errorf("Expected only a1 to run, got %v", got)
+	}
+
+	// Nothing affected, no run
+	changedFiles = []string{filepath.Join(rfmlDir, "b/b1.rfml")}
+	client = &fakeRunnerClient{}
+	r.client = client
+	err = r.startRun(newFakeContext(mappings, args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.runParams.RFMLIDs != nil {
+		t.Errorf("Expected no run to be started, got %v", client.runParams.RFMLIDs)
+	}
+
+	// Only works with local tests
+	delete(mappings, "f")
+	err = r.startRun(newFakeContext(mappings, cli.Args{}))
+	if err == nil {
+		t.Error("Expected an error when using --changed-since without -f")
+	}
+}
+
+func TestGetPollSettings(t *testing.T) {
+	defer func(d time.Duration) { runStatusPollInterval = d }(runStatusPollInterval)
+	runStatusPollInterval = 5 * time.Second
+
+	c := newFakeContext(map[string]interface{}{}, cli.Args{})
+	poll, err := getPollSettings(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.interval != 5*time.Second || poll.maxInterval != 5*time.Second || !poll.deadline.IsZero() {
+		t.Errorf("Unexpected default settings %+v", poll)
+	}
+
+	c = newFakeContext(map[string]interface{}{
+		"poll-interval":     "10s",
+		"max-poll-interval": "2m",
+		"timeout":           "90m",
+	}, cli.Args{})
+	poll, err = getPollSettings(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.interval != 10*time.Second || poll.maxInterval != 2*time.Minute || poll.timeout != 90*time.Minute {
+		t.Errorf("Unexpected settings %+v", poll)
+	}
+	if until := time.Until(poll.deadline); until < 89*time.Minute || until > 90*time.Minute {
+		t.Errorf("Unexpected deadline in %v", until)
+	}
+
+	// The maximum interval is never below the interval
+	c = newFakeContext(map[string]interface{}{"poll-interval": "2m", "max-poll-interval": "1m"}, cli.Args{})
+	if poll, err = getPollSettings(c); err != nil || poll.maxInterval != 2*time.Minute {
+		t.Errorf("Unexpected settings %+v, %v", poll, err)
+	}
+
+	for _, flags := range []map[string]interface{}{
+		{"poll-interval": "often"},
+		{"poll-interval": "0s"},
+		{"max-poll-interval": "-1m"},
+		{"timeout": "1 hour"},
+		{"timeout-action": "retry"},
+	} {
+		if _, err = getPollSettings(newFakeContext(flags, cli.Args{})); err == nil {
+			t.Errorf("Expected an error for %v", flags)
+		}
+	}
+}
+
+// fakePollClient serves the statuses of a run in order, repeating the last one
+type fakePollClient struct {
+	fakeRunnerClient
+	statuses []rainforest.RunStatus
+	checks   int
+}
+
+func (f *fakePollClient) CheckRunStatus(runID int) (*rainforest.RunStatus, error) {
+	status := f.statuses[len(f.statuses)-1]
+	if f.checks < len(f.statuses) {
+		status = f.statuses[f.checks]
+	}
+	f.checks++
+	return &status, nil
+}
+
+func TestPollRunStatusBackoff(t *testing.T) {
+	defer func(f func(time.Duration)) { timeSleep = f }(timeSleep)
+	var sleeps []time.Duration
+	timeSleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	queued := rainforest.RunStatus{ID: 1, State: "queued"}
+	inProgress := rainforest.RunStatus{ID: 1, State: "in_progress"}
+	inProgress.CurrentProgress.Complete = 1
+	done := rainforest.RunStatus{ID: 1, State: "complete", Result: "passed"}
+	done.StateDetails.IsFinalState = true
+	client := &fakePollClient{statuses: []rainforest.RunStatus{queued, queued, queued, queued, queued, inProgress, done}}
+
+	poll := pollSettings{interval: time.Second, maxInterval: 5 * time.Second}
+	status, err := pollRunStatus(client, 1, &runPolicy{}, "", poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Result != "passed" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second, time.Second}
+	if !reflect.DeepEqual(sleeps, want) {
+		t.Errorf("Slept %v, want %v", sleeps, want)
+	}
+}
+
+func TestMonitorRunStatusTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainforest-timeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	junitFile := filepath.Join(dir, "results.xml")
+
+	for _, action := range []string{"exit", "cancel"} {
+		inProgress := rainforest.RunStatus{ID: 100, State: "in_progress"}
+		client := &fakePollClient{statuses: []rainforest.RunStatus{inProgress}}
+		r := newRunner()
+		r.client = client
+		c := newFakeContext(map[string]interface{}{
+			"junit-file":     junitFile,
+			"timeout":        "20ms",
+			"timeout-action": action,
+			"poll-interval":  "1ms",
+		}, cli.Args{})
+
+		err = r.monitorRunStatus(c, 100)
+		if err == nil || !strings.Contains(err.Error(), "Run 100 timed out after 20ms") {
+			t.Errorf("%v: expected a timeout error, got %v", action, err)
+		}
+		if wantCancelled := action == "cancel"; (len(client.cancelled) == 1) != wantCancelled {
+			t.Errorf("%v: cancelled runs %v", action, client.cancelled)
+		}
+		// The results so far are still written
+		if _, err = os.Stat(junitFile); err != nil {
+			t.Errorf("%v: expected the JUnit report to be written: %v", action, err)
 		}
+		os.Remove(junitFile)
 	}
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// runsAPI lists the runs of the client
+type runsAPI interface {
+	GetRuns(rainforest.RunFilters, int) ([]rainforest.Run, error)
+}
+
+// timeNow is stubbed in tests to parse relative dates
+var timeNow = time.Now
+
+// parseRunDate parses a date given as RFC 3339, YYYY-MM-DD or a duration
+// before now such as 12h or 7d.
+func parseRunDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return timeNow().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return timeNow().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid date %v, use YYYY-MM-DD, RFC 3339 or a duration such as 12h or 7d", value)
+}
+
+// getRunFilters reads the filters of the runs command
+func getRunFilters(c cliContext) (rainforest.RunFilters, error) {
+	filters := rainforest.RunFilters{
+		State:         c.String("state"),
+		Result:        c.String("result"),
+		EnvironmentID: c.Int("environment-id"),
+		RunGroupID:    c.Int("run-group"),
+		Release:       c.String("release"),
+		CreatedByCLI:  c.Bool("created-by-cli"),
+	}
+
+	var err error
+	filters.CreatedAfter, err = parseRunDate(c.String("since"))
+	if err != nil {
+		return filters, err
+	}
+	filters.CreatedBefore, err = parseRunDate(c.String("until"))
+	if err != nil {
+		return filters, err
+	}
+	if !filters.CreatedAfter.IsZero() && !filters.CreatedBefore.IsZero() && filters.CreatedBefore.Before(filters.CreatedAfter) {
+		return filters, fmt.Errorf("--until %v is before --since %v", c.String("until"), c.String("since"))
+	}
+	return filters, nil
+}
+
+// listRuns fetches and prints the recent runs matching the filters
+func listRuns(c cliContext, api runsAPI) error {
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return cli.NewExitError(fmt.Sprintf("Invalid format %v, use table or json", format), 1)
+	}
+	filters, err := getRunFilters(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	runs, err := api.GetRuns(filters, c.Int("limit"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(resultsOut)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(runs)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	rows := make([][]string, len(runs))
+	for i, run := range runs {
+		created := ""
+		if !run.CreatedAt.IsZero() {
+			created = run.CreatedAt.Local().Format("2006-01-02 15:04")
+		}
+		progress := fmt.Sprintf("%v/%v/%v", run.CurrentProgress.Passed, run.CurrentProgress.Failed, run.CurrentProgress.Total)
+		rows[i] = []string{strconv.Itoa(run.ID), created, run.State, run.Result, progress,
+			run.Environment.Name, run.Release, run.Description}
+	}
+	printResourceTable([]string{"Run ID", "Created", "State", "Result", "Passed/Failed/Total", "Environment", "Release", "Description"}, rows)
+	return nil
+}
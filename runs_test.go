@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeRunsAPI struct {
+	runs    []rainforest.Run
+	filters rainforest.RunFilters
+	limit   int
+}
+
+func (f *fakeRunsAPI) GetRuns(filters rainforest.RunFilters, limit int) ([]rainforest.Run, error) {
+	f.filters = filters
+	f.limit = limit
+	return f.runs, nil
+}
+
+func TestParseRunDate(t *testing.T) {
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	now := time.Date(2021, 6, 10, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	testCases := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"2021-06-01T08:30:00Z", time.Date(2021, 6, 1, 8, 30, 0, 0, time.UTC)},
+		{"2021-06-01", time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)},
+		{"7d", now.AddDate(0, 0, -7)},
+		{"90m", now.Add(-90 * time.Minute)},
+	}
+	for _, tc := range testCases {
+		got, err := parseRunDate(tc.value)
+		if err != nil {
+			t.Errorf("%q: %v", tc.value, err)
+		} else if !got.Equal(tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.value, got, tc.want)
+		}
+	}
+
+	for _, invalid := range []string{"yesterday", "-2d", "2021-13-01"} {
+		if _, err := parseRunDate(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestListRuns(t *testing.T) {
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	defer func(w io.Writer) { resultsOut = w }(resultsOut)
+
+	run := rainforest.Run{Release: "abc123", Description: "Nightly", CreatedAt: time.Date(2021, 6, 2, 10, 0, 0, 0, time.UTC)}
+	run.ID = 42
+	run.State = "complete"
+	run.Result = "failed"
+	run.CurrentProgress.Passed = 9
+	run.CurrentProgress.Failed = 1
+	run.CurrentProgress.Total = 10
+	run.Environment.Name = "Staging"
+	api := &fakeRunsAPI{runs: []rainforest.Run{run}}
+
+	out := &bytes.Buffer{}
+	tablesOut = out
+	c := newFakeContext(map[string]interface{}{
+		"format":         "table",
+		"result":         "failed",
+		"environment-id": 12,
+		"since":          "2021-06-01T00:00:00Z",
+		"created-by-cli": true,
+		"limit":          20,
+	}, cli.Args{})
+	err := listRuns(c, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFilters := rainforest.RunFilters{
+		Result:        "failed",
+		EnvironmentID: 12,
+		CreatedAfter:  time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		CreatedByCLI:  true,
+	}
+	if !reflect.DeepEqual(api.filters, wantFilters) || api.limit != 20 {
+		t.Errorf("Unexpected filters %+v and limit %v", api.filters, api.limit)
+	}
+	for _, want := range []string{"42", "complete", "failed", "9/1/10", "Staging", "abc123", "Nightly"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the table:\n%v", want, out.String())
+		}
+	}
+
+	out = &bytes.Buffer{}
+	resultsOut = out
+	c = newFakeContext(map[string]interface{}{"format": "json"}, cli.Args{})
+	err = listRuns(c, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runs []rainforest.Run
+	err = json.Unmarshal(out.Bytes(), &runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != 42 || runs[0].Environment.Name != "Staging" {
+		t.Errorf("Unexpected JSON output:\n%v", out.String())
+	}
+
+	c = newFakeContext(map[string]interface{}{"format": "table", "since": "2021-06-02", "until": "2021-06-01"}, cli.Args{})
+	if err = listRuns(c, api); err == nil {
+		t.Error("Expected an error for --until before --since")
+	}
+}
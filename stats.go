@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// mostEmbeddedLimit is the number of tests listed as the most embedded ones
+const mostEmbeddedLimit = 10
+
+// embedCount is the number of tests directly embedding a test
+type embedCount struct {
+	RFMLID string `json:"rfml_id"`
+	Count  int    `json:"count"`
+}
+
+// runSize estimates the size of a run of all the executable tests with a tag
+type runSize struct {
+	Tests int `json:"tests"`
+	Steps int `json:"steps"`
+}
+
+// suiteStats summarizes a test suite
+type suiteStats struct {
+	Source       string             `json:"source"`
+	Tests        int                `json:"tests"`
+	ByTag        map[string]int     `json:"by_tag"`
+	ByPriority   map[string]int     `json:"by_priority"`
+	ByState      map[string]int     `json:"by_state"`
+	ByFeature    map[string]int     `json:"by_feature"`
+	ByBrowser    map[string]int     `json:"by_browser"`
+	AverageSteps float64            `json:"average_steps"`
+	MaxSteps     int                `json:"max_steps"`
+	MaxStepsTest string             `json:"max_steps_test,omitempty"`
+	MostEmbedded []embedCount       `json:"most_embedded"`
+	Orphaned     []string           `json:"orphaned"`
+	RunSizeByTag map[string]runSize `json:"run_size_by_tag"`
+}
+
+// expandedStepCount returns the number of steps of a test with all of its
+// embedded tests expanded. counts memoizes the results, and embedded tests
+// that can't be found or are embedded circularly count as no steps.
+func expandedStepCount(test *rainforest.RFTest, testsByID map[string]*rainforest.RFTest, counts map[string]int) int {
+	if count, ok := counts[test.RFMLID]; ok {
+		return count
+	}
+	// Guard against circular embeds while we're counting
+	counts[test.RFMLID] = 0
+
+	count := 0
+	for _, step := range test.Steps {
+		switch s := step.(type) {
+		case rainforest.RFTestStep:
+			count++
+		case rainforest.RFEmbeddedTest:
+			if embedded, ok := testsByID[s.RFMLID]; ok {
+				count += expandedStepCount(embedded, testsByID, counts)
+			}
+		}
+	}
+
+	counts[test.RFMLID] = count
+	return count
+}
+
+// newSuiteStats computes the statistics of the given tests
+func newSuiteStats(source string, tests []*rainforest.RFTest) *suiteStats {
+	stats := &suiteStats{
+		Source:       source,
+		Tests:        len(tests),
+		ByTag:        map[string]int{},
+		ByPriority:   map[string]int{},
+		ByState:      map[string]int{},
+		ByFeature:    map[string]int{},
+		ByBrowser:    map[string]int{},
+		MostEmbedded: []embedCount{},
+		Orphaned:     []string{},
+		RunSizeByTag: map[string]runSize{},
+	}
+
+	testsByID := rfmlTestsByID(tests)
+	stepCounts := map[string]int{}
+	embeds := map[string]int{}
+	totalSteps := 0
+
+	for _, test := range tests {
+		if len(test.Tags) == 0 {
+			stats.ByTag["(untagged)"]++
+		}
+		for _, tag := range test.Tags {
+			stats.ByTag[tag]++
+		}
+
+		priority := test.Priority
+		if priority == "" {
+			priority = "none"
+		}
+		stats.ByPriority[priority]++
+
+		state := test.State
+		if state == "" {
+			state = "enabled"
+		}
+		stats.ByState[state]++
+
+		feature := "none"
+		if test.FeatureID > 0 {
+			feature = strconv.Itoa(int(test.FeatureID))
+		}
+		stats.ByFeature[feature]++
+
+		if len(test.Browsers) == 0 {
+			stats.ByBrowser["(default)"]++
+		}
+		for _, browser := range test.Browsers {
+			stats.ByBrowser[browser]++
+		}
+
+		steps := expandedStepCount(test, testsByID, stepCounts)
+		totalSteps += steps
+		if steps > stats.MaxSteps {
+			stats.MaxSteps = steps
+			stats.MaxStepsTest = test.RFMLID
+		}
+
+		// Count each embedding test once, even if it embeds a test several times
+		embedded := map[string]bool{}
+		for _, id := range embeddedRFMLIDs(test) {
+			if !embedded[id] {
+				embedded[id] = true
+				embeds[id]++
+			}
+		}
+
+		if test.Execute && state == "enabled" {
+			for _, tag := range test.Tags {
+				size := stats.RunSizeByTag[tag]
+				size.Tests++
+				size.Steps += steps
+				stats.RunSizeByTag[tag] = size
+			}
+		}
+	}
+
+	if len(tests) > 0 {
+		stats.AverageSteps = float64(totalSteps) / float64(len(tests))
+	}
+
+	for id, count := range embeds {
+		stats.MostEmbedded = append(stats.MostEmbedded, embedCount{RFMLID: id, Count: count})
+	}
+	sort.Slice(stats.MostEmbedded, func(i, j int) bool {
+		a, b := stats.MostEmbedded[i], stats.MostEmbedded[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.RFMLID < b.RFMLID
+	})
+	if len(stats.MostEmbedded) > mostEmbeddedLimit {
+		stats.MostEmbedded = stats.MostEmbedded[:mostEmbeddedLimit]
+	}
+
+	// Tests that are never executed on their own and not embedded anywhere
+	// are never run at all.
+	for _, test := range tests {
+		if !test.Execute && embeds[test.RFMLID] == 0 {
+			stats.Orphaned = append(stats.Orphaned, test.RFMLID)
+		}
+	}
+	sort.Strings(stats.Orphaned)
+
+	return stats
+}
+
+// countRows returns sorted table rows for a map of counts, highest count first
+func countRows(counts map[string]int) [][]string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	rows := make([][]string, len(keys))
+	for i, key := range keys {
+		rows[i] = []string{key, strconv.Itoa(counts[key])}
+	}
+	return rows
+}
+
+// statsSection is a titled table of the stats output
+type statsSection struct {
+	title   string
+	headers []string
+	rows    [][]string
+}
+
+// sections returns the stats as a list of tables shared by the table and
+// markdown outputs.
+func (s *suiteStats) sections() []statsSection {
+	maxStepsTest := s.MaxStepsTest
+	if maxStepsTest == "" {
+		maxStepsTest = "-"
+	}
+
+	embedRows := make([][]string, len(s.MostEmbedded))
+	for i, e := range s.MostEmbedded {
+		embedRows[i] = []string{e.RFMLID, strconv.Itoa(e.Count)}
+	}
+
+	orphanRows := make([][]string, len(s.Orphaned))
+	for i, id := range s.Orphaned {
+		orphanRows[i] = []string{id}
+	}
+
+	tags := make([]string, 0, len(s.RunSizeByTag))
+	for tag := range s.RunSizeByTag {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	runSizeRows := make([][]string, len(tags))
+	for i, tag := range tags {
+		size := s.RunSizeByTag[tag]
+		runSizeRows[i] = []string{tag, strconv.Itoa(size.Tests), strconv.Itoa(size.Steps)}
+	}
+
+	return []statsSection{
+		{
+			title:   "Summary",
+			headers: []string{"Statistic", "Value"},
+			rows: [][]string{
+				{"Tests", strconv.Itoa(s.Tests)},
+				{"Average steps", strconv.FormatFloat(s.AverageSteps, 'f', 1, 64)},
+				{"Max steps", strconv.Itoa(s.MaxSteps)},
+				{"Longest test", maxStepsTest},
+			},
+		},
+		{title: "Tests by tag", headers: []string{"Tag", "Tests"}, rows: countRows(s.ByTag)},
+		{title: "Tests by priority", headers: []string{"Priority", "Tests"}, rows: countRows(s.ByPriority)},
+		{title: "Tests by state", headers: []string{"State", "Tests"}, rows: countRows(s.ByState)},
+		{title: "Tests by feature", headers: []string{"Feature ID", "Tests"}, rows: countRows(s.ByFeature)},
+		{title: "Tests by browser", headers: []string{"Browser", "Tests"}, rows: countRows(s.ByBrowser)},
+		{title: "Most embedded tests", headers: []string{"RFML ID", "Embedded In"}, rows: embedRows},
+		{title: "Orphaned tests (execute: false and never embedded)", headers: []string{"RFML ID"}, rows: orphanRows},
+		{title: "Estimated run size by tag", headers: []string{"Tag", "Tests", "Steps"}, rows: runSizeRows},
+	}
+}
+
+// printStatsTable prints the stats as tables
+func printStatsTable(s *suiteStats) {
+	for _, section := range s.sections() {
+		fmt.Fprintf(tablesOut, "\n%v\n", section.title)
+		printResourceTable(section.headers, section.rows)
+	}
+}
+
+// printStatsMarkdown prints the stats as Markdown tables
+func printStatsMarkdown(s *suiteStats) {
+	fmt.Fprintf(resultsOut, "## Test suite statistics (%v)\n", s.Source)
+	for _, section := range s.sections() {
+		fmt.Fprintf(resultsOut, "\n### %v\n\n", section.title)
+		if len(section.rows) == 0 {
+			fmt.Fprintln(resultsOut, "None")
+			continue
+		}
+
+		fmt.Fprintf(resultsOut, "| %v |\n", strings.Join(section.headers, " | "))
+		separators := make([]string, len(section.headers))
+		for i := range separators {
+			separators[i] = "---"
+		}
+		fmt.Fprintf(resultsOut, "| %v |\n", strings.Join(separators, " | "))
+		for _, row := range section.rows {
+			cells := make([]string, len(row))
+			for i, cell := range row {
+				cells[i] = strings.Replace(cell, "|", `\|`, -1)
+			}
+			fmt.Fprintf(resultsOut, "| %v |\n", strings.Join(cells, " | "))
+		}
+	}
+}
+
+// getRemoteRFMLTests fetches the tests from Rainforest in their RFML form.
+// The tests list has no steps, so each test is fetched on its own like
+// download does.
+func getRemoteRFMLTests(api rfmlAPI) ([]*rainforest.RFTest, error) {
+	remoteTests, err := api.GetTests(&rainforest.RFTestFilters{})
+	if err != nil {
+		return nil, err
+	}
+	testIDPairs, err := api.GetTestIDs()
+	if err != nil {
+		return nil, err
+	}
+	coll := rainforest.NewTestIDCollection(testIDPairs)
+
+	errorsChan := make(chan error)
+	testIDChan := make(chan int, len(remoteTests))
+	testChan := make(chan *rainforest.RFTest, len(remoteTests))
+	for _, test := range remoteTests {
+		testIDChan <- test.TestID
+	}
+	close(testIDChan)
+	for i := 0; i < rfmlDownloadConcurrency; i++ {
+		go downloadRFTestWorker(testIDChan, errorsChan, testChan, api)
+	}
+
+	tests := make([]*rainforest.RFTest, len(remoteTests))
+	for i := range remoteTests {
+		select {
+		case err = <-errorsChan:
+			return nil, err
+		case test := <-testChan:
+			err = test.PrepareToWriteAsRFML(*coll, false)
+			if err != nil {
+				return nil, err
+			}
+			tests[i] = test
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].TestID < tests[j].TestID })
+	return tests, nil
+}
+
+// printSuiteStats summarizes the local or remote test suite
+func printSuiteStats(c cliContext, api rfmlAPI) error {
+	format := c.String("format")
+	switch format {
+	case "":
+		format = "table"
+	case "table", "json", "markdown":
+	default:
+		return cli.NewExitError("Invalid format specified, use one of table, json or markdown", 1)
+	}
+
+	var tests []*rainforest.RFTest
+	var err error
+	source := "local"
+	if c.Bool("remote") {
+		source = "remote"
+		tests, err = getRemoteRFMLTests(api)
+	} else {
+		files := []string(c.Args())
+		if len(files) == 0 {
+			files = []string{c.String("test-folder")}
+		}
+		tests, err = readRFMLFiles(files)
+	}
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	stats := newSuiteStats(source, tests)
+
+	switch format {
+	case "table":
+		printStatsTable(stats)
+	case "markdown":
+		printStatsMarkdown(stats)
+	case "json":
+		encoder := json.NewEncoder(resultsOut)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(stats)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	return nil
+}
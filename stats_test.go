@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestNewSuiteStats(t *testing.T) {
+	login := &rainforest.RFTest{
+		RFMLID:   "login",
+		Priority: "P1",
+		Execute:  false,
+		Steps: []interface{}{
+			rainforest.RFTestStep{Action: "Log in", Response: "Are you logged in?"},
+			rainforest.RFTestStep{Action: "Open the menu", Response: "Do you see your name?"},
+		},
+	}
+	checkout := &rainforest.RFTest{
+		RFMLID:    "checkout",
+		Tags:      []string{"shop", "smoke"},
+		Browsers:  []string{"chrome", "firefox"},
+		FeatureID: 7,
+		Execute:   true,
+		Steps: []interface{}{
+			rainforest.RFEmbeddedTest{RFMLID: "login"},
+			rainforest.RFEmbeddedTest{RFMLID: "cart"},
+			rainforest.RFTestStep{Action: "Pay", Response: "Did it work?"},
+		},
+	}
+	cart := &rainforest.RFTest{
+		RFMLID:  "cart",
+		Tags:    []string{"shop"},
+		State:   "disabled",
+		Execute: true,
+		Steps: []interface{}{
+			rainforest.RFEmbeddedTest{RFMLID: "login"},
+			rainforest.RFEmbeddedTest{RFMLID: "login"},
+		},
+	}
+	unused := &rainforest.RFTest{RFMLID: "unused", Execute: false}
+
+	stats := newSuiteStats("local", []*rainforest.RFTest{login, checkout, cart, unused})
+
+	if stats.Tests != 4 {
+		t.Errorf("Expected 4 tests, got %v", stats.Tests)
+	}
+	if want := map[string]int{"shop": 2, "smoke": 1, "(untagged)": 2}; !reflect.DeepEqual(stats.ByTag, want) {
+		t.Errorf("Unexpected tags %v, want %v", stats.ByTag, want)
+	}
+	if want := map[string]int{"P1": 1, "none": 3}; !reflect.DeepEqual(stats.ByPriority, want) {
+		t.Errorf("Unexpected priorities %v, want %v", stats.ByPriority, want)
+	}
+	if want := map[string]int{"enabled": 3, "disabled": 1}; !reflect.DeepEqual(stats.ByState, want) {
+		t.Errorf("Unexpected states %v, want %v", stats.ByState, want)
+	}
+	if want := map[string]int{"7": 1, "none": 3}; !reflect.DeepEqual(stats.ByFeature, want) {
+		t.Errorf("Unexpected features %v, want %v", stats.ByFeature, want)
+	}
+	if want := map[string]int{"chrome": 1, "firefox": 1, "(default)": 3}; !reflect.DeepEqual(stats.ByBrowser, want) {
+		t.Errorf("Unexpected browsers %v, want %v", stats.ByBrowser, want)
+	}
+
+	// login: 2, checkout: 2 + 4 + 1, cart: 4, unused: 0
+	if stats.MaxSteps != 7 || stats.MaxStepsTest != "checkout" {
+		t.Errorf("Expected checkout to have 7 steps, got %v with %v", stats.MaxStepsTest, stats.MaxSteps)
+	}
+	if stats.AverageSteps != 3.25 {
+		t.Errorf("Expected 3.25 average steps, got %v", stats.AverageSteps)
+	}
+
+	wantEmbedded := []embedCount{{RFMLID: "login", Count: 2}, {RFMLID: "cart", Count: 1}}
+	if !reflect.DeepEqual(stats.MostEmbedded, wantEmbedded) {
+		t.Errorf("Unexpected most embedded tests %v, want %v", stats.MostEmbedded, wantEmbedded)
+	}
+	if want := []string{"unused"}; !reflect.DeepEqual(stats.Orphaned, want) {
+		t.Errorf("Unexpected orphaned tests %v, want %v", stats.Orphaned, want)
+	}
+
+	// The disabled cart test isn't part of any run
+	wantRunSize := map[string]runSize{"shop": {Tests: 1, Steps: 7}, "smoke": {Tests: 1, Steps: 7}}
+	if !reflect.DeepEqual(stats.RunSizeByTag, wantRunSize) {
+		t.Errorf("Unexpected run sizes %v, want %v", stats.RunSizeByTag, wantRunSize)
+	}
+}
+
+func TestExpandedStepCountCircular(t *testing.T) {
+	a := &rainforest.RFTest{RFMLID: "a", Steps: []interface{}{
+		rainforest.RFTestStep{Action: "a", Response: "a?"},
+		rainforest.RFEmbeddedTest{RFMLID: "b"},
+	}}
+	b := &rainforest.RFTest{RFMLID: "b", Steps: []interface{}{
+		rainforest.RFTestStep{Action: "b", Response: "b?"},
+		rainforest.RFEmbeddedTest{RFMLID: "a"},
+	}}
+
+	got := expandedStepCount(a, rfmlTestsByID([]*rainforest.RFTest{a, b}), map[string]int{})
+	if got != 2 {
+		t.Errorf("Expected 2 steps, got %v", got)
+	}
+}
+
+func TestPrintSuiteStats(t *testing.T) {
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+
+	resultsOut = &bytes.Buffer{}
+	tablesOut = &bytes.Buffer{}
+	defer func() {
+		resultsOut = os.Stdout
+		tablesOut = os.Stdout
+	}()
+
+	err := printSuiteStats(newFakeContext(map[string]interface{}{"format": "json"}, cli.Args{dir}), &testRfmlAPI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats suiteStats
+	err = json.Unmarshal(resultsOut.(*bytes.Buffer).Bytes(), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Source != "local" || stats.Tests != 9 {
+		t.Errorf("Expected 9 local tests, got %v %v", stats.Tests, stats.Source)
+	}
+	if !reflect.DeepEqual(stats.Orphaned, []string{"b3"}) {
+		t.Errorf("Expected b3 to be orphaned, got %v", stats.Orphaned)
+	}
+
+	resultsOut.(*bytes.Buffer).Reset()
+	err = printSuiteStats(newFakeContext(map[string]interface{}{"format": "markdown", "test-folder": dir}, cli.Args{}), &testRfmlAPI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown := resultsOut.(*bytes.Buffer).String()
+	if !strings.Contains(markdown, "### Tests by tag\n\n| Tag | Tests |\n| --- | --- |\n| (untagged) | 6 |\n| foo | 2 |\n") {
+		t.Errorf("Unexpected markdown output:\n%v", markdown)
+	}
+
+	err = printSuiteStats(newFakeContext(map[string]interface{}{"test-folder": dir}, cli.Args{}), &testRfmlAPI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table := tablesOut.(*bytes.Buffer).String(); !strings.Contains(table, "Most embedded tests") {
+		t.Errorf("Unexpected table output:\n%v", table)
+	}
+
+	err = printSuiteStats(newFakeContext(map[string]interface{}{"format": "csv"}, cli.Args{dir}), &testRfmlAPI{})
+	if err == nil {
+		t.Error("Expected an error for an invalid format")
+	}
+}
+
+// testListRfmlAPI returns the tests list without steps, like the API does
+type testListRfmlAPI struct {
+	*testRfmlAPI
+}
+
+func (t testListRfmlAPI) GetTests(*rainforest.RFTestFilters) ([]rainforest.RFTest, error) {
+	tests := make([]rainforest.RFTest, len(t.tests))
+	for i, test := range t.tests {
+		tests[i] = rainforest.RFTest{TestID: test.TestID, Title: test.Title}
+	}
+	return tests, nil
+}
+
+func TestPrintSuiteStatsRemote(t *testing.T) {
+	resultsOut = &bytes.Buffer{}
+	defer func() {
+		resultsOut = os.Stdout
+	}()
+
+	api := &testRfmlAPI{
+		testIDs: []rainforest.TestIDPair{{ID: 1, RFMLID: "login"}, {ID: 2, RFMLID: "checkout"}},
+	}
+	err := json.Unmarshal([]byte(`[
+		{"id": 1, "rfml_id": "login", "tags": ["auth"], "browsers": [{"name": "chrome", "state": "enabled"}],
+		 "elements": [{"type": "step", "element": {"action": "Log in", "response": "OK?"}}]},
+		{"id": 2, "rfml_id": "checkout", "tags": ["shop"], "browsers": [],
+		 "elements": [{"type": "test", "element": {"id": 1}}, {"type": "step", "element": {"action": "Pay", "response": "OK?"}}]}
+	]`), &api.tests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.tests[1].Execute = true
+
+	err = printSuiteStats(newFakeContext(map[string]interface{}{"remote": true, "format": "json"}, cli.Args{}), testListRfmlAPI{api})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats suiteStats
+	err = json.Unmarshal(resultsOut.(*bytes.Buffer).Bytes(), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Source != "remote" || stats.MaxSteps != 2 || stats.MaxStepsTest != "checkout" {
+		t.Errorf("Unexpected remote stats %+v", stats)
+	}
+	if want := map[string]int{"chrome": 1, "(default)": 1}; !reflect.DeepEqual(stats.ByBrowser, want) {
+		t.Errorf("Unexpected browsers %v, want %v", stats.ByBrowser, want)
+	}
+	if want := []embedCount{{RFMLID: "login", Count: 1}}; !reflect.DeepEqual(stats.MostEmbedded, want) || len(stats.Orphaned) != 0 {
+		t.Errorf("Unexpected embeds %v and orphans %v", stats.MostEmbedded, stats.Orphaned)
+	}
+}
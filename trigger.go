@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/rainforestapp/rainforest-cli/gittrigger"
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+// gitTriggerInfo is the part of the git trigger used to decide on and
+// configure runs
+type gitTriggerInfo interface {
+	TriggeringCommit() *gitTrigger.Commit
+	Skip() bool
+	GetBranch() string
+	GetTags() []string
+	GetBrowsers() []string
+	GetEnvironment() string
+}
+
+// newGitTrigger scans the commits in commitRange, or just the latest commit
+// if it's empty.
+var newGitTrigger = func(commitRange string) (gitTriggerInfo, error) {
+	return gitTrigger.NewGitTriggerForRange(commitRange)
+}
+
+// applyGitTrigger decides whether the commits and branch rules trigger a run
+// and applies the run options they specify to params. Branch rules override
+// the command line options, and commit messages override branch rules.
+func applyGitTrigger(c cliContext, params *rainforest.RunParams) (bool, error) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return false, err
+	}
+	git, err := newGitTrigger(c.String("git-trigger-range"))
+	if err != nil {
+		return false, err
+	}
+
+	branch := git.GetBranch()
+	rule := cfg.GitTrigger.ruleFor(branch)
+	if rule != nil && rule.Skip {
+		log.Printf("Git trigger is disabled for branch %v. Exiting...", branch)
+		return false, nil
+	}
+	if git.Skip() {
+		log.Print("Found Rainforest-Skip in the commit messages. Exiting...")
+		return false, nil
+	}
+
+	commit := git.TriggeringCommit()
+	if commit == nil && (rule == nil || !rule.AlwaysRun) {
+		log.Print("Git trigger enabled, but no commit asked for a run. Exiting...")
+		return false, nil
+	}
+
+	if rule != nil {
+		log.Printf("Using git trigger rules for branch %v", branch)
+		if len(rule.Tags) > 0 {
+			params.Tags = rule.Tags
+		}
+		if len(rule.Browsers) > 0 {
+			params.Browsers = rule.Browsers
+		}
+		if rule.EnvironmentID != 0 {
+			params.EnvironmentID = rule.EnvironmentID
+		}
+	}
+
+	if commit == nil {
+		log.Printf("Run triggered by branch %v", branch)
+		return true, nil
+	}
+
+	log.Printf("Run triggered by commit %v: %v", commit.ShortSHA(), commit.Subject())
+	if params.Description == "" {
+		params.Description = fmt.Sprintf("Triggered by commit %v: %v", commit.ShortSHA(), commit.Subject())
+	}
+
+	if tags := git.GetTags(); len(tags) > 0 {
+		if len(params.Tags) == 0 {
+			log.Print("Found tag list in the commit message.")
+		} else {
+			log.Print("Found tag list in the commit message, overwriting argument.")
+		}
+		params.Tags = tags
+	}
+	if browsers := git.GetBrowsers(); len(browsers) > 0 {
+		log.Print("Found browser list in the commit message.")
+		params.Browsers = browsers
+	}
+	if env := git.GetEnvironment(); env != "" {
+		environmentID, err := strconv.Atoi(env)
+		if err != nil {
+			return false, fmt.Errorf("Invalid Rainforest-Environment %v in commit %v", env, commit.ShortSHA())
+		}
+		params.EnvironmentID = environmentID
+	}
+
+	return true, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/gittrigger"
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeGitTrigger struct {
+	commit      *gitTrigger.Commit
+	skip        bool
+	branch      string
+	tags        []string
+	browsers    []string
+	environment string
+}
+
+func (f fakeGitTrigger) TriggeringCommit() *gitTrigger.Commit { return f.commit }
+func (f fakeGitTrigger) Skip() bool                           { return f.skip }
+func (f fakeGitTrigger) GetBranch() string                    { return f.branch }
+func (f fakeGitTrigger) GetTags() []string                    { return f.tags }
+func (f fakeGitTrigger) GetBrowsers() []string                { return f.browsers }
+func (f fakeGitTrigger) GetEnvironment() string               { return f.environment }
+
+func TestApplyGitTrigger(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"git_trigger": {
+			"branches": [
+				{"branch": "docs/*", "skip": true},
+				{"branch": "master", "always_run": true, "tags": ["smoke"], "environment_id": 12}
+			]
+		}
+	}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	commit := &gitTrigger.Commit{SHA: "abcdef123456", Message: "Fix checkout\n\nRainforest-Tags: checkout"}
+
+	testCases := []struct {
+		name        string
+		git         fakeGitTrigger
+		commitRange string
+		wantTrigger bool
+		wantParams  rainforest.RunParams
+	}{
+		{
+			name:       "no triggering commit",
+			git:        fakeGitTrigger{branch: "feature"},
+			wantParams: rainforest.RunParams{Tags: []string{"arg"}},
+		},
+		{
+			name:        "triggering commit",
+			git:         fakeGitTrigger{branch: "feature", commit: commit, tags: []string{"checkout"}, browsers: []string{"firefox"}, environment: "7"},
+			commitRange: "origin/master..HEAD",
+			wantTrigger: true,
+			wantParams: rainforest.RunParams{
+				Tags:          []string{"checkout"},
+				Browsers:      []string{"firefox"},
+				EnvironmentID: 7,
+				Description:   "Triggered by commit abcdef1: Fix checkout",
+			},
+		},
+		{
+			name:       "skipped branch",
+			git:        fakeGitTrigger{branch: "docs/readme", commit: commit, tags: []string{"checkout"}},
+			wantParams: rainforest.RunParams{Tags: []string{"arg"}},
+		},
+		{
+			name:       "skip trailer",
+			git:        fakeGitTrigger{branch: "master", commit: commit, skip: true},
+			wantParams: rainforest.RunParams{Tags: []string{"arg"}},
+		},
+		{
+			name:        "branch always runs",
+			git:         fakeGitTrigger{branch: "master"},
+			wantTrigger: true,
+			wantParams:  rainforest.RunParams{Tags: []string{"smoke"}, EnvironmentID: 12},
+		},
+		{
+			name:        "commit overrides branch rules",
+			git:         fakeGitTrigger{branch: "master", commit: commit, tags: []string{"checkout"}},
+			wantTrigger: true,
+			wantParams: rainforest.RunParams{
+				Tags:          []string{"checkout"},
+				EnvironmentID: 12,
+				Description:   "Triggered by commit abcdef1: Fix checkout",
+			},
+		},
+	}
+
+	defer func(f func(string) (gitTriggerInfo, error)) { newGitTrigger = f }(newGitTrigger)
+
+	for _, tc := range testCases {
+		var gotRange string
+		git := tc.git
+		newGitTrigger = func(commitRange string) (gitTriggerInfo, error) {
+			gotRange = commitRange
+			return git, nil
+		}
+
+		mappings := map[string]interface{}{"config": path, "git-trigger-range": tc.commitRange}
+		params := rainforest.RunParams{Tags: []string{"arg"}}
+		trigger, err := applyGitTrigger(newFakeContext(mappings, cli.Args{}), &params)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tc.name, err)
+			continue
+		}
+		if trigger != tc.wantTrigger {
+			t.Errorf("%v: got trigger %v, want %v", tc.name, trigger, tc.wantTrigger)
+		}
+		if !reflect.DeepEqual(params, tc.wantParams) {
+			t.Errorf("%v: got params %+v, want %+v", tc.name, params, tc.wantParams)
+		}
+		if gotRange != tc.commitRange {
+			t.Errorf("%v: got range %v, want %v", tc.name, gotRange, tc.commitRange)
+		}
+	}
+
+	// Invalid environments are reported
+	newGitTrigger = func(string) (gitTriggerInfo, error) {
+		return fakeGitTrigger{commit: commit, environment: "staging"}, nil
+	}
+	_, err := applyGitTrigger(newFakeContext(map[string]interface{}{"config": path}, cli.Args{}), &rainforest.RunParams{})
+	if err == nil {
+		t.Error("Expected an error for an invalid environment")
+	}
+}
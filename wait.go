@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// startedRun is a run recorded in the --state-file, for the wait command to
+// pick up later
+type startedRun struct {
+	ID  int    `json:"id"`
+	URL string `json:"url,omitempty"`
+	// Name is the matrix leg of the run, if any
+	Name   string               `json:"name,omitempty"`
+	Params rainforest.RunParams `json:"params"`
+}
+
+// runState is the content of the --state-file
+type runState struct {
+	Runs []startedRun `json:"runs"`
+}
+
+func newStartedRun(status *rainforest.RunStatus, params rainforest.RunParams, name string) startedRun {
+	return startedRun{ID: status.ID, URL: status.FrontendURL, Name: name, Params: params}
+}
+
+// readStartedRuns reads the runs recorded in the state file
+func readStartedRuns(path string) ([]startedRun, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state runState
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid state file %v: %v", path, err)
+	}
+	return state.Runs, nil
+}
+
+// recordStartedRuns adds the runs to the state file, creating it if needed,
+// so several runs can be started before waiting for all of them.
+func recordStartedRuns(path string, runs []startedRun) error {
+	existing, err := readStartedRuns(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	out, err := json.MarshalIndent(runState{Runs: append(existing, runs...)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, append(out, '\n'), 0666)
+	if err != nil {
+		return err
+	}
+	log.Printf("Recorded %v run(s) in %v", len(runs), path)
+	return nil
+}
+
+func waitForRuns(c cliContext) error {
+	r := newRunner()
+	return r.waitForRuns(c)
+}
+
+// waitForRuns monitors the runs given as arguments or in the state file
+// concurrently and fails if any of them fails.
+func (r *runner) waitForRuns(c cliContext) error {
+	policy, err := getRunPolicy(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	var runs []startedRun
+	if path := c.String("state-file"); path != "" {
+		runs, err = readStartedRuns(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	for _, arg := range c.Args() {
+		runID, err := strconv.Atoi(arg)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid run ID %v", arg), 1)
+		}
+		runs = append(runs, startedRun{ID: runID})
+	}
+	if len(runs) == 0 {
+		return cli.NewExitError("Specify the IDs of the runs to wait for or a --state-file", 1)
+	}
+
+	var results []matrixResult
+	seen := map[int]bool{}
+	for _, run := range runs {
+		if seen[run.ID] {
+			continue
+		}
+		seen[run.ID] = true
+
+		name := run.Name
+		if name == "" {
+			name = fmt.Sprintf("run %v", run.ID)
+		}
+		results = append(results, matrixResult{
+			leg:    matrixLeg{Name: name},
+			params: run.Params,
+			status: &rainforest.RunStatus{ID: run.ID, FrontendURL: run.URL},
+		})
+	}
+
+	failed, outcome, err := r.monitorRuns(c, policy, results)
+	if err != nil {
+		return cli.NewExitError(err.Error(), policy.exitCodes["error"])
+	}
+	if outcome != "passed" {
+		return cli.NewExitError(fmt.Sprintf("%v of %v runs failed", failed, len(results)), policy.exitCodes[outcome])
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestRecordStartedRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainforest-wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "runs.json")
+
+	first := startedRun{ID: 1, URL: "https://app.rainforestqa.com/runs/1", Params: rainforest.RunParams{Tags: []string{"smoke"}}}
+	second := startedRun{ID: 2, Name: "staging", Params: rainforest.RunParams{EnvironmentID: 12}}
+	for _, run := range []startedRun{first, second} {
+		err = recordStartedRuns(path, []startedRun{run})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := readStartedRuns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []startedRun{first, second}; !reflect.DeepEqual(runs, want) {
+		t.Errorf("readStartedRuns returned %+v, want %+v", runs, want)
+	}
+
+	ioutil.WriteFile(path, []byte("not json"), 0666)
+	if _, err = readStartedRuns(path); err == nil {
+		t.Error("Expected an error for an invalid state file")
+	}
+	if err = recordStartedRuns(path, []startedRun{first}); err == nil {
+		t.Error("Expected an error when adding to an invalid state file")
+	}
+}
+
+func TestStartRunStateFile(t *testing.T) {
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+	tablesOut = &bytes.Buffer{}
+
+	dir, err := ioutil.TempDir("", "rainforest-wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "runs.json")
+
+	r := newRunner()
+	r.client = &fakeRerunClient{}
+	c := newFakeContext(map[string]interface{}{
+		"tag":        []string{"smoke"},
+		"bg":         true,
+		"state-file": path,
+	}, cli.Args{})
+	err = r.startRun(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = newFakeContext(map[string]interface{}{
+		"tag":        []string{"smoke"},
+		"bg":         true,
+		"state-file": path,
+		"matrix-leg": []string{"name=staging environment-id=12"},
+	}, cli.Args{})
+	err = r.startRun(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := readStartedRuns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []startedRun{
+		{ID: 1, Params: rainforest.RunParams{Tags: []string{"smoke"}}},
+		{ID: 1, Name: "staging", Params: rainforest.RunParams{Tags: []string{"smoke"}, EnvironmentID: 12, Description: "staging"}},
+	}
+	if !reflect.DeepEqual(runs, want) {
+		t.Errorf("Recorded runs %+v, want %+v", runs, want)
+	}
+}
+
+func TestWaitForRuns(t *testing.T) {
+	defer func(d time.Duration) { runStatusPollInterval = d }(runStatusPollInterval)
+	runStatusPollInterval = time.Millisecond
+	defer func(w io.Writer) { tablesOut = w }(tablesOut)
+
+	dir, err := ioutil.TempDir("", "rainforest-wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "runs.json")
+	err = recordStartedRuns(path, []startedRun{{ID: 100, Name: "staging"}, {ID: 101}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, failed := range []bool{false, true} {
+		out := &bytes.Buffer{}
+		tablesOut = out
+		client := &fakeRerunClient{
+			results: map[int]string{100: "passed", 101: "passed", 102: "passed"},
+			reports: map[int]string{100: "<testsuites/>", 101: "<testsuites/>", 102: "<testsuites/>"},
+		}
+		if failed {
+			client.results[102] = "failed"
+		}
+		r := newRunner()
+		r.client = client
+
+		c := newFakeContext(map[string]interface{}{
+			"state-file": path,
+			"junit-file": filepath.Join(dir, "results.xml"),
+		}, cli.Args{"102", "101"})
+		err = r.waitForRuns(c)
+		if failed {
+			if err == nil || !strings.Contains(err.Error(), "1 of 3 runs failed") {
+				t.Errorf("Expected 1 of 3 runs to fail, got %v", err)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"results.staging.xml", "results.run_101.xml", "results.run_102.xml"} {
+			if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("Expected %v to be written: %v", name, err)
+			}
+		}
+		for _, want := range []string{"staging", "run 101", "run 102"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("Expected %q in the table:\n%v", want, out.String())
+			}
+		}
+	}
+
+	c := newFakeContext(map[string]interface{}{}, cli.Args{})
+	if err = newRunner().waitForRuns(c); err == nil {
+		t.Error("Expected an error without runs")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// rfmlWatcher keeps a parsed copy of the RFML suite in memory and re-checks
+// (and optionally uploads) the tests whenever their files change.
+type rfmlWatcher struct {
+	api    rfmlAPI
+	upload bool
+	// tests holds the parsed suite keyed by cleaned file path
+	tests map[string]*rainforest.RFTest
+}
+
+func newRFMLWatcher(api rfmlAPI, upload bool) *rfmlWatcher {
+	return &rfmlWatcher{
+		api:    api,
+		upload: upload,
+		tests:  map[string]*rainforest.RFTest{},
+	}
+}
+
+// watchRFML validates the test folder and then keeps watching it, validating
+// (and uploading when upload is true) the tests that change until interrupted.
+func watchRFML(c cliContext, api rfmlAPI, upload bool) error {
+	if c.Args().First() != "" {
+		return cli.NewExitError("--watch cannot be used with a file path, use --test-folder instead", 1)
+	}
+	folder := c.String("test-folder")
+
+	w := newRFMLWatcher(api, upload)
+	err := w.load(folder)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	// We don't bail on an invalid suite, the whole point is to let the user fix it
+	validateRFMLFiles(w.suite(), false, api)
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer fsWatcher.Close()
+
+	err = addWatchDirs(fsWatcher, folder)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	log.Printf("Watching %v for changes...", folder)
+	w.watch(fsWatcher, nil)
+	return nil
+}
+
+// load reads the whole suite from folder.
+func (w *rfmlWatcher) load(folder string) error {
+	tests, err := readRFMLFiles([]string{folder})
+	if err != nil {
+		return err
+	}
+	for _, test := range tests {
+		w.tests[filepath.Clean(test.RFMLPath)] = test
+	}
+	return nil
+}
+
+// suite returns the currently known tests ordered by their path.
+func (w *rfmlWatcher) suite() []*rainforest.RFTest {
+	paths := make([]string, 0, len(w.tests))
+	for path := range w.tests {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	tests := make([]*rainforest.RFTest, len(paths))
+	for i, path := range paths {
+		tests[i] = w.tests[path]
+	}
+	return tests
+}
+
+// watch consumes file system events, debounces them and hands the changed
+// paths over to handleChanges. It returns when stop is closed or the watcher
+// is shut down.
+func (w *rfmlWatcher) watch(fsWatcher *fsnotify.Watcher, stop <-chan struct{}) {
+	pending := map[string]bool{}
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-stop:
+			return
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+					// New directories need watching too and may come with files already in them
+					err = addWatchDirs(fsWatcher, event.Name)
+					if err != nil {
+						log.Printf("Unable to watch %v: %v", event.Name, err)
+					}
+					filepath.Walk(event.Name, func(path string, f os.FileInfo, err error) error {
+						pending[filepath.Clean(path)] = true
+						return nil
+					})
+				}
+			}
+			pending[filepath.Clean(event.Name)] = true
+			debounce = time.After(rfmlWatchDebounce)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Error watching files: %v", err)
+		case <-debounce:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			pending = map[string]bool{}
+			debounce = nil
+
+			err := w.handleChanges(paths)
+			if err != nil {
+				log.Print(err.Error())
+			}
+		}
+	}
+}
+
+// handleChanges re-parses the RFML files found in paths, re-validates the
+// embed graph of the whole suite and uploads the changed tests if required.
+func (w *rfmlWatcher) handleChanges(paths []string) error {
+	var changed []*rainforest.RFTest
+	var parseErrors []error
+
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if !strings.HasSuffix(path, ".rfml") {
+			continue
+		}
+
+		test, err := readRFMLFile(path)
+		if os.IsNotExist(err) {
+			if _, ok := w.tests[path]; ok {
+				log.Printf("%v was removed", path)
+				delete(w.tests, path)
+			}
+			continue
+		} else if err != nil {
+			parseErrors = append(parseErrors, err)
+			continue
+		}
+
+		log.Printf("%v has changed", path)
+		w.tests[path] = test
+		changed = append(changed, test)
+	}
+
+	if len(parseErrors) > 0 {
+		for _, err := range parseErrors {
+			log.Print(err.Error())
+		}
+		return errValidation
+	}
+
+	err := validateRFMLFiles(w.suite(), false, w.api)
+	if err != nil {
+		return err
+	}
+
+	if !w.upload || len(changed) == 0 {
+		return nil
+	}
+
+	err = uploadRFMLFiles(changed, false, w.api)
+	if err != nil {
+		return err
+	}
+	log.Printf("Uploaded %v changed test(s)", len(changed))
+	return nil
+}
+
+// addWatchDirs adds root and all of its subdirectories to the watcher, as
+// fsnotify doesn't watch directories recursively.
+func addWatchDirs(fsWatcher *fsnotify.Watcher, root string) error {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return errors.New(root + " is not a directory")
+	}
+
+	return filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return fsWatcher.Add(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+// watchRfmlAPI records created and updated tests and is safe for concurrent use
+type watchRfmlAPI struct {
+	testRfmlAPI
+	mu      sync.Mutex
+	created []rainforest.TestIDPair
+	updated []string
+}
+
+func (w *watchRfmlAPI) GetTestIDs() ([]rainforest.TestIDPair, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pairs := []rainforest.TestIDPair{{ID: 1, RFMLID: "a1"}, {ID: 2, RFMLID: "b4"}, {ID: 3, RFMLID: "b5"}}
+	return append(pairs, w.created...), nil
+}
+
+func (w *watchRfmlAPI) CreateTest(test *rainforest.RFTest) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.created = append(w.created, rainforest.TestIDPair{ID: 100 + len(w.created), RFMLID: test.RFMLID})
+	return nil
+}
+
+func (w *watchRfmlAPI) UpdateTest(test *rainforest.RFTest) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.updated = append(w.updated, test.RFMLID)
+	return nil
+}
+
+func (w *watchRfmlAPI) updatedTests() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.updated...)
+}
+
+func writeRFMLFile(t *testing.T, path string, test *rainforest.RFTest) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = rainforest.NewRFMLWriter(f).WriteRFMLTest(test)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherHandleChanges(t *testing.T) {
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+
+	api := new(watchRfmlAPI)
+	w := newRFMLWatcher(api, true)
+	err := w.load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suiteSize := len(w.suite())
+
+	// Changing a test uploads only that test
+	a1Path := filepath.Join(dir, "a/a1.rfml")
+	writeRFMLFile(t, a1Path, &rainforest.RFTest{
+		RFMLID:  "a1",
+		Title:   "changed title",
+		Execute: true,
+		Steps:   []interface{}{rainforest.RFEmbeddedTest{RFMLID: "b4"}},
+	})
+	err = w.handleChanges([]string{a1Path, filepath.Join(dir, "a/bogus.rf")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := api.updatedTests(); len(got) != 1 || got[0] != "a1" {
+		t.Errorf("Expected only a1 to be uploaded, got %v", got)
+	}
+	if title := w.tests[a1Path].Title; title != "changed title" {
+		t.Errorf("Expected changed test to be re-parsed, got title %v", title)
+	}
+
+	// Removing a test drops it from the suite, but the embed graph is now broken
+	err = os.Remove(filepath.Join(dir, "b/b/b4.rfml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.updated = nil
+	w.api = &testRfmlAPI{}
+	err = w.handleChanges([]string{filepath.Join(dir, "b/b/b4.rfml")})
+	if err != errValidation {
+		t.Errorf("Expected validation error for missing embedded test, got %v", err)
+	}
+	if got := len(w.suite()); got != suiteSize-1 {
+		t.Errorf("Expected %v tests in the suite, got %v", suiteSize-1, got)
+	}
+
+	// Unparseable files are reported and not uploaded
+	w.api = api
+	err = ioutil.WriteFile(a1Path, []byte("#! a1\n# site_id: nope\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.handleChanges([]string{a1Path})
+	if err != errValidation {
+		t.Errorf("Expected validation error for unparseable file, got %v", err)
+	}
+	if got := api.updatedTests(); len(got) != 0 {
+		t.Errorf("Expected nothing to be uploaded, got %v", got)
+	}
+}
+
+func TestWatcherWatch(t *testing.T) {
+	dir := setupTestRFMLDir()
+	defer os.RemoveAll(dir)
+
+	defer func(d time.Duration) { rfmlWatchDebounce = d }(rfmlWatchDebounce)
+	rfmlWatchDebounce = time.Millisecond * 50
+
+	api := new(watchRfmlAPI)
+	w := newRFMLWatcher(api, true)
+	err := w.load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsWatcher.Close()
+	err = addWatchDirs(fsWatcher, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		w.watch(fsWatcher, stop)
+		close(done)
+	}()
+
+	// Tests in newly created directories are picked up as well
+	err = os.MkdirAll(filepath.Join(dir, "c"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(rfmlWatchDebounce * 2)
+	writeRFMLFile(t, filepath.Join(dir, "c/c1.rfml"), &rainforest.RFTest{RFMLID: "c1", Title: "c1", Execute: true})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := api.updatedTests(); len(got) > 0 {
+			break
+		}
+		time.Sleep(rfmlWatchDebounce)
+	}
+	close(stop)
+	<-done
+
+	got := api.updatedTests()
+	if len(got) == 0 || got[len(got)-1] != "c1" {
+		t.Errorf("Expected c1 to be uploaded after it was created, got %v", got)
+	}
+}